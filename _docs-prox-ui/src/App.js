@@ -1,4 +1,4 @@
-import React, { useState } from "react";
+import React, { useEffect, useState } from "react";
 import { HashRouter } from "react-router-dom";
 import styles from "./app.module.css";
 import SpecContent from "./SpecContent";
@@ -10,6 +10,9 @@ async function loadSpecs() {
     key: r.key,
     name: r.name,
     url: r.path,
+    title: r.title,
+    version: r.version,
+    description: r.description,
   }));
 }
 
@@ -17,6 +20,14 @@ function App() {
   const [loaded, setLoaded] = useState(false);
   const [loading, setLoading] = useState(false);
   const [specs, setSpecs] = useState([]);
+  useEffect(() => {
+    const events = new EventSource("/docs/_events");
+    const reload = () => loadSpecs().then((specs) => setSpecs(specs));
+    ["added", "removed", "replaced", "changed", "resync"].forEach((type) =>
+      events.addEventListener(type, reload)
+    );
+    return () => events.close();
+  }, []);
   if (!loaded) {
     if (!loading) {
       setLoading(true);
@@ -13,6 +13,12 @@ function SidebarItem({ spec }) {
         className={styles.sidebarItem}
       >
         {spec.name}
+        {spec.title && (
+          <div className={styles.sidebarItemInfo} title={spec.description}>
+            {spec.title}
+            {spec.version && ` (${spec.version})`}
+          </div>
+        )}
       </NavLink>
       <div
         className={`${styles.sidebarItemPin} ${
@@ -47,7 +53,9 @@ function Sidebar({ specs }) {
   ];
   const [filter, setFilter] = useState("");
   const filteredSpecs = sortedSpecs.filter((s) =>
-    s.name.toLowerCase().includes(filter.toLowerCase())
+    [s.name, s.title, s.description].some(
+      (t) => t && t.toLowerCase().includes(filter.toLowerCase())
+    )
   );
   return (
     <div className={styles.sidebarWrapper}>
@@ -63,9 +71,21 @@ function Sidebar({ specs }) {
             onChange={(e) => setFilter(e.target.value)}
           />
         </div>
-        {filteredSpecs.map((spec) => (
-          <SidebarItem spec={spec} />
-        ))}
+        {filteredSpecs.map((spec, i) => {
+          const previous = filteredSpecs[i - 1];
+          const startsGroup =
+            !spec.pinned &&
+            spec.group &&
+            (!previous || previous.pinned || previous.group !== spec.group);
+          return (
+            <React.Fragment key={spec.key}>
+              {startsGroup && (
+                <div className={styles.sidebarGroup}>{spec.group}</div>
+              )}
+              <SidebarItem spec={spec} />
+            </React.Fragment>
+          );
+        })}
       </div>
       <Route
         exact
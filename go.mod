@@ -6,9 +6,11 @@ require (
 	github.com/fsnotify/fsnotify v1.4.9
 	github.com/gorilla/handlers v1.4.2
 	github.com/gorilla/mux v1.7.4
+	github.com/prometheus/client_golang v1.7.1
 	golang.org/x/net v0.0.0-20200625001655-4c5254603344 // indirect
 	golang.org/x/sys v0.0.0-20200625212154-ddb9806d33ae // indirect
 	k8s.io/api v0.18.3
 	k8s.io/apimachinery v0.18.3
 	k8s.io/client-go v0.18.3
+	sigs.k8s.io/yaml v1.2.0
 )
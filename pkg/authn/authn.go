@@ -0,0 +1,170 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+)
+
+// Principal is an authenticated caller
+type Principal struct {
+	Subject string   `json:"sub"`
+	Groups  []string `json:"groups,omitempty"`
+	// Method the principal was authenticated with, ie. oidc, api-key or header
+	Method string `json:"method"`
+	// Header carried the credentials of the request, ie. Authorization for an ID token
+	Header string `json:"-"`
+}
+
+// InAnyGroup is true if the principal is a member of any of the groups, * matches every principal
+func (p *Principal) InAnyGroup(groups []string) bool {
+	for _, g := range groups {
+		if g == "*" && p != nil {
+			return true
+		}
+		if p == nil {
+			continue
+		}
+		for _, member := range p.Groups {
+			if member == g {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ErrNoCredentials is returned by an Authenticator when the request carries none of its credentials
+var ErrNoCredentials = errors.New("authn: no credentials")
+
+// Authenticator authenticates the caller of a request
+type Authenticator interface {
+	// Authenticate returns the principal of the request, ErrNoCredentials if the request has none of the
+	// credentials of the authenticator or another error if they are invalid
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// router is an Authenticator that serves its own endpoints, ie. the OIDC login
+type router interface {
+	routes() map[string]http.Handler
+	loginPath() string
+}
+
+// credentialCarrier is an Authenticator whose credentials are carried in request headers
+type credentialCarrier interface {
+	credentialHeaders() []string
+}
+
+// Options of the middleware
+type Options struct {
+	// PublicPaths are served without authentication, paths ending with / match all paths below them
+	PublicPaths []string
+	// Logger of the rejected requests, the default logger if nil
+	Logger logging.Logger
+}
+
+// Middleware requires every request to be authenticated by one of its authenticators
+type Middleware struct {
+	authenticators []Authenticator
+	public         []string
+	routes         map[string]http.Handler
+	login          string
+	headers        []string
+	logger         logging.Logger
+}
+
+// New creates a middleware trying the authenticators in order
+func New(opts Options, authenticators ...Authenticator) *Middleware {
+	m := &Middleware{authenticators: authenticators, public: opts.PublicPaths, routes: make(map[string]http.Handler), logger: opts.Logger}
+	if m.logger == nil {
+		m.logger = logging.Default()
+	}
+	for _, a := range authenticators {
+		if r, ok := a.(router); ok {
+			for path, handler := range r.routes() {
+				m.routes[path] = handler
+			}
+			if m.login == "" {
+				m.login = r.loginPath()
+			}
+		}
+		if c, ok := a.(credentialCarrier); ok {
+			m.headers = append(m.headers, c.credentialHeaders()...)
+		}
+	}
+	return m
+}
+
+// CredentialHeaders are the request headers that may carry credentials of the authenticators, they must not
+// be forwarded to other services
+func (m *Middleware) CredentialHeaders() []string {
+	return m.headers
+}
+
+// Wrap returns a handler that authenticates the requests before passing them to next with the principal
+// in their context. Unauthenticated browsers are redirected to the login if there is one
+func (m *Middleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if route, ok := m.routes[r.URL.Path]; ok {
+			route.ServeHTTP(rw, r)
+			return
+		}
+		if m.isPublic(r.URL.Path) {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		principal, err := m.authenticate(r)
+		if err != nil {
+			m.logger.Debug("rejected request", "path", r.URL.Path, "err", err)
+			m.unauthorized(rw, r)
+			return
+		}
+		next.ServeHTTP(rw, r.WithContext(NewContext(r.Context(), principal)))
+	})
+}
+
+func (m *Middleware) authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range m.authenticators {
+		principal, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrNoCredentials
+}
+
+func (m *Middleware) isPublic(path string) bool {
+	for _, p := range m.public {
+		if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Middleware) unauthorized(rw http.ResponseWriter, r *http.Request) {
+	if m.login != "" && r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(rw, r, m.login+"?redirect="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+	rw.Header().Set("WWW-Authenticate", "Bearer")
+	rw.WriteHeader(http.StatusUnauthorized)
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the principal
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the principal of the context, false if the request was not authenticated
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(contextKey{}).(*Principal)
+	return principal, ok
+}
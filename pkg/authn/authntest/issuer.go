@@ -0,0 +1,94 @@
+// Package authntest provides an OpenID Connect provider to test the authentication with
+package authntest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ClientSecret is the secret the clients authenticate to the issuer with
+const ClientSecret = "client-secret"
+
+// Issuer is a minimal OpenID Connect provider issuing ID tokens for jane of the payments group
+type Issuer struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+	mu       sync.Mutex
+	nonces   map[string]string
+}
+
+// NewIssuer starts an issuer of ID tokens for the client, it logs in every browser without asking
+func NewIssuer(t *testing.T, clientID string) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	i := &Issuer{key: key, clientID: clientID, nonces: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(rw http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(rw).Encode(map[string]string{
+			"issuer":                 i.URL,
+			"authorization_endpoint": i.URL + "/authorize",
+			"token_endpoint":         i.URL + "/token",
+			"jwks_uri":               i.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(rw http.ResponseWriter, r *http.Request) {
+		e := big.NewInt(int64(key.E)).Bytes()
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "test", "kty": "RSA", "n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()), "e": base64.RawURLEncoding.EncodeToString(e),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(rw http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		i.mu.Lock()
+		i.nonces["code-1"] = q.Get("nonce")
+		i.mu.Unlock()
+		http.Redirect(rw, r, q.Get("redirect_uri")+"?code=code-1&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(rw http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		i.mu.Lock()
+		nonce, ok := i.nonces[r.FormValue("code")]
+		i.mu.Unlock()
+		if id != clientID || secret != ClientSecret || !ok {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(rw).Encode(map[string]string{"id_token": i.Token(t, map[string]interface{}{"nonce": nonce})})
+	})
+	i.Server = httptest.NewServer(mux)
+	return i
+}
+
+// Token returns a signed ID token of jane, the extra claims are added to or replace the default claims
+func (i *Issuer) Token(t *testing.T, extra map[string]interface{}) string {
+	claims := map[string]interface{}{
+		"iss": i.URL, "aud": i.clientID, "sub": "jane", "groups": []string{"payments"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("unable to sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
@@ -0,0 +1,453 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDC endpoints served by the middleware
+const (
+	LoginPath    = "/auth/login"
+	CallbackPath = "/auth/callback"
+	LogoutPath   = "/auth/logout"
+)
+
+const (
+	sessionCookie = "docsprox_session"
+	stateCookie   = "docsprox_state"
+	clockSkew     = time.Minute
+	keysRefetch   = time.Minute
+)
+
+// OIDCOptions configure the login with an OpenID Connect provider
+type OIDCOptions struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the external url of the callback path
+	RedirectURL string
+	// Scopes requested in addition to openid
+	Scopes []string
+	// UsernameClaim is the subject of the principal, sub by default
+	UsernameClaim string
+	// GroupsClaim are the groups of the principal, groups by default
+	GroupsClaim string
+	// CookieSecret signs the session cookies
+	CookieSecret string
+	// SessionTTL is the lifetime of a login session, 8 hours by default
+	SessionTTL time.Duration
+	// Client used to talk to the provider, a client with a 10 second timeout if nil
+	Client *http.Client
+}
+
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDC authenticates browsers with a login session and API clients with the ID tokens of the provider
+type OIDC struct {
+	opts     OIDCOptions
+	provider providerMetadata
+	mu       sync.RWMutex
+	keys     map[string]*rsa.PublicKey
+	fetched  time.Time
+}
+
+// NewOIDC discovers the endpoints of the issuer
+func NewOIDC(ctx context.Context, opts OIDCOptions) (*OIDC, error) {
+	if opts.CookieSecret == "" {
+		return nil, fmt.Errorf("authn: oidc requires a cookie secret")
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.UsernameClaim == "" {
+		opts.UsernameClaim = "sub"
+	}
+	if opts.GroupsClaim == "" {
+		opts.GroupsClaim = "groups"
+	}
+	if opts.SessionTTL <= 0 {
+		opts.SessionTTL = 8 * time.Hour
+	}
+	o := &OIDC{opts: opts}
+	discovery := strings.TrimSuffix(opts.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := o.getJSON(ctx, discovery, &o.provider); err != nil {
+		return nil, fmt.Errorf("authn: unable to discover oidc provider: %w", err)
+	}
+	if o.provider.Issuer != opts.IssuerURL {
+		return nil, fmt.Errorf("authn: oidc provider issuer %s does not match %s", o.provider.Issuer, opts.IssuerURL)
+	}
+	if err := o.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *OIDC) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.opts.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// refreshKeys fetches the RSA signing keys of the provider
+func (o *OIDC) refreshKeys(ctx context.Context) error {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := o.getJSON(ctx, o.provider.JWKSURI, &set); err != nil {
+		return fmt.Errorf("authn: unable to fetch oidc signing keys: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.keys, o.fetched = keys, time.Now()
+	return nil
+}
+
+func (o *OIDC) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	o.mu.RLock()
+	key, ok := o.keys[kid]
+	fetched := o.fetched
+	o.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	// the keys are fetched again at most once per keysRefetch in case the provider rotated them
+	if time.Since(fetched) < keysRefetch {
+		return nil, fmt.Errorf("authn: unknown signing key %s", kid)
+	}
+	if err := o.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if key, ok = o.keys[kid]; !ok {
+		return nil, fmt.Errorf("authn: unknown signing key %s", kid)
+	}
+	return key, nil
+}
+
+// verify the RS256 signature and the issuer, audience and lifetime of the ID token and return its claims
+func (o *OIDC) verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("authn: malformed id token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("authn: unsupported id token algorithm %s", header.Alg)
+	}
+	key, err := o.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("authn: malformed id token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("authn: invalid id token signature")
+	}
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims["iss"] != o.provider.Issuer {
+		return nil, fmt.Errorf("authn: id token issued by %v", claims["iss"])
+	}
+	if !audienceContains(claims["aud"], o.opts.ClientID) {
+		return nil, fmt.Errorf("authn: id token not issued for %s", o.opts.ClientID)
+	}
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); !ok || now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return nil, fmt.Errorf("authn: id token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("authn: id token not yet valid")
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("authn: malformed id token segment: %w", err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("authn: malformed id token segment: %w", err)
+	}
+	return nil
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == clientID
+	case []interface{}:
+		for _, v := range a {
+			if v == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (o *OIDC) principalOf(claims map[string]interface{}) (*Principal, error) {
+	subject, _ := claims[o.opts.UsernameClaim].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("authn: id token has no %s claim", o.opts.UsernameClaim)
+	}
+	principal := &Principal{Subject: subject, Method: "oidc"}
+	switch groups := claims[o.opts.GroupsClaim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				principal.Groups = append(principal.Groups, s)
+			}
+		}
+	case string:
+		principal.Groups = strings.FieldsFunc(groups, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	return principal, nil
+}
+
+// Authenticate the request with the session cookie of a login or a bearer ID token. The session takes
+// precedence so that a logged in browser can send the bearer tokens of other services, ie. through a proxy
+func (o *OIDC) Authenticate(r *http.Request) (*Principal, error) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return o.authenticateToken(r)
+	}
+	var session struct {
+		Principal
+		Expires int64 `json:"exp"`
+	}
+	if err := o.unseal(cookie.Value, &session); err != nil {
+		return nil, err
+	}
+	if time.Now().After(time.Unix(session.Expires, 0)) {
+		return nil, fmt.Errorf("authn: session expired")
+	}
+	session.Principal.Header = "Cookie"
+	return &session.Principal, nil
+}
+
+func (o *OIDC) authenticateToken(r *http.Request) (*Principal, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+	claims, err := o.verify(r.Context(), strings.TrimPrefix(auth, "Bearer "))
+	if err != nil {
+		return nil, err
+	}
+	principal, err := o.principalOf(claims)
+	if err != nil {
+		return nil, err
+	}
+	principal.Header = "Authorization"
+	return principal, nil
+}
+
+func (o *OIDC) credentialHeaders() []string {
+	return []string{"Cookie"}
+}
+
+func (o *OIDC) routes() map[string]http.Handler {
+	return map[string]http.Handler{
+		LoginPath:    http.HandlerFunc(o.login),
+		CallbackPath: http.HandlerFunc(o.callback),
+		LogoutPath:   http.HandlerFunc(o.logout),
+	}
+}
+
+func (o *OIDC) loginPath() string {
+	return LoginPath
+}
+
+type loginState struct {
+	State    string `json:"state"`
+	Redirect string `json:"redirect"`
+}
+
+// login redirects to the authorization endpoint of the provider
+func (o *OIDC) login(rw http.ResponseWriter, r *http.Request) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	state := loginState{State: hex.EncodeToString(b), Redirect: safeRedirect(r.URL.Query().Get("redirect"))}
+	sealed, err := o.seal(state)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(rw, &http.Cookie{Name: stateCookie, Value: sealed, Path: CallbackPath, MaxAge: 600, HttpOnly: true, SameSite: http.SameSiteLaxMode, Secure: r.TLS != nil})
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {o.opts.ClientID},
+		"redirect_uri":  {o.opts.RedirectURL},
+		"scope":         {strings.Join(append([]string{"openid"}, o.opts.Scopes...), " ")},
+		"state":         {state.State},
+		"nonce":         {state.State},
+	}
+	http.Redirect(rw, r, o.provider.AuthorizationEndpoint+"?"+query.Encode(), http.StatusFound)
+}
+
+// callback exchanges the authorization code for an ID token and starts a session
+func (o *OIDC) callback(rw http.ResponseWriter, r *http.Request) {
+	var state loginState
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil || o.unseal(cookie.Value, &state) != nil || state.State != r.URL.Query().Get("state") {
+		http.Error(rw, "invalid login state", http.StatusBadRequest)
+		return
+	}
+	claims, err := o.exchange(r.Context(), r.URL.Query().Get("code"))
+	if err == nil && claims["nonce"] != state.State {
+		err = fmt.Errorf("authn: id token nonce does not match")
+	}
+	var principal *Principal
+	if err == nil {
+		principal, err = o.principalOf(claims)
+	}
+	if err != nil {
+		http.Error(rw, "login failed", http.StatusUnauthorized)
+		return
+	}
+	session, err := o.seal(struct {
+		Principal
+		Expires int64 `json:"exp"`
+	}{Principal: *principal, Expires: time.Now().Add(o.opts.SessionTTL).Unix()})
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(rw, &http.Cookie{Name: stateCookie, Path: CallbackPath, MaxAge: -1})
+	http.SetCookie(rw, &http.Cookie{Name: sessionCookie, Value: session, Path: "/", MaxAge: int(o.opts.SessionTTL.Seconds()), HttpOnly: true, SameSite: http.SameSiteLaxMode, Secure: r.TLS != nil})
+	http.Redirect(rw, r, state.Redirect, http.StatusFound)
+}
+
+func (o *OIDC) exchange(ctx context.Context, code string) (map[string]interface{}, error) {
+	if code == "" {
+		return nil, errors.New("authn: missing authorization code")
+	}
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {o.opts.RedirectURL}}
+	req, err := http.NewRequest(http.MethodPost, o.provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.opts.ClientID), url.QueryEscape(o.opts.ClientSecret))
+	resp, err := o.opts.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("authn: unable to exchange code: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("authn: token endpoint responded with %s", resp.Status)
+	}
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("authn: invalid token response: %w", err)
+	}
+	return o.verify(ctx, token.IDToken)
+}
+
+func (o *OIDC) logout(rw http.ResponseWriter, r *http.Request) {
+	http.SetCookie(rw, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(rw, r, "/", http.StatusFound)
+}
+
+// safeRedirect only allows redirects to paths of this server
+func safeRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		return "/"
+	}
+	return redirect
+}
+
+// seal encodes v as json signed with the cookie secret
+func (o *OIDC) seal(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + o.sign(payload), nil
+}
+
+func (o *OIDC) unseal(sealed string, v interface{}) error {
+	parts := strings.Split(sealed, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(o.sign(parts[0]))) {
+		return fmt.Errorf("authn: invalid cookie signature")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("authn: malformed cookie: %w", err)
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (o *OIDC) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(o.opts.CookieSecret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,121 @@
+package authn
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// APIKeyHeader carries the static api keys
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is a static key and the principal it authenticates
+type APIKey struct {
+	Key       string
+	Principal Principal
+}
+
+type apiKeys []APIKey
+
+// APIKeys authenticates requests with one of the keys in the api key header
+func APIKeys(keys ...APIKey) Authenticator {
+	return apiKeys(keys)
+}
+
+func (a apiKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	for _, k := range a {
+		if k.Key != "" && subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			principal := k.Principal
+			principal.Method, principal.Header = "api-key", APIKeyHeader
+			return &principal, nil
+		}
+	}
+	return nil, fmt.Errorf("authn: unknown api key")
+}
+
+func (a apiKeys) credentialHeaders() []string {
+	return []string{APIKeyHeader}
+}
+
+// HeaderOptions configure the trusted headers set by an authenticating proxy
+type HeaderOptions struct {
+	// UserHeader carries the subject, X-Forwarded-User by default
+	UserHeader string
+	// GroupsHeader carries the comma separated groups, X-Forwarded-Groups by default
+	GroupsHeader string
+	// TrustedProxies are the CIDRs the headers are accepted from, the loopback addresses if empty
+	TrustedProxies []string
+}
+
+// defaultTrustedProxies only trust a proxy running on the same host, the headers can be forged by any
+// other caller that reaches the server directly
+var defaultTrustedProxies = []string{"127.0.0.0/8", "::1/128"}
+
+type trustedHeader struct {
+	user, groups string
+	proxies      []*net.IPNet
+}
+
+// TrustedHeader authenticates requests with the headers of an authenticating proxy in front of the server
+func TrustedHeader(opts HeaderOptions) (Authenticator, error) {
+	t := &trustedHeader{user: opts.UserHeader, groups: opts.GroupsHeader}
+	if t.user == "" {
+		t.user = "X-Forwarded-User"
+	}
+	if t.groups == "" {
+		t.groups = "X-Forwarded-Groups"
+	}
+	proxies := opts.TrustedProxies
+	if len(proxies) == 0 {
+		proxies = defaultTrustedProxies
+	}
+	for _, cidr := range proxies {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("authn: invalid trusted proxy %s: %w", cidr, err)
+		}
+		t.proxies = append(t.proxies, network)
+	}
+	return t, nil
+}
+
+func (t *trustedHeader) Authenticate(r *http.Request) (*Principal, error) {
+	user := r.Header.Get(t.user)
+	if user == "" {
+		return nil, ErrNoCredentials
+	}
+	if !t.trusted(r.RemoteAddr) {
+		return nil, fmt.Errorf("authn: %s set by untrusted address %s", t.user, r.RemoteAddr)
+	}
+	principal := &Principal{Subject: user, Method: "header", Header: t.user}
+	for _, g := range strings.Split(r.Header.Get(t.groups), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			principal.Groups = append(principal.Groups, g)
+		}
+	}
+	return principal, nil
+}
+
+func (t *trustedHeader) credentialHeaders() []string {
+	return []string{t.user, t.groups}
+}
+
+func (t *trustedHeader) trusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	for _, network := range t.proxies {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/SimonSchneider/docs-prox/pkg/openapi"
+)
+
+// diff compares two revisions of a spec, read from files or urls, and returns the exit code
+func diff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	output := flags.String("output", "text", "output format: text or json")
+	failOnBreaking := flags.Bool("fail-on-breaking", true, "exit with status 1 if there are breaking changes")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s diff [flags] <from> <to>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	from, err := loadSpec(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	to, err := loadSpec(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	d, err := openapi.DiffContents(from, to)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	d.From, d.To = flags.Arg(0), flags.Arg(1)
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(d)
+	default:
+		for _, c := range d.Changes {
+			severity := "non-breaking"
+			if c.Breaking {
+				severity = "breaking"
+			}
+			fmt.Printf("%-12s %-22s %s: %s\n", severity, c.Kind, c.Pointer, c.Message)
+		}
+		fmt.Printf("%d breaking and %d non-breaking changes\n", d.Breaking, d.NonBreaking)
+	}
+	if *failOnBreaking && d.HasBreakingChanges() {
+		return 1
+	}
+	return 0
+}
+
+// loadSpec reads a spec from a local file or fetches it if it is a http(s) url
+func loadSpec(location string) ([]byte, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return openapi.NewRemoteSpec(location).Get()
+	}
+	content, err := ioutil.ReadFile(location)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read spec %s: %w", location, err)
+	}
+	return content, nil
+}
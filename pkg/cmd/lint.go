@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/SimonSchneider/docs-prox/pkg/openapi"
+)
+
+// severities are the rule=severity overrides of the lint flags
+type severities map[string]openapi.Severity
+
+func (s severities) String() string {
+	pairs := make([]string, 0, len(s))
+	for rule, severity := range s {
+		pairs = append(pairs, rule+"="+string(severity))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (s severities) Set(value string) error {
+	pair := strings.SplitN(value, "=", 2)
+	if len(pair) != 2 {
+		return fmt.Errorf("invalid rule severity %s, expected rule=severity", value)
+	}
+	severity, err := openapi.ParseSeverity(pair[1])
+	if err != nil {
+		return err
+	}
+	s[pair[0]] = severity
+	return nil
+}
+
+// lint checks a spec, read from a file or url, and returns the exit code
+func lint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	output := flags.String("output", "text", "output format: text or json")
+	failOn := flags.String("fail-on", "error", "exit with status 1 if there are problems of at least this severity: error, warning, info or off")
+	overrides := severities{}
+	flags.Var(overrides, "rule", "override the severity of a rule as rule=severity, off disables it (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s lint [flags] <spec>\n", os.Args[0])
+		flags.PrintDefaults()
+		fmt.Fprintln(flags.Output(), "rules:")
+		for _, rule := range openapi.DefaultLintRules() {
+			fmt.Fprintf(flags.Output(), "  %-26s %-8s %s\n", rule.Name, rule.Severity, rule.Description)
+		}
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	threshold, err := openapi.ParseSeverity(*failOn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	content, err := loadSpec(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	report, err := openapi.NewLinter(openapi.LintOptions{Severities: overrides}, openapi.DefaultLintRules()...).LintContent(content)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(report)
+	default:
+		for _, p := range report.Problems {
+			fmt.Printf("%-8s %-26s %s: %s\n", p.Severity, p.Rule, p.Pointer, p.Message)
+		}
+		fmt.Printf("score %d with %d errors, %d warnings and %d infos\n", report.Score, report.Errors, report.Warnings, report.Infos)
+	}
+	if report.HasProblems(threshold) {
+		return 1
+	}
+	return 0
+}
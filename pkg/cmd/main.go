@@ -3,36 +3,92 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
 
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
 	"github.com/SimonSchneider/docs-prox/pkg/openapi"
 
 	"github.com/SimonSchneider/docs-prox/pkg/config"
 )
 
 func main() {
-	fmt.Println("loading configuration")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+		case "diff":
+			os.Exit(diff(os.Args[2:]))
+		case "lint":
+			os.Exit(lint(os.Args[2:]))
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %s\nusage: %s [serve|diff|lint]\n", os.Args[1], os.Args[0])
+			os.Exit(2)
+		}
+	}
+	serve()
+}
+
+func serve() {
+	logger := logging.Default()
 	path := os.Getenv("CONFIG_FILE")
 	if path == "" {
 		path = "_config/config.json"
 	}
+	logger.Info("loading configuration", "path", path)
 	conf, err := config.ReadAndParseFile(path)
 	if err != nil {
-		log.Fatalf("unable to parse config file %s: %v", path, err)
+		fatal(logger, "unable to parse config file", "path", path, "err", err)
+	}
+	if logger, err = conf.Logger(); err != nil {
+		fatal(logging.Default(), "unable to configure logging", "err", err)
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	repo, _, err := conf.BuildRepo(ctx)
+	status := openapi.NewStatusRegistry()
+	repo, _, err := conf.BuildRepo(ctx, status, logger)
+	if err != nil {
+		fatal(logger, "unable to build repo from config", "err", err)
+	}
+	serveOpts, err := conf.ServeOptions(ctx, logger)
 	if err != nil {
-		log.Fatalf("unable to build repo from config: %v", err)
+		fatal(logger, "unable to configure server", "err", err)
+	}
+	logger.Info("starting server", "host", conf.Host, "port", conf.Port)
+	serveOpts = append(serveOpts, openapi.WithStatus(status), openapi.WithServerLogger(logger))
+	_, errChan := openapi.Serve(ctx, repo, conf.Host, conf.Port, serveOpts...)
+	errs := []<-chan error{errChan}
+	for _, view := range conf.Views {
+		host := view.Host
+		if host == "" {
+			host = conf.Host
+		}
+		viewLogger := logger.With("view", view.Name)
+		viewLogger.Info("starting view server", "host", host, "port", view.Port)
+		viewOpts := append(serveOpts[:len(serveOpts):len(serveOpts)], openapi.WithServerLogger(viewLogger))
+		_, viewErrChan := openapi.Serve(ctx, view.Repository(repo), host, view.Port, viewOpts...)
+		errs = append(errs, viewErrChan)
 	}
-	fmt.Println("starting server")
-	_, errChan := openapi.Serve(ctx, repo, conf.Host, conf.Port)
 	select {
-	case err := <-errChan:
-		log.Fatalf("serve failed with: %v", err)
+	case err := <-firstError(errs):
+		fatal(logger, "serve failed", "err", err)
 	case <-ctx.Done():
 		return
 	}
 }
+
+// firstError returns the errors of all servers on one channel
+func firstError(errs []<-chan error) <-chan error {
+	merged := make(chan error, len(errs))
+	for _, errChan := range errs {
+		go func(errChan <-chan error) {
+			if err, ok := <-errChan; ok {
+				merged <- err
+			}
+		}(errChan)
+	}
+	return merged
+}
+
+func fatal(logger logging.Logger, msg string, keyvals ...interface{}) {
+	logger.Error(msg, keyvals...)
+	os.Exit(1)
+}
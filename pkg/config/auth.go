@@ -0,0 +1,156 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/SimonSchneider/docs-prox/pkg/authn"
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+	"github.com/SimonSchneider/docs-prox/pkg/openapi"
+)
+
+// AuthProfile is the json config of a named set of upstream credentials, secrets can be read from
+// the environment with the -env variants
+type AuthProfile struct {
+	Headers         map[string]string `json:"headers"`
+	BearerToken     string            `json:"bearer-token"`
+	BearerTokenEnv  string            `json:"bearer-token-env"`
+	BearerTokenFile string            `json:"bearer-token-file"`
+	Username        string            `json:"username"`
+	Password        string            `json:"password"`
+	PasswordEnv     string            `json:"password-env"`
+	OAuth2          *struct {
+		TokenURL        string   `json:"token-url"`
+		ClientID        string   `json:"client-id"`
+		ClientSecret    string   `json:"client-secret"`
+		ClientSecretEnv string   `json:"client-secret-env"`
+		Scopes          []string `json:"scopes"`
+	} `json:"oauth2"`
+	TLS *struct {
+		CAFile             string `json:"ca-file"`
+		CertFile           string `json:"cert-file"`
+		KeyFile            string `json:"key-file"`
+		InsecureSkipVerify bool   `json:"insecure-skip-verify"`
+	} `json:"tls"`
+}
+
+func (a AuthProfile) build() openapi.AuthProfile {
+	profile := openapi.AuthProfile{
+		Headers:         a.Headers,
+		BearerToken:     orEnv(a.BearerToken, a.BearerTokenEnv),
+		BearerTokenFile: a.BearerTokenFile,
+		Username:        a.Username,
+		Password:        orEnv(a.Password, a.PasswordEnv),
+	}
+	if o := a.OAuth2; o != nil {
+		profile.OAuth2 = &openapi.OAuth2ClientCredentials{
+			TokenURL:     o.TokenURL,
+			ClientID:     o.ClientID,
+			ClientSecret: orEnv(o.ClientSecret, o.ClientSecretEnv),
+			Scopes:       o.Scopes,
+		}
+	}
+	if t := a.TLS; t != nil {
+		profile.TLS = &openapi.TLSOptions{CAFile: t.CAFile, CertFile: t.CertFile, KeyFile: t.KeyFile, InsecureSkipVerify: t.InsecureSkipVerify}
+	}
+	return profile
+}
+
+// orEnv returns the value of the environment variable if it is set, otherwise the value
+func orEnv(value, env string) string {
+	if env != "" {
+		return os.Getenv(env)
+	}
+	return value
+}
+
+// Auth is the json config of the authentication of the callers and the visibility of the specs to them
+type Auth struct {
+	OIDC *struct {
+		IssuerURL       string   `json:"issuer-url"`
+		ClientID        string   `json:"client-id"`
+		ClientSecret    string   `json:"client-secret"`
+		ClientSecretEnv string   `json:"client-secret-env"`
+		RedirectURL     string   `json:"redirect-url"`
+		Scopes          []string `json:"scopes"`
+		UsernameClaim   string   `json:"username-claim"`
+		GroupsClaim     string   `json:"groups-claim"`
+		CookieSecret    string   `json:"cookie-secret"`
+		CookieSecretEnv string   `json:"cookie-secret-env"`
+		SessionTTL      Duration `json:"session-ttl"`
+	} `json:"oidc"`
+	APIKeys []struct {
+		Key    string   `json:"key"`
+		KeyEnv string   `json:"key-env"`
+		Name   string   `json:"name"`
+		Groups []string `json:"groups"`
+	} `json:"api-keys"`
+	TrustedHeader *struct {
+		UserHeader     string   `json:"user-header"`
+		GroupsHeader   string   `json:"groups-header"`
+		TrustedProxies []string `json:"trusted-proxies"`
+	} `json:"trusted-header"`
+	// PublicPaths are served without authentication, the probes and metrics by default
+	PublicPaths []string `json:"public-paths"`
+	Visibility  struct {
+		Default string                   `json:"default"`
+		Rules   []openapi.VisibilityRule `json:"rules"`
+	} `json:"visibility"`
+}
+
+var defaultPublicPaths = []string{"/healthz", "/readyz", "/metrics"}
+
+// serveOption builds the option of the server requiring authentication, nil if no authenticator is configured
+func (a Auth) serveOption(ctx context.Context, logger logging.Logger) (openapi.ServeOption, error) {
+	var authenticators []authn.Authenticator
+	if o := a.OIDC; o != nil {
+		oidc, err := authn.NewOIDC(ctx, authn.OIDCOptions{
+			IssuerURL:     o.IssuerURL,
+			ClientID:      o.ClientID,
+			ClientSecret:  orEnv(o.ClientSecret, o.ClientSecretEnv),
+			RedirectURL:   o.RedirectURL,
+			Scopes:        o.Scopes,
+			UsernameClaim: o.UsernameClaim,
+			GroupsClaim:   o.GroupsClaim,
+			CookieSecret:  orEnv(o.CookieSecret, o.CookieSecretEnv),
+			SessionTTL:    time.Duration(o.SessionTTL),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to configure oidc: %w", err)
+		}
+		authenticators = append(authenticators, oidc)
+	}
+	if len(a.APIKeys) > 0 {
+		keys := make([]authn.APIKey, 0, len(a.APIKeys))
+		for _, k := range a.APIKeys {
+			keys = append(keys, authn.APIKey{Key: orEnv(k.Key, k.KeyEnv), Principal: authn.Principal{Subject: k.Name, Groups: k.Groups}})
+		}
+		authenticators = append(authenticators, authn.APIKeys(keys...))
+	}
+	if h := a.TrustedHeader; h != nil {
+		header, err := authn.TrustedHeader(authn.HeaderOptions{UserHeader: h.UserHeader, GroupsHeader: h.GroupsHeader, TrustedProxies: h.TrustedProxies})
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, header)
+	}
+	if len(authenticators) == 0 {
+		return nil, nil
+	}
+	visibility := openapi.Visibility{Rules: a.Visibility.Rules}
+	switch a.Visibility.Default {
+	case "", "allow":
+	case "deny":
+		visibility.DenyByDefault = true
+	default:
+		return nil, fmt.Errorf("unknown default visibility %s", a.Visibility.Default)
+	}
+	public := a.PublicPaths
+	if public == nil {
+		public = defaultPublicPaths
+	}
+	middleware := authn.New(authn.Options{PublicPaths: public, Logger: logger.With("component", "auth")}, authenticators...)
+	return openapi.WithAuth(middleware, visibility), nil
+}
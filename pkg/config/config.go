@@ -5,37 +5,206 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"time"
 
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+	"github.com/SimonSchneider/docs-prox/pkg/notify"
 	"github.com/SimonSchneider/docs-prox/pkg/providers/environment"
 
 	"github.com/SimonSchneider/docs-prox/pkg/openapi"
 	"github.com/SimonSchneider/docs-prox/pkg/providers/file"
 	"github.com/SimonSchneider/docs-prox/pkg/providers/kubernetes"
+	"github.com/SimonSchneider/docs-prox/pkg/providers/kubernetes/kube"
 )
 
 // Config is the json config file struct
 type Config struct {
-	Host      string `json:"host"`
-	Port      int    `json:"port"`
+	Host    string `json:"host"`
+	Port    int    `json:"port"`
+	Logging struct {
+		Level  string `json:"level"`
+		Format string `json:"format"`
+	} `json:"logging"`
+	History struct {
+		Storage     string `json:"storage"`
+		Path        string `json:"path"`
+		MaxVersions int    `json:"max-versions"`
+	} `json:"history"`
+	Notifications struct {
+		Webhooks []struct {
+			URL       string            `json:"url"`
+			Secret    string            `json:"secret"`
+			SecretEnv string            `json:"secret-env"`
+			Events    []string          `json:"events"`
+			Headers   map[string]string `json:"headers"`
+		} `json:"webhooks"`
+		Timeout Duration `json:"timeout"`
+		Retries *int     `json:"retries"`
+		Backoff Duration `json:"backoff"`
+		// PollInterval fetches every spec again to detect changed content while a webhook is notified of
+		// changed specs, 1 minute by default
+		PollInterval Duration `json:"poll-interval"`
+	} `json:"notifications"`
+	Fetcher struct {
+		ConnectTimeout Duration               `json:"connect-timeout"`
+		ReadTimeout    Duration               `json:"read-timeout"`
+		Retries        *int                   `json:"retries"`
+		Backoff        Duration               `json:"backoff"`
+		MaxBodySize    int64                  `json:"max-body-size"`
+		Auth           map[string]AuthProfile `json:"auth"`
+	} `json:"fetcher"`
+	Auth  Auth `json:"auth"`
+	Proxy struct {
+		Enabled        bool     `json:"enabled"`
+		Hosts          []string `json:"hosts"`
+		Methods        []string `json:"methods"`
+		StripHeaders   []string `json:"strip-headers"`
+		ConnectTimeout Duration `json:"connect-timeout"`
+		Timeout        Duration `json:"timeout"`
+		MaxBodySize    int64    `json:"max-body-size"`
+		RewriteServers bool     `json:"rewrite-servers"`
+	} `json:"proxy"`
+	// Rules curate the served specs of every provider
+	Rules openapi.TransformRules `json:"rules"`
+	Views []View                 `json:"views"`
+	Lint  struct {
+		// Rules override the severities of the lint rules by name, off disables a rule
+		Rules map[string]string `json:"rules"`
+	} `json:"lint"`
 	Providers struct {
 		Environment struct {
-			Enabled bool   `json:"enabled"`
-			Prefix  string `json:"prefix"`
+			Enabled bool                   `json:"enabled"`
+			Prefix  string                 `json:"prefix"`
+			Cache   Cache                  `json:"cache"`
+			Servers Servers                `json:"servers"`
+			Rules   openapi.TransformRules `json:"rules"`
 		} `json:"environment"`
 		File struct {
-			Enabled bool   `json:"enabled"`
-			Path    string `json:"path"`
-			Prefix  string `json:"prefix"`
-			JSONExt string `json:"json-ext"`
-			URLExt  string `json:"url-ext"`
+			Enabled bool                   `json:"enabled"`
+			Path    string                 `json:"path"`
+			Prefix  string                 `json:"prefix"`
+			JSONExt string                 `json:"json-ext"`
+			YAMLExt string                 `json:"yaml-ext"`
+			URLExt  string                 `json:"url-ext"`
+			Cache   Cache                  `json:"cache"`
+			Servers Servers                `json:"servers"`
+			Rules   openapi.TransformRules `json:"rules"`
 		} `json:"file"`
 		Kubernetes struct {
 			Enabled bool `json:"enabled"`
+			// InCluster is auto to use the service account when running in a pod and the kubeconfig
+			// otherwise, always to only use the service account or never to only use the kubeconfig
+			InCluster string `json:"in-cluster"`
+			// Kubeconfig is the path of the kubeconfig, $KUBECONFIG or $HOME/.kube/config if empty
+			Kubeconfig string `json:"kubeconfig"`
+			// Context of the kubeconfig, its current context if empty
+			Context string `json:"context"`
+			// Namespaces the services and configMaps are watched in, every namespace if empty
+			Namespaces []string `json:"namespaces"`
+			// NamespaceSelector selects the watched namespaces by label instead of listing them
+			NamespaceSelector string `json:"namespace-selector"`
+			// ServiceSelector and ConfigMapSelector select the watched services and configMaps by label
+			ServiceSelector   string                 `json:"service-selector"`
+			ConfigMapSelector string                 `json:"configmap-selector"`
+			Annotations       kubernetes.Annotations `json:"annotations"`
+			// KeyTemplate is the name the specs are listed with, {name}.{namespace} by default
+			KeyTemplate string `json:"key-template"`
+			// RouteKeyTemplate is the name the specs of routes are listed with, {name}.{namespace}.{kind} by default
+			RouteKeyTemplate string `json:"route-key-template"`
+			// ClusterDomain of the DNS names the services are fetched from, cluster.local by default
+			ClusterDomain string `json:"cluster-domain"`
+			// Ingresses and HTTPRoutes watch the ingresses and Gateway API HTTPRoutes with the path annotation
+			Ingresses  bool `json:"ingresses"`
+			HTTPRoutes bool `json:"http-routes"`
+			// Resync re-delivers the watched objects periodically to retry the ones that could not be
+			// stored, 5 minutes by default
+			Resync  Duration               `json:"resync"`
+			Cache   Cache                  `json:"cache"`
+			Servers Servers                `json:"servers"`
+			Rules   openapi.TransformRules `json:"rules"`
 		} `json:"kubernetes"`
 	} `json:"providers"`
 }
 
+// Cache configures how the specs of a provider are cached
+type Cache struct {
+	TTL Duration `json:"ttl"`
+	// Refresh is on-demand to fetch expired specs when requested or background to serve the last good
+	// copy while they are refreshed in the background
+	Refresh string `json:"refresh"`
+}
+
+const (
+	defaultCacheTTL        = 20 * time.Second
+	backgroundRefreshCheck = time.Second
+)
+
+// Options returns the cache options of the configured cache
+func (c Cache) Options() (openapi.CacheOptions, error) {
+	opts := openapi.CacheOptions{TTL: c.TTL.Or(defaultCacheTTL)}
+	switch c.Refresh {
+	case "", "on-demand":
+	case "background":
+		opts.Background = true
+	default:
+		return opts, fmt.Errorf("unknown cache refresh %s", c.Refresh)
+	}
+	return opts, nil
+}
+
+// Servers configures the servers the specs of a provider are served with
+type Servers struct {
+	// Origin moves the servers to the scheme and host the specs were discovered at
+	Origin bool `json:"origin"`
+	// URL is the external base url of the specs, ie. https://api.example.com/{name}, see openapi.ServersAt
+	URL string `json:"url"`
+}
+
+// Transforms returns the transforms of the configured servers
+func (s Servers) Transforms() []openapi.Transform {
+	var transforms []openapi.Transform
+	if s.Origin {
+		transforms = append(transforms, openapi.ServersAtOrigin())
+	}
+	if s.URL != "" {
+		transforms = append(transforms, openapi.ServersAt(s.URL))
+	}
+	return transforms
+}
+
+// transforms of the specs of a provider, its servers followed by the global and its own rules
+func (c *Config) transforms(servers Servers, rules openapi.TransformRules) []openapi.Transform {
+	transforms := servers.Transforms()
+	for _, r := range []openapi.TransformRules{c.Rules, rules} {
+		if !r.Empty() {
+			transforms = append(transforms, r.Transform())
+		}
+	}
+	return transforms
+}
+
+// View is an additional server of the specs on its own port, ie. an external view of a curated subset
+type View struct {
+	Name string `json:"name"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// Specs selects the specs of the view, all specs if empty
+	Specs openapi.MetadataFilter `json:"specs"`
+	// Rules curate the specs of the view in addition to the rules of their providers
+	Rules openapi.TransformRules `json:"rules"`
+}
+
+// Repository returns the view of the repo
+func (v View) Repository(repo openapi.Repository) openapi.Repository {
+	var transforms []openapi.Transform
+	if !v.Rules.Empty() {
+		transforms = append(transforms, v.Rules.Transform())
+	}
+	return openapi.TransformedView(openapi.VisibleTo(repo, v.Specs.Matches), transforms...)
+}
+
 // ReadAndParseFile creates a config from a given filepath
 func ReadAndParseFile(path string) (*Config, error) {
 	file, err := os.Open(path)
@@ -56,24 +225,256 @@ func Parse(r io.Reader) (*Config, error) {
 	return &c, nil
 }
 
-// BuildRepo builds a repo and APIStore
-func (c *Config) BuildRepo(ctx context.Context) (openapi.Repository, openapi.SpecStore, error) {
-	cachedRepo := openapi.NewCachedRepository()
-	apiStore := openapi.Logging(cachedRepo)
+// Logger builds the configured logger writing to stderr
+func (c *Config) Logger() (logging.Logger, error) {
+	level, err := logging.ParseLevel(c.Logging.Level)
+	if err != nil {
+		return nil, err
+	}
+	format, err := logging.ParseFormat(c.Logging.Format)
+	if err != nil {
+		return nil, err
+	}
+	return logging.New(os.Stderr, format, level), nil
+}
+
+// BuildRepo builds a repo and APIStore, the providers report their state to status and log with logger
+func (c *Config) BuildRepo(ctx context.Context, status openapi.StatusReporter, logger logging.Logger) (openapi.Repository, openapi.SpecStore, error) {
+	history, err := c.buildHistory()
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := []openapi.RepositoryOption{openapi.WithLogger(logger)}
+	if history != nil {
+		opts = append(opts, openapi.WithHistory(history))
+	}
+	cachedRepo := openapi.NewCachedRepository(opts...)
+	if err := c.startNotifier(ctx, cachedRepo, logger); err != nil {
+		return nil, nil, err
+	}
+	apiStore := openapi.Instrumented(openapi.Logging(cachedRepo, logger))
+	fetcher, err := c.buildFetcher()
+	if err != nil {
+		return nil, nil, err
+	}
+	background := false
 	if conf := c.Providers.Environment; conf.Enabled {
-		environment.Configure(apiStore, conf.Prefix)
+		cache, err := conf.Cache.Options()
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to configure environment provider with config %v: %w", conf, err)
+		}
+		background = background || cache.Background
+		environment.Configure(apiStore, status, logger, fetcher, cache, c.transforms(conf.Servers, conf.Rules), conf.Prefix)
 	}
 	if conf := c.Providers.File; conf.Enabled {
-		err := file.Configure(ctx, apiStore, conf.Path, conf.Prefix, conf.JSONExt, conf.URLExt)
+		cache, err := conf.Cache.Options()
+		if err == nil {
+			background = background || cache.Background
+			err = file.Configure(ctx, apiStore, status, logger, fetcher, cache, c.transforms(conf.Servers, conf.Rules), conf.Path, conf.Prefix, conf.JSONExt, conf.YAMLExt, conf.URLExt)
+		}
 		if err != nil {
 			return nil, nil, fmt.Errorf("unable to configure file provider with config %v: %w", conf, err)
 		}
 	}
 	if conf := c.Providers.Kubernetes; conf.Enabled {
-		err := kubernetes.Configure(ctx, apiStore)
+		cache, err := conf.Cache.Options()
+		var mode kube.InClusterMode
+		if err == nil {
+			mode, err = kube.ParseInClusterMode(conf.InCluster)
+		}
+		if err == nil {
+			background = background || cache.Background
+			opts := kubernetes.Options{
+				Client: kube.ClientOptions{InCluster: mode, Kubeconfig: conf.Kubeconfig, Context: conf.Context,
+					Watch: kube.WatchOptions{Resync: time.Duration(conf.Resync)}},
+				Namespaces:        conf.Namespaces,
+				NamespaceSelector: conf.NamespaceSelector,
+				ServiceSelector:   conf.ServiceSelector,
+				ConfigMapSelector: conf.ConfigMapSelector,
+				Annotations:       conf.Annotations,
+				KeyTemplate:       conf.KeyTemplate,
+				RouteKeyTemplate:  conf.RouteKeyTemplate,
+				ClusterDomain:     conf.ClusterDomain,
+				Ingresses:         conf.Ingresses,
+				HTTPRoutes:        conf.HTTPRoutes,
+			}
+			err = kubernetes.Configure(ctx, apiStore, status, logger, fetcher, cache, c.transforms(conf.Servers, conf.Rules), opts)
+		}
 		if err != nil {
 			return nil, nil, fmt.Errorf("unable to configure kubernetes provider with config %v: %w", conf, err)
 		}
 	}
+	if background {
+		go openapi.RefreshInBackground(ctx, cachedRepo, backgroundRefreshCheck, logger.With("component", "refresher"))
+	}
+	go openapi.WarmInBackground(ctx, cachedRepo, c.pollInterval(), logger.With("component", "warmer"))
 	return cachedRepo, apiStore, nil
 }
+
+// buildFetcher builds the fetcher of the remote specs, unset options fall back to the defaults
+func (c *Config) buildFetcher() (*openapi.Fetcher, error) {
+	conf, defaults := c.Fetcher, openapi.DefaultFetcherOptions
+	opts := openapi.FetcherOptions{
+		ConnectTimeout: conf.ConnectTimeout.Or(defaults.ConnectTimeout),
+		ReadTimeout:    conf.ReadTimeout.Or(defaults.ReadTimeout),
+		Retries:        intOr(conf.Retries, defaults.Retries),
+		Backoff:        conf.Backoff.Or(defaults.Backoff),
+		MaxBodySize:    defaults.MaxBodySize,
+	}
+	if conf.MaxBodySize != 0 {
+		opts.MaxBodySize = conf.MaxBodySize
+	}
+	opts.Auth = make(map[string]openapi.AuthProfile, len(conf.Auth))
+	for name, profile := range conf.Auth {
+		opts.Auth[name] = profile.build()
+	}
+	fetcher, err := openapi.NewFetcher(opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure fetcher: %w", err)
+	}
+	return fetcher, nil
+}
+
+// intOr returns the configured value or the fallback if it is not configured, unlike the durations an
+// explicit 0 is kept
+func intOr(value *int, fallback int) int {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
+
+const defaultMaxVersions = 20
+
+// buildHistory builds the configured history store, in memory by default
+func (c *Config) buildHistory() (openapi.HistoryStore, error) {
+	conf := c.History
+	maxVersions := conf.MaxVersions
+	if maxVersions <= 0 {
+		maxVersions = defaultMaxVersions
+	}
+	switch conf.Storage {
+	case "", "memory":
+		return openapi.NewMemoryHistory(maxVersions), nil
+	case "disk":
+		history, err := openapi.NewDiskHistory(conf.Path, maxVersions)
+		if err != nil {
+			return nil, fmt.Errorf("unable to configure disk history with config %v: %w", conf, err)
+		}
+		return history, nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown history storage %s", conf.Storage)
+}
+
+const (
+	defaultWebhookTimeout      = 10 * time.Second
+	defaultWebhookRetries      = 3
+	defaultWebhookBackoff      = time.Second
+	defaultWebhookPollInterval = time.Minute
+)
+
+// pollInterval is the interval the specs are fetched again at to notify the webhooks of their changed
+// content, 0 if no webhook is notified of changed specs
+func (c *Config) pollInterval() time.Duration {
+	for _, w := range c.Notifications.Webhooks {
+		changed := len(w.Events) == 0
+		for _, e := range w.Events {
+			changed = changed || openapi.EventType(e) == openapi.Changed
+		}
+		if changed {
+			return c.Notifications.PollInterval.Or(defaultWebhookPollInterval)
+		}
+	}
+	return 0
+}
+
+// startNotifier starts notifying the configured webhooks of the changes of the repo
+func (c *Config) startNotifier(ctx context.Context, repo openapi.Repository, logger logging.Logger) error {
+	conf := c.Notifications
+	if len(conf.Webhooks) == 0 {
+		return nil
+	}
+	webhooks := make([]notify.Webhook, 0, len(conf.Webhooks))
+	for _, w := range conf.Webhooks {
+		if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid webhook url %s", w.URL)
+		}
+		secret := w.Secret
+		if w.SecretEnv != "" {
+			secret = os.Getenv(w.SecretEnv)
+		}
+		events := make([]openapi.EventType, 0, len(w.Events))
+		for _, e := range w.Events {
+			switch eventType := openapi.EventType(e); eventType {
+			case openapi.Added, openapi.Removed, openapi.Changed:
+				events = append(events, eventType)
+			default:
+				return fmt.Errorf("unknown webhook event %s of %s", e, w.URL)
+			}
+		}
+		webhooks = append(webhooks, notify.Webhook{URL: w.URL, Secret: secret, Events: events, Headers: w.Headers})
+	}
+	opts := notify.Options{
+		Timeout: conf.Timeout.Or(defaultWebhookTimeout),
+		Retries: intOr(conf.Retries, defaultWebhookRetries),
+		Backoff: conf.Backoff.Or(defaultWebhookBackoff),
+		Logger:  logger.With("component", "notifier"),
+	}
+	if err := notify.New(repo, webhooks, opts).Run(ctx); err != nil {
+		return fmt.Errorf("unable to start notifier: %w", err)
+	}
+	return nil
+}
+
+// ServeOptions builds the options of the server, requiring authentication if an authenticator is configured,
+// serving the try-it-out proxy if it is enabled and linting with the configured rule severities
+func (c *Config) ServeOptions(ctx context.Context, logger logging.Logger) ([]openapi.ServeOption, error) {
+	var opts []openapi.ServeOption
+	if c.Proxy.Enabled {
+		opts = append(opts, openapi.WithProxy(c.proxyOptions()))
+	}
+	if len(c.Lint.Rules) > 0 {
+		linter, err := c.buildLinter()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, openapi.WithLinter(linter))
+	}
+	auth, err := c.Auth.serveOption(ctx, logger)
+	if err != nil {
+		return nil, err
+	}
+	if auth != nil {
+		opts = append(opts, auth)
+	}
+	return opts, nil
+}
+
+// proxyOptions are the options of the try-it-out proxy, unset options fall back to the defaults
+func (c *Config) proxyOptions() openapi.ProxyOptions {
+	proxy := c.Proxy
+	return openapi.ProxyOptions{
+		Hosts:          proxy.Hosts,
+		Methods:        proxy.Methods,
+		StripHeaders:   proxy.StripHeaders,
+		ConnectTimeout: time.Duration(proxy.ConnectTimeout),
+		Timeout:        time.Duration(proxy.Timeout),
+		MaxBodySize:    proxy.MaxBodySize,
+		RewriteServers: proxy.RewriteServers,
+	}
+}
+
+// buildLinter builds the linter of the default rules with the configured rule severities
+func (c *Config) buildLinter() (*openapi.Linter, error) {
+	severities := make(map[string]openapi.Severity, len(c.Lint.Rules))
+	for rule, name := range c.Lint.Rules {
+		severity, err := openapi.ParseSeverity(name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to configure lint rule %s: %w", rule, err)
+		}
+		severities[rule] = severity
+	}
+	return openapi.NewLinter(openapi.LintOptions{Severities: severities}, openapi.DefaultLintRules()...), nil
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration configured as a string, ie. "500ms", "5s" or "1m30s"
+type Duration time.Duration
+
+// UnmarshalJSON parses the duration from a json string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration %s must be a string like \"5s\": %w", b, err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("unable to parse duration %s: %w", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON formats the duration as a json string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Or returns the duration or the fallback if it is not configured
+func (d Duration) Or(fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,191 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level of a log line
+type Level int
+
+// Levels in increasing severity
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = map[Level]string{DebugLevel: "debug", InfoLevel: "info", WarnLevel: "warn", ErrorLevel: "error"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel parses debug, info, warn or error, info if empty
+func ParseLevel(level string) (Level, error) {
+	if level == "" {
+		return InfoLevel, nil
+	}
+	for l, name := range levelNames {
+		if strings.EqualFold(level, name) {
+			return l, nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("logging: unknown level %s", level)
+}
+
+// Format of the log lines
+type Format string
+
+// Formats of the log lines
+const (
+	JSON   Format = "json"
+	Logfmt Format = "logfmt"
+)
+
+// ParseFormat parses json or logfmt, logfmt if empty
+func ParseFormat(format string) (Format, error) {
+	switch Format(strings.ToLower(format)) {
+	case "", Logfmt:
+		return Logfmt, nil
+	case JSON:
+		return JSON, nil
+	}
+	return "", fmt.Errorf("logging: unknown format %s", format)
+}
+
+// Logger is a leveled structured logger. Every line has the time, level and message followed by the
+// fields of the logger and the alternating keys and values of the call
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+	// With returns a logger that adds the keys and values to every line
+	With(keyvals ...interface{}) Logger
+}
+
+type output struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format Format
+	level  Level
+}
+
+type logger struct {
+	out    *output
+	fields []interface{}
+}
+
+// New creates a logger writing lines of the format to w, lines below the level are discarded
+func New(w io.Writer, format Format, level Level) Logger {
+	return &logger{out: &output{w: w, format: format, level: level}}
+}
+
+var defaultLogger = New(os.Stderr, Logfmt, InfoLevel)
+
+// Default is the logger used when none is configured, info and above in logfmt to stderr
+func Default() Logger {
+	return defaultLogger
+}
+
+// Nop returns a logger that discards all lines
+func Nop() Logger {
+	return New(ioutil.Discard, Logfmt, ErrorLevel+1)
+}
+
+func (l *logger) Debug(msg string, keyvals ...interface{}) { l.log(DebugLevel, msg, keyvals) }
+func (l *logger) Info(msg string, keyvals ...interface{})  { l.log(InfoLevel, msg, keyvals) }
+func (l *logger) Warn(msg string, keyvals ...interface{})  { l.log(WarnLevel, msg, keyvals) }
+func (l *logger) Error(msg string, keyvals ...interface{}) { l.log(ErrorLevel, msg, keyvals) }
+
+func (l *logger) With(keyvals ...interface{}) Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(append(fields, l.fields...), keyvals...)
+	return &logger{out: l.out, fields: fields}
+}
+
+func (l *logger) log(level Level, msg string, keyvals []interface{}) {
+	if level < l.out.level {
+		return
+	}
+	all := make([]interface{}, 0, 6+len(l.fields)+len(keyvals))
+	all = append(all, "ts", time.Now().UTC().Format(time.RFC3339Nano), "level", level.String(), "msg", msg)
+	all = append(append(all, l.fields...), keyvals...)
+	if len(all)%2 != 0 {
+		all = append(all, "(MISSING)")
+	}
+	var buf bytes.Buffer
+	switch l.out.format {
+	case JSON:
+		writeJSON(&buf, all)
+	default:
+		writeLogfmt(&buf, all)
+	}
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	_, _ = l.out.w.Write(buf.Bytes())
+}
+
+func writeJSON(buf *bytes.Buffer, keyvals []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(keyvals); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(fmt.Sprint(keyvals[i]))
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(valueOf(keyvals[i+1]))
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(keyvals[i+1]))
+		}
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+}
+
+func writeLogfmt(buf *bytes.Buffer, keyvals []interface{}) {
+	for i := 0; i < len(keyvals); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(strings.Map(func(r rune) rune {
+			if r <= ' ' || r == '=' || r == '"' {
+				return '_'
+			}
+			return r
+		}, fmt.Sprint(keyvals[i])))
+		buf.WriteByte('=')
+		value := fmt.Sprint(valueOf(keyvals[i+1]))
+		if value == "" || strings.ContainsAny(value, " =\"\\\t\n\r") {
+			value = strconv.Quote(value)
+		}
+		buf.WriteString(value)
+	}
+	buf.WriteByte('\n')
+}
+
+// valueOf formats errors, durations and stringers as strings
+func valueOf(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case error:
+		return val.Error()
+	case time.Duration:
+		return val.String()
+	case fmt.Stringer:
+		return val.String()
+	}
+	return v
+}
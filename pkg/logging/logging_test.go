@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogfmtWithFieldsAndLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, Logfmt, InfoLevel).With("provider", "file")
+	logger.Debug("discarded")
+	logger.Info("spec stored", "key", "a b", "err", errors.New("boom"), "n", 3)
+	line := buf.String()
+	if strings.Count(line, "\n") != 1 {
+		t.Fatalf("expected only the info line, got %q", line)
+	}
+	for _, part := range []string{"level=info", `msg="spec stored"`, "provider=file", `key="a b"`, "err=boom", "n=3"} {
+		if !strings.Contains(line, part) {
+			t.Errorf("expected %s in %q", part, line)
+		}
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, JSON, DebugLevel).With("source", "env").Warn("fetch failed", "url", "http://a", "odd")
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected a json line, got %q: %v", buf.String(), err)
+	}
+	if line["level"] != "warn" || line["msg"] != "fetch failed" || line["source"] != "env" || line["url"] != "http://a" || line["odd"] != "(MISSING)" {
+		t.Errorf("unexpected line %v", line)
+	}
+}
+
+func TestParse(t *testing.T) {
+	if l, err := ParseLevel("WARN"); err != nil || l != WarnLevel {
+		t.Errorf("expected warn, got %v %v", l, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected unknown level to fail")
+	}
+	if f, err := ParseFormat(""); err != nil || f != Logfmt {
+		t.Errorf("expected logfmt by default, got %v %v", f, err)
+	}
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "docsprox"
+
+var (
+	// CacheRequests counts the requests to cached specs by result, hit or miss
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "spec_cache_requests_total",
+		Help:      "Requests to cached specs by result (hit or miss).",
+	}, []string{"result"})
+	// UpstreamResponses counts the responses of upstream spec servers by status code
+	UpstreamResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_responses_total",
+		Help:      "Responses of upstream spec servers by status code, error if the request failed.",
+	}, []string{"code"})
+	// StoreOperations counts the mutations of the spec store by operation and source
+	StoreOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_operations_total",
+		Help:      "Mutations of the spec store by operation and source.",
+	}, []string{"operation", "source"})
+	// WatcherEvents counts the events seen by the provider watchers by provider and event type
+	WatcherEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "watcher_events_total",
+		Help:      "Events seen by the provider watchers by provider and event type.",
+	}, []string{"provider", "type"})
+	// HTTPRequestDuration observes the served http requests by handler, method and status code
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of the served http requests by handler, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler", "method", "code"})
+)
+
+// NewRegistry creates a registry of the docs-prox, go runtime and process metrics and the
+// additional collectors
+func NewRegistry(collectors ...prometheus.Collector) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		CacheRequests, UpstreamResponses, StoreOperations, WatcherEvents, HTTPRequestDuration,
+		prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	registry.MustRegister(collectors...)
+	return registry
+}
+
+// Handler serves the metrics of the registry in the prometheus exposition format
+func Handler(registry *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// InstrumentHandler observes the duration of the requests served by the handler
+func InstrumentHandler(name string, handler http.Handler) http.Handler {
+	return promhttp.InstrumentHandlerDuration(HTTPRequestDuration.MustCurryWith(prometheus.Labels{"handler": name}), handler)
+}
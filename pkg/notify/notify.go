@@ -0,0 +1,281 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+	"github.com/SimonSchneider/docs-prox/pkg/openapi"
+)
+
+// Headers set on every webhook request
+const (
+	EventHeader     = "X-Docs-Prox-Event"
+	DeliveryHeader  = "X-Docs-Prox-Delivery"
+	SignatureHeader = "X-Docs-Prox-Signature"
+)
+
+// Webhook is an endpoint that is notified of the changes of the repository
+type Webhook struct {
+	URL string
+	// Secret signs the payload with HMAC-SHA256 in the signature header if set
+	Secret string
+	// Events the webhook is notified of, all events if empty
+	Events  []openapi.EventType
+	Headers map[string]string
+}
+
+// Options of the delivery to the webhooks
+type Options struct {
+	// Timeout of a single delivery attempt
+	Timeout time.Duration
+	// Retries of a failed delivery
+	Retries int
+	// Backoff before the first retry, doubled for every following retry
+	Backoff time.Duration
+	// Logger of the delivery failures, the default logger if nil
+	Logger logging.Logger
+}
+
+// Payload is the json body posted to the webhooks
+type Payload struct {
+	ID        string            `json:"id"`
+	Type      openapi.EventType `json:"type"`
+	Key       string            `json:"key"`
+	Name      string            `json:"name"`
+	Source    string            `json:"source"`
+	Hash      string            `json:"hash,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+type hook struct {
+	Webhook
+	events map[openapi.EventType]bool
+	// queue of the payloads to deliver, in order
+	queue *queue
+}
+
+func (h *hook) accepts(eventType openapi.EventType) bool {
+	return len(h.events) == 0 || h.events[eventType]
+}
+
+// Notifier posts the added, removed and changed specs of a repository to webhooks
+type Notifier struct {
+	repo   openapi.Repository
+	hooks  []*hook
+	client *http.Client
+	opts   Options
+	logger logging.Logger
+}
+
+// New creates a notifier of the webhooks, it is started with Run
+func New(repo openapi.Repository, webhooks []Webhook, opts Options) *Notifier {
+	hooks := make([]*hook, 0, len(webhooks))
+	for _, w := range webhooks {
+		events := make(map[openapi.EventType]bool, len(w.Events))
+		for _, e := range w.Events {
+			events[e] = true
+		}
+		hooks = append(hooks, &hook{Webhook: w, events: events, queue: newQueue()})
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+	return &Notifier{repo: repo, hooks: hooks, client: &http.Client{Timeout: opts.Timeout}, opts: opts, logger: logger}
+}
+
+// Run subscribes to the changes of the repository and delivers them until the context is done. Changed
+// events are published once the repository observes the new content of a spec, see openapi.WarmInBackground
+func (n *Notifier) Run(ctx context.Context) error {
+	watchable, ok := n.repo.(openapi.Watchable)
+	if !ok {
+		return fmt.Errorf("notify: repository does not publish its changes")
+	}
+	for _, h := range n.hooks {
+		go n.deliverAll(ctx, h)
+	}
+	events, unsubscribe := watchable.Subscribe()
+	go func() {
+		for n.dispatchAll(ctx, events) {
+			unsubscribe()
+			events, unsubscribe = watchable.Subscribe()
+		}
+		unsubscribe()
+	}()
+	return nil
+}
+
+// dispatchAll queues the events for the hooks until the context is done or the subscription is closed, true
+// if it was closed after falling behind the changes and has to be renewed
+func (n *Notifier) dispatchAll(ctx context.Context, events <-chan openapi.Event) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			switch event.Type {
+			case openapi.Replaced:
+			case openapi.Resync:
+				n.logger.Warn("notifier fell behind the changes of the repository, missed changes are not notified")
+				return true
+			default:
+				n.enqueue(payloadOf(event))
+			}
+		}
+	}
+}
+
+// queue is an unbounded FIFO queue of the payloads of a hook
+type queue struct {
+	mu       sync.Mutex
+	payloads []Payload
+	wake     chan struct{}
+}
+
+func newQueue() *queue {
+	return &queue{wake: make(chan struct{}, 1)}
+}
+
+func (q *queue) push(payload Payload) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.payloads = append(q.payloads, payload)
+	q.signal()
+}
+
+// pop blocks until a payload is queued, false if the context is done first
+func (q *queue) pop(ctx context.Context) (Payload, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.payloads) > 0 {
+			next := q.payloads[0]
+			q.payloads = q.payloads[1:]
+			if len(q.payloads) > 0 {
+				q.signal()
+			}
+			q.mu.Unlock()
+			return next, true
+		}
+		q.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return Payload{}, false
+		case <-q.wake:
+		}
+	}
+}
+
+func (q *queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (n *Notifier) enqueue(payload Payload) {
+	for _, h := range n.hooks {
+		if h.accepts(payload.Type) {
+			h.queue.push(payload)
+		}
+	}
+}
+
+func (n *Notifier) deliverAll(ctx context.Context, h *hook) {
+	for {
+		payload, ok := h.queue.pop(ctx)
+		if !ok {
+			return
+		}
+		if err := n.deliver(ctx, h, payload); err != nil {
+			n.logger.Error("unable to deliver notification", "event", payload.Type, "key", payload.Key, "url", h.URL, "err", err)
+		}
+	}
+}
+
+// deliver the payload to the hook, retrying with an exponential backoff on errors, 5xx and 429 responses
+func (n *Notifier) deliver(ctx context.Context, h *hook, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("notify: unable to encode payload: %w", err)
+	}
+	backoff := n.opts.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(ctx, h, payload, body)
+		if err == nil || !retry || attempt >= n.opts.Retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, h *hook, payload Payload, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("notify: invalid webhook request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(payload.Type))
+	req.Header.Set(DeliveryHeader, payload.ID)
+	if h.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(h.Secret, body))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("notify: webhook request failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("notify: webhook responded with %s", resp.Status)
+}
+
+// Sign returns the signature of the body, the hex encoded HMAC-SHA256 of the secret prefixed with sha256=
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func payloadOf(event openapi.Event) Payload {
+	return Payload{
+		ID:        deliveryID(),
+		Type:      event.Type,
+		Key:       event.Key,
+		Name:      event.Name,
+		Source:    event.Source,
+		Hash:      event.Hash,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+func deliveryID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,210 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+	"github.com/SimonSchneider/docs-prox/pkg/openapi"
+)
+
+type testSpec string
+
+func (t testSpec) Get() ([]byte, error) {
+	return []byte(t), nil
+}
+
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	payloads chan Payload
+	attempts int
+}
+
+func (r *receiver) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts++
+	if r.failures > 0 {
+		r.failures--
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if req.Header.Get(SignatureHeader) != Sign("secret", body) {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil || req.Header.Get(EventHeader) != string(payload.Type) {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.payloads <- payload
+}
+
+func (r *receiver) await(t *testing.T, eventType openapi.EventType, key string) Payload {
+	select {
+	case p := <-r.payloads:
+		if p.Type != eventType || p.Key != key {
+			t.Fatalf("expected %s notification of %s, got %v", eventType, key, p)
+		}
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s notification of %s", eventType, key)
+	}
+	return Payload{}
+}
+
+func TestNotifiesSignedChangesWithRetries(t *testing.T) {
+	recv := &receiver{failures: 2, payloads: make(chan Payload, 10)}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := openapi.NewCachedRepository(openapi.WithHistory(openapi.NewMemoryHistory(5)))
+	n := New(repo, []Webhook{{URL: server.URL, Secret: "secret"}}, Options{Timeout: time.Second, Retries: 2, Backoff: time.Millisecond})
+	if err := n.Run(ctx); err != nil {
+		t.Fatalf("unable to run notifier: %v", err)
+	}
+	go openapi.WarmInBackground(ctx, repo, 0, logging.Nop())
+	if err := repo.Put("source", "a", testSpec("v1")); err != nil {
+		t.Fatalf("unable to put: %v", err)
+	}
+	recv.await(t, openapi.Added, "a")
+	spec, err := repo.Spec("a")
+	if err == nil {
+		_, err = spec.Get()
+	}
+	if err != nil {
+		t.Fatalf("unable to get: %v", err)
+	}
+	if err := repo.Put("source", "a", testSpec("v2")); err != nil {
+		t.Fatalf("unable to put: %v", err)
+	}
+	changed := recv.await(t, openapi.Changed, "a")
+	if changed.Hash != openapi.ContentHash([]byte("v2")) {
+		t.Errorf("expected hash of the new content, got %s", changed.Hash)
+	}
+	if err := repo.Remove("source", "a"); err != nil {
+		t.Fatalf("unable to remove: %v", err)
+	}
+	recv.await(t, openapi.Removed, "a")
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+	if recv.attempts != 5 {
+		t.Errorf("expected 2 failed and 3 successful attempts, got %d", recv.attempts)
+	}
+}
+
+func TestFiltersEventsAndGivesUpAfterRetries(t *testing.T) {
+	recv := &receiver{failures: 100, payloads: make(chan Payload, 10)}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+	repo := openapi.NewCachedRepository()
+	n := New(repo, []Webhook{{URL: server.URL, Events: []openapi.EventType{openapi.Removed}}}, Options{Retries: 1})
+	if err := n.deliver(context.Background(), n.hooks[0], Payload{Type: openapi.Removed, Key: "a"}); err == nil {
+		t.Error("expected delivery to fail")
+	}
+	if recv.attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", recv.attempts)
+	}
+	if n.hooks[0].accepts(openapi.Added) || !n.hooks[0].accepts(openapi.Removed) {
+		t.Error("expected only removed events to be accepted")
+	}
+}
+
+func TestNotifiesBurstsOfWarmedSpecsWithoutHistory(t *testing.T) {
+	const keys = 200
+	recv := &receiver{payloads: make(chan Payload, 2*keys)}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := openapi.NewCachedRepository()
+	n := New(repo, []Webhook{{URL: server.URL, Secret: "secret"}}, Options{Timeout: time.Second})
+	if err := n.Run(ctx); err != nil {
+		t.Fatalf("unable to run notifier: %v", err)
+	}
+	go openapi.WarmInBackground(ctx, repo, 0, logging.Nop())
+	specs := make(map[string]openapi.Spec, keys)
+	for i := 0; i < keys; i++ {
+		specs[fmt.Sprintf("key-%03d", i)] = testSpec("v1")
+	}
+	repo.ReplaceAllOf("source", specs)
+	added := make(map[string]bool)
+	for len(added) < keys {
+		select {
+		case p := <-recv.payloads:
+			if p.Type != openapi.Added {
+				t.Fatalf("expected only added notifications, got %v", p)
+			}
+			added[p.Key] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %d of %d added notifications", len(added), keys)
+		}
+	}
+	spec, err := repo.Spec("key-000")
+	if err == nil {
+		_, err = spec.Get()
+	}
+	if err != nil {
+		t.Fatalf("unable to get: %v", err)
+	}
+	if err := repo.Put("source", "key-000", testSpec("v2")); err != nil {
+		t.Fatalf("unable to put: %v", err)
+	}
+	changed := recv.await(t, openapi.Changed, "key-000")
+	if changed.Hash != openapi.ContentHash([]byte("v2")) {
+		t.Errorf("expected hash of the new content, got %s", changed.Hash)
+	}
+}
+
+type upstreamSpec struct {
+	mu      sync.Mutex
+	content string
+	fetched chan struct{}
+}
+
+func (u *upstreamSpec) Get() ([]byte, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	select {
+	case u.fetched <- struct{}{}:
+	default:
+	}
+	return []byte(u.content), nil
+}
+
+func TestNotifiesChangesOfRedeployedUpstreamsWhilePolling(t *testing.T) {
+	recv := &receiver{payloads: make(chan Payload, 10)}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := openapi.NewCachedRepository()
+	n := New(repo, []Webhook{{URL: server.URL, Secret: "secret", Events: []openapi.EventType{openapi.Changed}}}, Options{Timeout: time.Second})
+	if err := n.Run(ctx); err != nil {
+		t.Fatalf("unable to run notifier: %v", err)
+	}
+	upstream := &upstreamSpec{content: "v1", fetched: make(chan struct{}, 1)}
+	if err := repo.Put("source", "a", upstream); err != nil {
+		t.Fatalf("unable to put: %v", err)
+	}
+	go openapi.WarmInBackground(ctx, repo, 10*time.Millisecond, logging.Nop())
+	<-upstream.fetched
+	upstream.mu.Lock()
+	upstream.content = "v2"
+	upstream.mu.Unlock()
+	changed := recv.await(t, openapi.Changed, "a")
+	if changed.Hash != openapi.ContentHash([]byte("v2")) {
+		t.Errorf("expected hash of the redeployed content, got %s", changed.Hash)
+	}
+}
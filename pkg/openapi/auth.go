@@ -0,0 +1,181 @@
+package openapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthProfile is a named set of credentials sent to the upstreams referencing it
+type AuthProfile struct {
+	// Headers set on every request
+	Headers map[string]string
+	// BearerToken is sent as the Authorization header
+	BearerToken string
+	// BearerTokenFile is read on every request so that mounted secrets can be rotated
+	BearerTokenFile string
+	// Username and Password of basic auth
+	Username, Password string
+	// OAuth2 client-credentials to request a bearer token with
+	OAuth2 *OAuth2ClientCredentials
+	// TLS client certificate and CA bundle of the upstreams
+	TLS *TLSOptions
+}
+
+// OAuth2ClientCredentials configure the OAuth2 client-credentials grant
+type OAuth2ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// TLSOptions configure the TLS connections to the upstreams
+type TLSOptions struct {
+	// CAFile is a PEM bundle of the CAs trusted in addition to the system CAs
+	CAFile string
+	// CertFile and KeyFile are the PEM encoded client certificate and key
+	CertFile, KeyFile  string
+	InsecureSkipVerify bool
+}
+
+// UnknownAuthProfileError is returned when a spec references an auth profile that is not configured
+type UnknownAuthProfileError struct {
+	Profile string
+}
+
+func (e *UnknownAuthProfileError) Error() string {
+	return fmt.Sprintf("unknown auth profile %s", e.Profile)
+}
+
+// upstreamAuth authenticates the requests to the upstreams of a profile
+type upstreamAuth struct {
+	profile AuthProfile
+	client  *http.Client
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newUpstreamAuth(profile AuthProfile, opts FetcherOptions) (*upstreamAuth, error) {
+	tlsConfig, err := tlsConfigOf(profile.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return &upstreamAuth{profile: profile, client: newClient(opts, tlsConfig)}, nil
+}
+
+func tlsConfigOf(opts *TLSOptions) (*tls.Config, error) {
+	if opts == nil {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+	if opts.CAFile != "" {
+		pem, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle %s: %w", opts.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate %s: %w", opts.CertFile, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// authenticate sets the credentials of the profile on the request
+func (a *upstreamAuth) authenticate(req *http.Request) error {
+	for k, v := range a.profile.Headers {
+		req.Header.Set(k, v)
+	}
+	switch p := a.profile; {
+	case p.OAuth2 != nil:
+		token, err := a.oauth2Token()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case p.BearerTokenFile != "":
+		token, err := ioutil.ReadFile(p.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("unable to read bearer token file %s: %w", p.BearerTokenFile, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	case p.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+p.BearerToken)
+	case p.Username != "":
+		req.SetBasicAuth(p.Username, p.Password)
+	}
+	return nil
+}
+
+// rejected discards the cached OAuth2 token after the upstream rejected it
+func (a *upstreamAuth) rejected() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = ""
+}
+
+// tokenExpiryMargin is subtracted from the lifetime of OAuth2 tokens so they are renewed before expiring
+const tokenExpiryMargin = 30 * time.Second
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// oauth2Token returns the cached token or requests a new one with the client-credentials grant
+func (a *upstreamAuth) oauth2Token() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Now().Before(a.expires) {
+		return a.token, nil
+	}
+	conf := a.profile.OAuth2
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(conf.Scopes) > 0 {
+		form.Set("scope", strings.Join(conf.Scopes, " "))
+	}
+	req, err := http.NewRequest(http.MethodPost, conf.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("invalid token url %s: %w", conf.TokenURL, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(conf.ClientID), url.QueryEscape(conf.ClientSecret))
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to request token from %s: %w", conf.TokenURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint %s responded with %s", conf.TokenURL, resp.Status)
+	}
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("invalid token response from %s", conf.TokenURL)
+	}
+	a.token = token.AccessToken
+	a.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - tokenExpiryMargin)
+	if token.ExpiresIn == 0 {
+		a.expires = time.Now().Add(time.Hour)
+	}
+	return a.token, nil
+}
@@ -0,0 +1,139 @@
+package openapi
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type authUpstream struct {
+	mu     sync.Mutex
+	tokens int
+	valid  string
+	seen   []string
+}
+
+func (u *authUpstream) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if r.URL.Path == "/token" {
+		if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		u.tokens++
+		u.valid = "token-" + string(rune('0'+u.tokens))
+		_ = json.NewEncoder(rw).Encode(map[string]interface{}{"access_token": u.valid, "expires_in": 3600})
+		return
+	}
+	user, pass, _ := r.BasicAuth()
+	u.seen = append(u.seen, r.Header.Get("Authorization")+"|"+user+":"+pass+"|"+r.Header.Get("X-Team"))
+	if auth := r.Header.Get("Authorization"); u.valid != "" && auth != "Bearer "+u.valid {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	_, _ = rw.Write([]byte("spec"))
+}
+
+func (u *authUpstream) lastSeen() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.seen[len(u.seen)-1]
+}
+
+func TestFetcherAuthenticatesWithProfiles(t *testing.T) {
+	u := &authUpstream{}
+	server := httptest.NewServer(u)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "auth")
+	check("tempdir", t, err)
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	check("write token", t, ioutil.WriteFile(tokenFile, []byte("first\n"), 0600))
+	f, err := NewFetcher(FetcherOptions{Auth: map[string]AuthProfile{
+		"file":  {BearerTokenFile: tokenFile, Headers: map[string]string{"X-Team": "docs"}},
+		"basic": {Username: "user", Password: "pass"},
+	}})
+	check("create fetcher", t, err)
+	fetch := func(profile, expected string) {
+		t.Helper()
+		spec, err := f.SpecWithAuth(server.URL, profile)
+		check("spec", t, err)
+		_, err = spec.Get()
+		check("get", t, err)
+		if seen := u.lastSeen(); seen != expected {
+			t.Errorf("expected credentials %s, got %s", expected, seen)
+		}
+	}
+	fetch("file", "Bearer first|:|docs")
+	check("rotate token", t, ioutil.WriteFile(tokenFile, []byte("second"), 0600))
+	fetch("file", "Bearer second|:|docs")
+	fetch("basic", "Basic dXNlcjpwYXNz|user:pass|")
+	fetch("", "|:|")
+	var unknown *UnknownAuthProfileError
+	if _, err := f.SpecWithAuth(server.URL, "missing"); !errors.As(err, &unknown) {
+		t.Errorf("expected unknown profile error, got %v", err)
+	}
+}
+
+func TestFetcherRenewsRejectedOAuth2Tokens(t *testing.T) {
+	u := &authUpstream{}
+	server := httptest.NewServer(u)
+	defer server.Close()
+	f, err := NewFetcher(FetcherOptions{Auth: map[string]AuthProfile{
+		"oauth": {OAuth2: &OAuth2ClientCredentials{TokenURL: server.URL + "/token", ClientID: "client", ClientSecret: "secret"}},
+	}})
+	check("create fetcher", t, err)
+	spec, err := f.SpecWithAuth(server.URL, "oauth")
+	check("spec", t, err)
+	for i := 0; i < 2; i++ {
+		_, err := spec.Get()
+		check("get", t, err)
+	}
+	u.mu.Lock()
+	u.valid = "revoked"
+	u.mu.Unlock()
+	if _, err := spec.Get(); err == nil {
+		t.Error("expected the revoked token to be rejected")
+	}
+	_, err = spec.Get()
+	check("get with renewed token", t, err)
+	if u.tokens != 2 {
+		t.Errorf("expected the token to be cached and renewed once, got %d tokens", u.tokens)
+	}
+}
+
+func TestFetcherTrustsCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, _ = rw.Write([]byte("spec"))
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "auth")
+	check("tempdir", t, err)
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	check("write ca", t, ioutil.WriteFile(caFile, ca, 0600))
+	f, err := NewFetcher(FetcherOptions{ConnectTimeout: time.Second, ReadTimeout: time.Second, Auth: map[string]AuthProfile{
+		"internal": {TLS: &TLSOptions{CAFile: caFile}},
+	}})
+	check("create fetcher", t, err)
+	if _, err := f.Spec(server.URL).Get(); err == nil {
+		t.Error("expected the self-signed certificate to be untrusted without the profile")
+	}
+	spec, err := f.SpecWithAuth(server.URL, "internal")
+	check("spec", t, err)
+	_, err = spec.Get()
+	check("get with CA bundle", t, err)
+	if _, err := NewFetcher(FetcherOptions{Auth: map[string]AuthProfile{"broken": {TLS: &TLSOptions{CAFile: os.DevNull}}}}); err == nil {
+		t.Error("expected an empty CA bundle to be rejected")
+	}
+}
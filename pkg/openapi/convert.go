@@ -0,0 +1,615 @@
+package openapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OpenAPIVersion is the OpenAPI 3 version that specs are converted to
+type OpenAPIVersion string
+
+// Supported target versions of the conversion
+const (
+	OpenAPI30 OpenAPIVersion = "3.0.3"
+	OpenAPI31 OpenAPIVersion = "3.1.0"
+)
+
+// ParseOpenAPIVersion parses the requested OpenAPI 3 version, ie. 3, 3.0 or 3.1
+func ParseOpenAPIVersion(version string) (OpenAPIVersion, error) {
+	switch version {
+	case "3", "3.0", string(OpenAPI30):
+		return OpenAPI30, nil
+	case "3.1", string(OpenAPI31):
+		return OpenAPI31, nil
+	}
+	return "", fmt.Errorf("convert: unsupported openapi version %s", version)
+}
+
+// ConvertedToOpenAPI3 returns a spec that serves the delegate converted to the given OpenAPI 3 version,
+// Swagger 2.0 specs are converted and OpenAPI 3.0 specs are upgraded when 3.1 is requested. Specs stored
+// in a repository hold their conversions, they are only converted again when their content changes
+func ConvertedToOpenAPI3(delegate Spec, version OpenAPIVersion) Spec {
+	if c, ok := delegate.(converter); ok {
+		return c.ConvertedTo(version)
+	}
+	return convertedToOpenAPI3(delegate, version)
+}
+
+type converter interface {
+	ConvertedTo(version OpenAPIVersion) Spec
+}
+
+func convertedToOpenAPI3(delegate Spec, version OpenAPIVersion) Spec {
+	return derived(delegate, func(from *Document) map[string]interface{} {
+		raw := from.Raw
+		if from.IsSwagger2() {
+			raw = swagger2ToOpenAPI30(raw)
+		}
+		if version == OpenAPI31 && strings.HasPrefix(stringAt(raw, "openapi"), "3.0") {
+			raw = openAPI30To31(raw)
+		}
+		if stringAt(raw, "openapi") == from.SpecVersion {
+			return nil
+		}
+		return raw
+	})
+}
+
+var swagger2Refs = map[string]string{
+	"#/definitions/": "#/components/schemas/",
+	"#/parameters/":  "#/components/parameters/",
+	"#/responses/":   "#/components/responses/",
+}
+
+// swagger2ToOpenAPI30 converts a raw swagger 2.0 document to a new raw OpenAPI 3.0 document
+func swagger2ToOpenAPI30(swagger map[string]interface{}) map[string]interface{} {
+	c := &swagger2Converter{
+		swagger:    swagger,
+		parameters: objectAt(swagger, "parameters"),
+		consumes:   stringsOf(arrayAt(swagger, "consumes"), "application/json"),
+		produces:   stringsOf(arrayAt(swagger, "produces"), "application/json"),
+	}
+	oas := map[string]interface{}{"openapi": string(OpenAPI30)}
+	for k, v := range swagger {
+		switch k {
+		case "swagger", "host", "basePath", "schemes", "consumes", "produces", "paths", "definitions",
+			"parameters", "responses", "securityDefinitions":
+		default:
+			oas[k] = convertSwagger2Value(v)
+		}
+	}
+	if servers := swagger2Servers(swagger); len(servers) > 0 {
+		list := make([]interface{}, 0, len(servers))
+		for _, s := range servers {
+			list = append(list, map[string]interface{}{"url": s})
+		}
+		oas["servers"] = list
+	}
+	oas["paths"] = c.paths()
+	if components := c.components(); len(components) > 0 {
+		oas["components"] = components
+	}
+	return oas
+}
+
+type swagger2Converter struct {
+	swagger            map[string]interface{}
+	parameters         map[string]interface{}
+	consumes, produces []string
+}
+
+func (c *swagger2Converter) components() map[string]interface{} {
+	components := make(map[string]interface{})
+	if definitions := objectAt(c.swagger, "definitions"); len(definitions) > 0 {
+		components["schemas"] = convertSwagger2Value(definitions)
+	}
+	parameters := make(map[string]interface{})
+	requestBodies := make(map[string]interface{})
+	for name, p := range c.parameters {
+		param, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch stringAt(param, "in") {
+		case "body", "formData":
+			requestBodies[name] = c.requestBody([]interface{}{param}, c.consumes)
+		default:
+			parameters[name] = convertSwagger2Parameter(param)
+		}
+	}
+	if len(parameters) > 0 {
+		components["parameters"] = parameters
+	}
+	if len(requestBodies) > 0 {
+		components["requestBodies"] = requestBodies
+	}
+	responses := make(map[string]interface{})
+	for name, r := range objectAt(c.swagger, "responses") {
+		if resp, ok := r.(map[string]interface{}); ok {
+			responses[name] = c.response(resp, c.produces)
+		}
+	}
+	if len(responses) > 0 {
+		components["responses"] = responses
+	}
+	schemes := make(map[string]interface{})
+	for name, s := range objectAt(c.swagger, "securityDefinitions") {
+		if scheme, ok := s.(map[string]interface{}); ok {
+			schemes[name] = convertSwagger2SecurityScheme(scheme)
+		}
+	}
+	if len(schemes) > 0 {
+		components["securitySchemes"] = schemes
+	}
+	return components
+}
+
+func (c *swagger2Converter) paths() map[string]interface{} {
+	paths := make(map[string]interface{})
+	for path, i := range objectAt(c.swagger, "paths") {
+		item, ok := i.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		pathParams, pathBodyParams := c.splitParameters(arrayAt(item, "parameters"))
+		converted := make(map[string]interface{})
+		for k, v := range item {
+			switch {
+			case k == "parameters":
+				if len(pathParams) > 0 {
+					converted[k] = pathParams
+				}
+			case isMethod(k):
+				if op, ok := v.(map[string]interface{}); ok {
+					converted[k] = c.operation(op, pathBodyParams)
+				}
+			default:
+				converted[k] = convertSwagger2Value(v)
+			}
+		}
+		paths[path] = converted
+	}
+	return paths
+}
+
+func (c *swagger2Converter) operation(op map[string]interface{}, pathBodyParams []interface{}) map[string]interface{} {
+	consumes := stringsOf(arrayAt(op, "consumes"), c.consumes...)
+	produces := stringsOf(arrayAt(op, "produces"), c.produces...)
+	params, bodyParams := c.splitParameters(arrayAt(op, "parameters"))
+	if len(bodyParams) == 0 {
+		bodyParams = pathBodyParams
+	}
+	converted := make(map[string]interface{})
+	for k, v := range op {
+		switch k {
+		case "consumes", "produces", "schemes":
+		case "parameters":
+			if len(params) > 0 {
+				converted[k] = params
+			}
+		case "responses":
+			responses := make(map[string]interface{})
+			for code, r := range objectAt(op, "responses") {
+				if resp, ok := r.(map[string]interface{}); ok {
+					responses[code] = c.response(resp, produces)
+				}
+			}
+			converted[k] = responses
+		default:
+			converted[k] = convertSwagger2Value(v)
+		}
+	}
+	if len(bodyParams) > 0 {
+		converted["requestBody"] = c.requestBody(bodyParams, consumes)
+	}
+	return converted
+}
+
+// splitParameters converts the parameters and separates the body and formData parameters
+// which become the request body in OpenAPI 3
+func (c *swagger2Converter) splitParameters(params []interface{}) ([]interface{}, []interface{}) {
+	converted := make([]interface{}, 0, len(params))
+	body := make([]interface{}, 0)
+	for _, p := range params {
+		param, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		resolved := param
+		if ref := stringAt(param, "$ref"); strings.HasPrefix(ref, "#/parameters/") {
+			resolved, _ = c.parameters[strings.TrimPrefix(ref, "#/parameters/")].(map[string]interface{})
+		}
+		switch in := stringAt(resolved, "in"); {
+		case in == "body" || in == "formData":
+			body = append(body, param)
+		case resolved != nil && stringAt(param, "$ref") == "":
+			converted = append(converted, convertSwagger2Parameter(param))
+		default:
+			converted = append(converted, convertSwagger2Value(param))
+		}
+	}
+	return converted, body
+}
+
+func (c *swagger2Converter) requestBody(params []interface{}, consumes []string) map[string]interface{} {
+	if len(params) == 1 {
+		if ref := stringAt(params[0].(map[string]interface{}), "$ref"); ref != "" {
+			return map[string]interface{}{"$ref": "#/components/requestBodies/" + strings.TrimPrefix(ref, "#/parameters/")}
+		}
+	}
+	body := make(map[string]interface{})
+	content := make(map[string]interface{})
+	form := map[string]interface{}{"type": "object", "properties": make(map[string]interface{})}
+	required := make([]interface{}, 0)
+	hasFile := false
+	for _, p := range params {
+		param := p.(map[string]interface{})
+		if ref := stringAt(param, "$ref"); ref != "" {
+			param, _ = c.parameters[strings.TrimPrefix(ref, "#/parameters/")].(map[string]interface{})
+		}
+		if stringAt(param, "in") == "body" {
+			for _, ct := range consumes {
+				content[ct] = map[string]interface{}{"schema": convertSwagger2Value(param["schema"])}
+			}
+			copyKeys(body, param, "description", "required")
+			continue
+		}
+		name := stringAt(param, "name")
+		form["properties"].(map[string]interface{})[name] = swagger2ParameterSchema(param)
+		if stringAt(param, "type") == "file" {
+			hasFile = true
+		}
+		if r, _ := param["required"].(bool); r {
+			required = append(required, name)
+		}
+	}
+	if len(form["properties"].(map[string]interface{})) > 0 {
+		if len(required) > 0 {
+			form["required"] = required
+		}
+		formTypes := make([]string, 0)
+		for _, ct := range consumes {
+			if ct == "multipart/form-data" || ct == "application/x-www-form-urlencoded" {
+				formTypes = append(formTypes, ct)
+			}
+		}
+		if len(formTypes) == 0 {
+			formTypes = []string{"application/x-www-form-urlencoded"}
+			if hasFile {
+				formTypes = []string{"multipart/form-data"}
+			}
+		}
+		for _, ct := range formTypes {
+			content[ct] = map[string]interface{}{"schema": form}
+		}
+	}
+	body["content"] = content
+	return body
+}
+
+func (c *swagger2Converter) response(resp map[string]interface{}, produces []string) map[string]interface{} {
+	if ref := stringAt(resp, "$ref"); ref != "" {
+		return map[string]interface{}{"$ref": rewriteSwagger2Ref(ref)}
+	}
+	converted := map[string]interface{}{"description": stringAt(resp, "description")}
+	examples := objectAt(resp, "examples")
+	if schema, ok := resp["schema"]; ok {
+		content := make(map[string]interface{})
+		for _, ct := range produces {
+			media := map[string]interface{}{"schema": convertSwagger2Value(schema)}
+			if example, ok := examples[ct]; ok {
+				media["example"] = convertSwagger2Value(example)
+			}
+			content[ct] = media
+		}
+		converted["content"] = content
+	}
+	if headers := objectAt(resp, "headers"); len(headers) > 0 {
+		convertedHeaders := make(map[string]interface{})
+		for name, h := range headers {
+			if header, ok := h.(map[string]interface{}); ok {
+				convertedHeader := map[string]interface{}{"schema": swagger2ParameterSchema(header)}
+				copyKeys(convertedHeader, header, "description")
+				convertedHeaders[name] = convertedHeader
+			}
+		}
+		converted["headers"] = convertedHeaders
+	}
+	for k, v := range resp {
+		if strings.HasPrefix(k, "x-") {
+			converted[k] = convertSwagger2Value(v)
+		}
+	}
+	return converted
+}
+
+func convertSwagger2Parameter(param map[string]interface{}) map[string]interface{} {
+	converted := map[string]interface{}{"schema": swagger2ParameterSchema(param)}
+	copyKeys(converted, param, "name", "in", "description", "required", "allowEmptyValue")
+	for k, v := range param {
+		if strings.HasPrefix(k, "x-") {
+			converted[k] = convertSwagger2Value(v)
+		}
+	}
+	switch stringAt(param, "collectionFormat") {
+	case "csv":
+		if in := stringAt(param, "in"); in == "query" || in == "cookie" {
+			converted["style"], converted["explode"] = "form", false
+		} else {
+			converted["style"] = "simple"
+		}
+	case "multi":
+		converted["style"], converted["explode"] = "form", true
+	case "ssv":
+		converted["style"] = "spaceDelimited"
+	case "pipes":
+		converted["style"] = "pipeDelimited"
+	}
+	return converted
+}
+
+var swagger2SchemaKeys = []string{
+	"type", "format", "items", "default", "maximum", "exclusiveMaximum", "minimum", "exclusiveMinimum",
+	"maxLength", "minLength", "pattern", "maxItems", "minItems", "uniqueItems", "enum", "multipleOf",
+}
+
+func swagger2ParameterSchema(param map[string]interface{}) map[string]interface{} {
+	schema := make(map[string]interface{})
+	for _, k := range swagger2SchemaKeys {
+		if v, ok := param[k]; ok {
+			schema[k] = convertSwagger2Value(v)
+		}
+	}
+	if stringAt(schema, "type") == "file" {
+		schema["type"], schema["format"] = "string", "binary"
+	}
+	return schema
+}
+
+func convertSwagger2SecurityScheme(scheme map[string]interface{}) map[string]interface{} {
+	converted := make(map[string]interface{})
+	copyKeys(converted, scheme, "description")
+	switch stringAt(scheme, "type") {
+	case "basic":
+		converted["type"], converted["scheme"] = "http", "basic"
+	case "apiKey":
+		converted["type"] = "apiKey"
+		copyKeys(converted, scheme, "name", "in")
+	case "oauth2":
+		converted["type"] = "oauth2"
+		flow := map[string]interface{}{"scopes": convertSwagger2Value(scheme["scopes"])}
+		if flow["scopes"] == nil {
+			flow["scopes"] = map[string]interface{}{}
+		}
+		flowName := stringAt(scheme, "flow")
+		switch flowName {
+		case "implicit":
+			copyKeys(flow, scheme, "authorizationUrl")
+		case "password":
+			copyKeys(flow, scheme, "tokenUrl")
+		case "application":
+			flowName = "clientCredentials"
+			copyKeys(flow, scheme, "tokenUrl")
+		case "accessCode":
+			flowName = "authorizationCode"
+			copyKeys(flow, scheme, "authorizationUrl", "tokenUrl")
+		}
+		converted["flows"] = map[string]interface{}{flowName: flow}
+	}
+	return converted
+}
+
+// convertSwagger2Value deep copies a value rewriting the swagger 2.0 specific parts of schemas
+func convertSwagger2Value(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			switch {
+			case k == "$ref":
+				if ref, ok := child.(string); ok {
+					converted[k] = rewriteSwagger2Ref(ref)
+					continue
+				}
+			case k == "x-nullable":
+				converted["nullable"] = child
+				continue
+			case k == "discriminator":
+				if prop, ok := child.(string); ok {
+					converted[k] = map[string]interface{}{"propertyName": prop}
+					continue
+				}
+			case k == "type" && child == "file":
+				converted["type"], converted["format"] = "string", "binary"
+				continue
+			}
+			converted[k] = convertSwagger2Value(child)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(val))
+		for i, child := range val {
+			converted[i] = convertSwagger2Value(child)
+		}
+		return converted
+	}
+	return v
+}
+
+func rewriteSwagger2Ref(ref string) string {
+	for from, to := range swagger2Refs {
+		if strings.HasPrefix(ref, from) {
+			return to + strings.TrimPrefix(ref, from)
+		}
+	}
+	return ref
+}
+
+// openAPI30To31 upgrades a raw OpenAPI 3.0 document to a new raw OpenAPI 3.1 document. Only the schemas
+// are rewritten, properties, examples and extensions named like their keywords are kept
+func openAPI30To31(raw map[string]interface{}) map[string]interface{} {
+	upgraded := copyValue(raw).(map[string]interface{})
+	upgraded["openapi"] = string(OpenAPI31)
+	upgradePathItemsTo31(objectAt(upgraded, "paths"))
+	components := objectAt(upgraded, "components")
+	schemas := objectAt(components, "schemas")
+	for name, schema := range schemas {
+		schemas[name] = upgradeSchemaTo31(schema)
+	}
+	for _, kind := range []string{"parameters", "headers", "requestBodies", "responses"} {
+		for _, component := range objectAt(components, kind) {
+			upgradeSchemasOf(component)
+		}
+	}
+	for _, callback := range objectAt(components, "callbacks") {
+		pathItems, _ := callback.(map[string]interface{})
+		upgradePathItemsTo31(pathItems)
+	}
+	return upgraded
+}
+
+func upgradePathItemsTo31(pathItems map[string]interface{}) {
+	for _, v := range pathItems {
+		pathItem, _ := v.(map[string]interface{})
+		for _, param := range arrayAt(pathItem, "parameters") {
+			upgradeSchemasOf(param)
+		}
+		for _, method := range Methods {
+			op := objectAt(pathItem, method)
+			for _, param := range arrayAt(op, "parameters") {
+				upgradeSchemasOf(param)
+			}
+			upgradeSchemasOf(op["requestBody"])
+			for _, resp := range objectAt(op, "responses") {
+				upgradeSchemasOf(resp)
+			}
+			for _, callback := range objectAt(op, "callbacks") {
+				pathItems, _ := callback.(map[string]interface{})
+				upgradePathItemsTo31(pathItems)
+			}
+		}
+	}
+}
+
+// upgradeSchemasOf upgrades the schemas of a parameter, header, request body, response, media type or
+// encoding in place
+func upgradeSchemasOf(v interface{}) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if schema, ok := obj["schema"]; ok {
+		obj["schema"] = upgradeSchemaTo31(schema)
+	}
+	for _, named := range []string{"content", "headers", "encoding"} {
+		for _, child := range objectAt(obj, named) {
+			upgradeSchemasOf(child)
+		}
+	}
+}
+
+// upgradeSchemaTo31 returns a copy of the schema with nullable and the boolean exclusive bounds replaced by
+// their 3.1 equivalents. A nullable schema without a type, ie. a $ref, becomes an anyOf with the null type
+func upgradeSchemaTo31(v interface{}) interface{} {
+	schema, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	upgraded := make(map[string]interface{}, len(schema))
+	for k, child := range schema {
+		switch k {
+		case "properties":
+			if props, ok := child.(map[string]interface{}); ok {
+				upgradedProps := make(map[string]interface{}, len(props))
+				for name, prop := range props {
+					upgradedProps[name] = upgradeSchemaTo31(prop)
+				}
+				child = upgradedProps
+			}
+		case "items", "additionalProperties", "not":
+			child = upgradeSchemaTo31(child)
+		case "allOf", "anyOf", "oneOf":
+			if list, ok := child.([]interface{}); ok {
+				upgradedList := make([]interface{}, len(list))
+				for i, item := range list {
+					upgradedList[i] = upgradeSchemaTo31(item)
+				}
+				child = upgradedList
+			}
+		}
+		upgraded[k] = child
+	}
+	for _, bound := range []string{"Minimum", "Maximum"} {
+		exclusive, ok := upgraded["exclusive"+bound].(bool)
+		if !ok {
+			continue
+		}
+		delete(upgraded, "exclusive"+bound)
+		if limit, ok := upgraded[strings.ToLower(bound)]; ok && exclusive {
+			upgraded["exclusive"+bound] = limit
+			delete(upgraded, strings.ToLower(bound))
+		}
+	}
+	nullable, ok := upgraded["nullable"].(bool)
+	if !ok {
+		return upgraded
+	}
+	delete(upgraded, "nullable")
+	if !nullable {
+		return upgraded
+	}
+	if t, ok := upgraded["type"].(string); ok {
+		upgraded["type"] = []interface{}{t, "null"}
+		return upgraded
+	}
+	return map[string]interface{}{"anyOf": []interface{}{upgraded, map[string]interface{}{"type": "null"}}}
+}
+
+// copyValue deep copies a raw value
+func copyValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			copied[k] = copyValue(child)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(val))
+		for i, child := range val {
+			copied[i] = copyValue(child)
+		}
+		return copied
+	}
+	return v
+}
+
+func isMethod(name string) bool {
+	for _, m := range Methods {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+func stringsOf(arr []interface{}, fallback ...string) []string {
+	strs := make([]string, 0, len(arr))
+	for _, a := range arr {
+		if s, ok := a.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	if len(strs) == 0 {
+		return fallback
+	}
+	return strs
+}
+
+func copyKeys(to, from map[string]interface{}, keys ...string) {
+	for _, k := range keys {
+		if v, ok := from[k]; ok {
+			to[k] = convertSwagger2Value(v)
+		}
+	}
+}
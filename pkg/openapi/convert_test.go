@@ -0,0 +1,183 @@
+package openapi
+
+import (
+	"testing"
+	"time"
+)
+
+const swagger2FullSpec = `{
+	"swagger": "2.0",
+	"info": {"title": "Pets", "version": "1"},
+	"host": "petstore.io",
+	"basePath": "/v2",
+	"schemes": ["https"],
+	"consumes": ["application/json"],
+	"produces": ["application/json"],
+	"securityDefinitions": {
+		"auth": {"type": "oauth2", "flow": "accessCode", "authorizationUrl": "https://a", "tokenUrl": "https://t", "scopes": {"read": "read"}},
+		"basic": {"type": "basic"}
+	},
+	"parameters": {"limit": {"name": "limit", "in": "query", "type": "integer"}},
+	"paths": {
+		"/pets": {
+			"get": {
+				"operationId": "listPets",
+				"parameters": [
+					{"$ref": "#/parameters/limit"},
+					{"name": "tags", "in": "query", "type": "array", "items": {"type": "string"}, "collectionFormat": "multi"}
+				],
+				"responses": {"200": {"description": "ok", "schema": {"type": "array", "items": {"$ref": "#/definitions/Pet"}}}}
+			},
+			"post": {
+				"operationId": "addPet",
+				"parameters": [{"name": "pet", "in": "body", "required": true, "schema": {"$ref": "#/definitions/Pet"}}],
+				"responses": {"201": {"description": "created"}}
+			}
+		},
+		"/pets/{id}/image": {
+			"put": {
+				"operationId": "uploadImage",
+				"consumes": ["multipart/form-data"],
+				"parameters": [
+					{"name": "id", "in": "path", "required": true, "type": "string"},
+					{"name": "file", "in": "formData", "required": true, "type": "file"}
+				],
+				"responses": {"204": {"description": "uploaded"}}
+			}
+		}
+	},
+	"definitions": {"Pet": {"type": "object", "properties": {"name": {"type": "string", "x-nullable": true}}}}
+}`
+
+func Test_convertSwagger2ToOpenAPI3(t *testing.T) {
+	spec := ConvertedToOpenAPI3(testSpec(swagger2FullSpec), OpenAPI30)
+	doc, err := DocumentOf(spec)
+	check("convert", t, err)
+	if doc.SpecVersion != string(OpenAPI30) {
+		t.Errorf("unexpected version %s", doc.SpecVersion)
+	}
+	if len(doc.Servers) != 1 || doc.Servers[0] != "https://petstore.io/v2" {
+		t.Errorf("unexpected servers %v", doc.Servers)
+	}
+	if len(doc.Operations) != 3 || len(doc.Schemas) != 1 || doc.Schemas[0] != "Pet" {
+		t.Errorf("unexpected operations %v or schemas %v", doc.Operations, doc.Schemas)
+	}
+	raw := doc.Raw
+	list := objectAt(raw, "paths", "/pets", "get")
+	params := arrayAt(list, "parameters")
+	if len(params) != 2 || stringAt(params[0].(map[string]interface{}), "$ref") != "#/components/parameters/limit" {
+		t.Errorf("unexpected list parameters %v", params)
+	}
+	if tags := params[1].(map[string]interface{}); tags["style"] != "form" || tags["explode"] != true {
+		t.Errorf("unexpected collection format conversion %v", tags)
+	}
+	items := objectAt(list, "responses", "200", "content", "application/json", "schema", "items")
+	if stringAt(items, "$ref") != "#/components/schemas/Pet" {
+		t.Errorf("unexpected response schema %v", items)
+	}
+	body := objectAt(raw, "paths", "/pets", "post", "requestBody")
+	if body["required"] != true || stringAt(objectAt(body, "content", "application/json", "schema"), "$ref") != "#/components/schemas/Pet" {
+		t.Errorf("unexpected request body %v", body)
+	}
+	upload := objectAt(raw, "paths", "/pets/{id}/image", "put")
+	if len(arrayAt(upload, "parameters")) != 1 {
+		t.Errorf("expected only path parameter on upload, got %v", arrayAt(upload, "parameters"))
+	}
+	file := objectAt(upload, "requestBody", "content", "multipart/form-data", "schema", "properties", "file")
+	if file["type"] != "string" || file["format"] != "binary" {
+		t.Errorf("unexpected file upload schema %v", file)
+	}
+	if objectAt(raw, "components", "schemas", "Pet", "properties", "name")["nullable"] != true {
+		t.Errorf("expected x-nullable to be converted to nullable")
+	}
+	flow := objectAt(raw, "components", "securitySchemes", "auth", "flows", "authorizationCode")
+	if stringAt(flow, "tokenUrl") != "https://t" || stringAt(flow, "authorizationUrl") != "https://a" {
+		t.Errorf("unexpected oauth2 flow %v", objectAt(raw, "components", "securitySchemes", "auth"))
+	}
+	if basic := objectAt(raw, "components", "securitySchemes", "basic"); basic["type"] != "http" || basic["scheme"] != "basic" {
+		t.Errorf("unexpected basic scheme %v", basic)
+	}
+}
+
+func Test_convertUpgradesToOpenAPI31(t *testing.T) {
+	doc, err := DocumentOf(ConvertedToOpenAPI3(testSpec(swagger2FullSpec), OpenAPI31))
+	check("convert", t, err)
+	if doc.SpecVersion != string(OpenAPI31) {
+		t.Errorf("unexpected version %s", doc.SpecVersion)
+	}
+	name := objectAt(doc.Raw, "components", "schemas", "Pet", "properties", "name")
+	if types, ok := name["type"].([]interface{}); !ok || len(types) != 2 || types[1] != "null" {
+		t.Errorf("expected nullable to become a type union, got %v", name)
+	}
+}
+
+func Test_convertKeepsOpenAPI3Untouched(t *testing.T) {
+	original := testSpec(oas3Spec)
+	converted, err := ConvertedToOpenAPI3(original, OpenAPI30).Get()
+	check("convert", t, err)
+	if string(converted) != oas3Spec {
+		t.Errorf("expected openapi 3 spec to be served untouched")
+	}
+}
+
+const nullableTestSpec = `{
+  "openapi": "3.0.3",
+  "paths": {"/pets": {"get": {"parameters": [{"name": "limit", "in": "query", "schema": {"type": "integer", "nullable": true}}],
+    "responses": {"200": {"description": "ok", "content": {"application/json": {
+      "schema": {"$ref": "#/components/schemas/Pet", "nullable": true},
+      "example": {"nullable": true, "exclusiveMinimum": true}}}}}}}},
+  "components": {"schemas": {"Pet": {"type": "object", "properties": {
+    "nullable": {"type": "boolean"},
+    "exclusiveMinimum": {"type": "boolean", "default": true},
+    "age": {"type": "integer", "minimum": 0, "exclusiveMinimum": true}}}}}
+}`
+
+func Test_upgradeTo31OnlyRewritesSchemas(t *testing.T) {
+	doc, err := DocumentOf(ConvertedToOpenAPI3(testSpec(nullableTestSpec), OpenAPI31))
+	check("convert", t, err)
+	props := objectAt(doc.Raw, "components", "schemas", "Pet", "properties")
+	if nullable := objectAt(props, "nullable"); nullable["type"] != "boolean" {
+		t.Errorf("expected the property named nullable to be kept, got %v", props)
+	}
+	if exclusive := objectAt(props, "exclusiveMinimum"); exclusive["type"] != "boolean" || exclusive["default"] != true {
+		t.Errorf("expected the property named exclusiveMinimum to be kept, got %v", props)
+	}
+	if age := objectAt(props, "age"); age["exclusiveMinimum"] != 0.0 || age["minimum"] != nil {
+		t.Errorf("expected the exclusive bound of the schema to be upgraded, got %v", age)
+	}
+	mediaType := objectAt(doc.Raw, "paths", "/pets", "get", "responses", "200", "content", "application/json")
+	if example := objectAt(mediaType, "example"); example["nullable"] != true || example["exclusiveMinimum"] != true {
+		t.Errorf("expected the example to be kept, got %v", example)
+	}
+	anyOf := arrayAt(objectAt(mediaType, "schema"), "anyOf")
+	if len(anyOf) != 2 || objectAt(anyOf[0].(map[string]interface{}))["$ref"] != "#/components/schemas/Pet" ||
+		objectAt(anyOf[1].(map[string]interface{}))["type"] != "null" {
+		t.Errorf("expected the nullable $ref to become an anyOf with null, got %v", mediaType["schema"])
+	}
+	param := arrayAt(objectAt(doc.Raw, "paths", "/pets", "get"), "parameters")[0].(map[string]interface{})
+	if types, ok := objectAt(param, "schema")["type"].([]interface{}); !ok || len(types) != 2 || types[1] != "null" {
+		t.Errorf("expected the nullable parameter schema to become a type union, got %v", param)
+	}
+}
+
+func Test_storedSpecsHoldTheirConversions(t *testing.T) {
+	r := NewCachedRepository()
+	upstream := &countingSpec{}
+	check("put", t, r.Put("s1", "invoices", Cached(upstream, time.Minute)))
+	spec, err := r.Spec("invoices")
+	check("spec", t, err)
+	converted := ConvertedToOpenAPI3(spec, OpenAPI31)
+	for i := 0; i < 3; i++ {
+		if again := ConvertedToOpenAPI3(spec, OpenAPI31); again != converted {
+			t.Fatalf("expected the stored spec to hold its conversion")
+		}
+		content, err := converted.Get()
+		check("get", t, err)
+		if doc, err := ParseDocument(content); err != nil || doc.SpecVersion != string(OpenAPI31) {
+			t.Fatalf("expected the spec to be converted, got %s", content)
+		}
+	}
+	if upstream.calls != 1 {
+		t.Errorf("expected the spec to be fetched once, got %d fetches", upstream.calls)
+	}
+}
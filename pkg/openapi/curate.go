@@ -0,0 +1,161 @@
+package openapi
+
+import (
+	"path"
+	"strings"
+)
+
+// TransformRules curate the served specs for a wider audience
+type TransformRules struct {
+	// DropTags removes the operations with any of the tags, ie. internal
+	DropTags []string `json:"drop-tags"`
+	// DropInternal removes the paths and operations marked with x-internal: true
+	DropInternal bool `json:"drop-internal"`
+	// DropPaths removes the paths matching any of the glob patterns, a pattern ending with /** matches
+	// the path and everything below it, ie. /admin/**
+	DropPaths []string `json:"drop-paths"`
+	// StripExamples removes the example and examples values
+	StripExamples bool `json:"strip-examples"`
+	// StripExtensions removes the x- vendor extensions
+	StripExtensions bool `json:"strip-extensions"`
+}
+
+// Empty is true if the rules don't change any spec
+func (r TransformRules) Empty() bool {
+	return len(r.DropTags) == 0 && !r.DropInternal && len(r.DropPaths) == 0 && !r.StripExamples && !r.StripExtensions
+}
+
+// Transform curates the specs with the rules
+func (r TransformRules) Transform() Transform {
+	return func(meta SpecMetadata, spec Spec) Spec {
+		return Curated(spec, r)
+	}
+}
+
+// Curated returns a spec that serves the delegate curated by the rules
+func Curated(delegate Spec, rules TransformRules) Spec {
+	return derived(delegate, func(from *Document) map[string]interface{} {
+		return rules.apply(from.Raw)
+	})
+}
+
+// apply the rules to a copy of the raw spec
+func (r TransformRules) apply(raw map[string]interface{}) map[string]interface{} {
+	curated := make(map[string]interface{}, len(raw))
+	for k, v := range raw {
+		curated[k] = v
+	}
+	if paths := objectAt(raw, "paths"); paths != nil {
+		curated["paths"] = r.paths(paths)
+	}
+	if tags := arrayAt(raw, "tags"); tags != nil && len(r.DropTags) > 0 {
+		kept := make([]interface{}, 0, len(tags))
+		for _, t := range tags {
+			if tag, ok := t.(map[string]interface{}); !ok || !matchesAny(r.DropTags, stringAt(tag, "name")) {
+				kept = append(kept, t)
+			}
+		}
+		curated["tags"] = kept
+	}
+	if r.StripExamples || r.StripExtensions {
+		curated = strip(curated, "", func(key string) bool {
+			return (r.StripExamples && (key == "example" || key == "examples")) ||
+				(r.StripExtensions && strings.HasPrefix(key, "x-"))
+		}).(map[string]interface{})
+	}
+	return curated
+}
+
+// paths returns the kept paths with their kept operations, paths without operations are dropped
+func (r TransformRules) paths(paths map[string]interface{}) map[string]interface{} {
+	kept := make(map[string]interface{}, len(paths))
+	for p, v := range paths {
+		item, ok := v.(map[string]interface{})
+		if !ok {
+			kept[p] = v
+			continue
+		}
+		if r.dropsPath(p) || r.internal(item) {
+			continue
+		}
+		curated := make(map[string]interface{}, len(item))
+		operations := 0
+		for k, v := range item {
+			if !isMethod(k) {
+				curated[k] = v
+				continue
+			}
+			if op, ok := v.(map[string]interface{}); ok && (r.internal(op) || r.dropsTags(op)) {
+				continue
+			}
+			curated[k] = v
+			operations++
+		}
+		if operations > 0 {
+			kept[p] = curated
+		}
+	}
+	return kept
+}
+
+func (r TransformRules) dropsPath(p string) bool {
+	for _, pattern := range r.DropPaths {
+		if prefix := strings.TrimSuffix(pattern, "/**"); prefix != pattern {
+			if p == prefix || strings.HasPrefix(p, prefix+"/") {
+				return true
+			}
+		} else if ok, err := path.Match(pattern, p); pattern == p || err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r TransformRules) internal(obj map[string]interface{}) bool {
+	internal, _ := obj["x-internal"].(bool)
+	return r.DropInternal && internal
+}
+
+func (r TransformRules) dropsTags(op map[string]interface{}) bool {
+	for _, tag := range stringsOf(arrayAt(op, "tags")) {
+		if matchesAny(r.DropTags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// namedMaps are keyed by user defined names instead of keywords, ie. the properties of a schema
+var namedMaps = map[string]bool{
+	"paths": true, "properties": true, "patternProperties": true, "definitions": true, "schemas": true,
+	"parameters": true, "responses": true, "headers": true, "examples": true, "requestBodies": true,
+	"securitySchemes": true, "securityDefinitions": true, "links": true, "callbacks": true,
+	"content": true, "variables": true, "encoding": true, "mapping": true, "webhooks": true,
+}
+
+// strip returns a copy of v without the keywords selected by drop, the names of the named maps are kept
+func strip(v interface{}, parent string, drop func(key string) bool) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		stripped := make(map[string]interface{}, len(value))
+		named := namedMaps[parent]
+		for k, child := range value {
+			if !named && drop(k) {
+				continue
+			}
+			childParent := k
+			if named {
+				childParent = ""
+			}
+			stripped[k] = strip(child, childParent, drop)
+		}
+		return stripped
+	case []interface{}:
+		stripped := make([]interface{}, 0, len(value))
+		for _, child := range value {
+			stripped = append(stripped, strip(child, "", drop))
+		}
+		return stripped
+	}
+	return v
+}
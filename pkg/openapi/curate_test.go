@@ -0,0 +1,100 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+const curatedTestSpec = `{
+  "openapi": "3.0.3",
+  "x-owner": "team-a",
+  "tags": [{"name": "pets"}, {"name": "internal"}],
+  "paths": {
+    "/pets": {
+      "get": {"operationId": "listPets", "tags": ["pets"], "x-rate-limit": 10,
+        "responses": {"200": {"description": "ok", "content": {"application/json": {"example": [{"name": "rex"}]}}}}},
+      "delete": {"operationId": "deletePets", "tags": ["internal"]},
+      "post": {"operationId": "createPet", "x-internal": true}
+    },
+    "/debug": {"x-internal": true, "get": {"operationId": "debug"}},
+    "/admin": {"get": {"operationId": "admin"}},
+    "/admin/users": {"get": {"operationId": "adminUsers"}}
+  },
+  "components": {"schemas": {"Pet": {"type": "object", "example": {"name": "rex"},
+    "properties": {"example": {"type": "string"}, "x-legacy": {"type": "string"}}}}}
+}`
+
+func TestTransformRulesCurateSpecs(t *testing.T) {
+	rules := TransformRules{DropTags: []string{"internal"}, DropInternal: true, DropPaths: []string{"/admin/**"}, StripExamples: true, StripExtensions: true}
+	doc, err := DocumentOf(Curated(testSpec(curatedTestSpec), rules))
+	check("curate", t, err)
+	if len(doc.Operations) != 1 || doc.Operations[0].OperationID != "listPets" {
+		t.Errorf("expected only the public operation to be kept, got %v", doc.Operations)
+	}
+	if len(doc.Tags) != 1 || doc.Tags[0].Name != "pets" {
+		t.Errorf("expected the dropped tag to be removed, got %v", doc.Tags)
+	}
+	curated, _ := json.Marshal(doc.Raw)
+	expected := `{"components":{"schemas":{"Pet":{"properties":{"example":{"type":"string"},"x-legacy":{"type":"string"}},"type":"object"}}},` +
+		`"openapi":"3.0.3","paths":{"/pets":{"get":{"operationId":"listPets","responses":{"200":{"content":{"application/json":{}},"description":"ok"}},"tags":["pets"]}}},` +
+		`"tags":[{"name":"pets"}]}`
+	if string(curated) != expected {
+		t.Errorf("expected the examples and extensions to be stripped but properties named like them kept, got\n%s", curated)
+	}
+	original, err := DocumentOf(testSpec(curatedTestSpec))
+	check("parse", t, err)
+	if len(original.Operations) != 6 {
+		t.Errorf("expected the original spec to be unchanged, got %v", original.Operations)
+	}
+}
+
+func TestTransformedViewListsCuratedSpecs(t *testing.T) {
+	r := NewCachedRepository()
+	check("put", t, r.Put("s1", "pets", testSpec(curatedTestSpec)))
+	view := TransformedView(r, TransformRules{DropInternal: true}.Transform())
+	if _, ok := view.(Searchable); ok {
+		t.Error("expected the view not to search the uncurated index")
+	}
+	docs := documentsOf(context.Background(), view, view.Keys())
+	if ops := docs["pets"].Operations; len(ops) != 4 {
+		t.Errorf("expected the listing to contain the curated operations, got %v", ops)
+	}
+}
+
+func TestTransformedViewReportsTheFetchesOfTheRepo(t *testing.T) {
+	r := NewCachedRepository()
+	upstream := &upstreamSpec{content: curatedTestSpec}
+	check("put", t, r.Put("s1", "pets", CachedWith(upstream, CacheOptions{Background: true})))
+	view := TransformedView(r, TransformRules{DropInternal: true}.Transform())
+	router := mux.NewRouter()
+	for _, fun := range []repoHandlerFunc{statusHandler(NewStatusRegistry()), docsHandler(nil)} {
+		path, handler := fun(view)
+		router.Handle("/docs"+path, handler)
+	}
+	serve := func(path string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path, nil))
+		return rw
+	}
+	if rw := serve("/docs/pets"); rw.Header().Get("Age") == "" || rw.Header().Get("Warning") == "" {
+		t.Errorf("expected the expired spec to be served with its age and a warning, got %v", rw.Header())
+	}
+	var status Status
+	check("decode status", t, json.NewDecoder(serve("/docs/_status").Body).Decode(&status))
+	if len(status.Specs) != 1 || status.Specs[0].State != "ok" || !status.Specs[0].Stale {
+		t.Errorf("expected the status of the fetched spec, got %+v", status.Specs)
+	}
+	spec, err := view.Spec("pets")
+	check("spec", t, err)
+	refreshed, err := RefreshOf(spec)
+	upstream.mu.Lock()
+	defer upstream.mu.Unlock()
+	if !refreshed || err != nil || upstream.fetches < 2 {
+		t.Errorf("expected the view to refresh the spec, got %v %v after %d fetches", refreshed, err, upstream.fetches)
+	}
+}
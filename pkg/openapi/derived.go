@@ -0,0 +1,100 @@
+package openapi
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// deriveFunc derives a new raw document from the document of a delegate, nil if the delegate is served
+// unchanged
+type deriveFunc func(from *Document) map[string]interface{}
+
+// derivedSpec serves a document derived from the document of its delegate in the format of the delegate.
+// The derived document is cached and only derived again when the document of the delegate changes
+type derivedSpec struct {
+	delegate Spec
+	derive   deriveFunc
+	mu       sync.Mutex
+	from     *Document
+	doc      *Document
+	docErr   error
+	resp     []byte
+}
+
+func derived(delegate Spec, derive deriveFunc) *derivedSpec {
+	return &derivedSpec{delegate: delegate, derive: derive}
+}
+
+// Get fetches the delegate once and encodes the derived document in its format
+func (s *derivedSpec) Get() ([]byte, error) {
+	original, err := s.delegate.Get()
+	if err != nil {
+		return nil, err
+	}
+	from, ok := CachedDocumentOf(s.delegate)
+	if !ok {
+		if from, err = ParseDocument(original); err != nil {
+			return nil, err
+		}
+	}
+	doc, err := s.derivedFrom(from)
+	if err != nil {
+		return nil, err
+	}
+	if doc == from {
+		return original, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.from == from && s.resp != nil {
+		return s.resp, nil
+	}
+	resp, err := json.Marshal(doc.Raw)
+	if err == nil {
+		resp, err = ConvertFormat(resp, DetectFormat(original))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.from == from {
+		s.resp = resp
+	}
+	return resp, nil
+}
+
+func (s *derivedSpec) Document() (*Document, error) {
+	from, err := DocumentOf(s.delegate)
+	if err != nil {
+		return nil, err
+	}
+	return s.derivedFrom(from)
+}
+
+// CachedDocument derives the document from the cached document of the delegate without fetching it
+func (s *derivedSpec) CachedDocument() (*Document, bool) {
+	from, ok := CachedDocumentOf(s.delegate)
+	if !ok {
+		return nil, false
+	}
+	doc, err := s.derivedFrom(from)
+	return doc, err == nil
+}
+
+func (s *derivedSpec) Unwrap() Spec {
+	return s.delegate
+}
+
+func (s *derivedSpec) derivedFrom(from *Document) (*Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.from == from {
+		return s.doc, s.docErr
+	}
+	s.from, s.resp = from, nil
+	if raw := s.derive(from); raw != nil {
+		s.doc, s.docErr = documentOf(raw)
+	} else {
+		s.doc, s.docErr = from, nil
+	}
+	return s.doc, s.docErr
+}
@@ -0,0 +1,331 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is a single difference between two revisions of a spec
+type Change struct {
+	Pointer  string `json:"pointer"`
+	Kind     string `json:"kind"`
+	Message  string `json:"message"`
+	Breaking bool   `json:"breaking"`
+}
+
+// Diff is the structured difference between two revisions of a spec
+type Diff struct {
+	From        string   `json:"from,omitempty"`
+	To          string   `json:"to,omitempty"`
+	Breaking    int      `json:"breaking"`
+	NonBreaking int      `json:"nonBreaking"`
+	Changes     []Change `json:"changes"`
+}
+
+// HasBreakingChanges is true if any of the changes is breaking
+func (d *Diff) HasBreakingChanges() bool {
+	return d.Breaking > 0
+}
+
+// DiffDocuments computes the changes from one revision of a spec to another, classified as breaking
+// if they can break existing consumers. Swagger 2.0 documents are converted to OpenAPI 3 before comparing
+func DiffDocuments(from, to *Document) *Diff {
+	d := &differ{from: normalizedRaw(from), to: normalizedRaw(to), diff: &Diff{Changes: make([]Change, 0)}}
+	d.paths()
+	sort.SliceStable(d.diff.Changes, func(i, j int) bool {
+		if d.diff.Changes[i].Breaking != d.diff.Changes[j].Breaking {
+			return d.diff.Changes[i].Breaking
+		}
+		return d.diff.Changes[i].Pointer < d.diff.Changes[j].Pointer
+	})
+	return d.diff
+}
+
+// DiffContents parses both revisions of a spec and computes their diff
+func DiffContents(from, to []byte) (*Diff, error) {
+	fromDoc, err := ParseDocument(from)
+	if err != nil {
+		return nil, fmt.Errorf("diff: unable to parse from: %w", err)
+	}
+	toDoc, err := ParseDocument(to)
+	if err != nil {
+		return nil, fmt.Errorf("diff: unable to parse to: %w", err)
+	}
+	return DiffDocuments(fromDoc, toDoc), nil
+}
+
+func normalizedRaw(doc *Document) map[string]interface{} {
+	if doc.IsSwagger2() {
+		return swagger2ToOpenAPI30(doc.Raw)
+	}
+	return doc.Raw
+}
+
+type direction int
+
+const (
+	request direction = iota
+	response
+)
+
+type differ struct {
+	from, to map[string]interface{}
+	diff     *Diff
+}
+
+func (d *differ) change(breaking bool, pointer, kind, message string, args ...interface{}) {
+	d.diff.Changes = append(d.diff.Changes, Change{
+		Pointer:  pointer,
+		Kind:     kind,
+		Message:  fmt.Sprintf(message, args...),
+		Breaking: breaking,
+	})
+	if breaking {
+		d.diff.Breaking++
+	} else {
+		d.diff.NonBreaking++
+	}
+}
+
+func (d *differ) paths() {
+	fromPaths, toPaths := objectAt(d.from, "paths"), objectAt(d.to, "paths")
+	for _, path := range unionKeys(fromPaths, toPaths) {
+		fromItem, _ := fromPaths[path].(map[string]interface{})
+		toItem, _ := toPaths[path].(map[string]interface{})
+		pointer := jsonPointer("paths", path)
+		switch {
+		case toItem == nil:
+			d.change(true, pointer, "path-removed", "path %s was removed", path)
+		case fromItem == nil:
+			d.change(false, pointer, "path-added", "path %s was added", path)
+		default:
+			for _, method := range Methods {
+				fromOp, _ := fromItem[method].(map[string]interface{})
+				toOp, _ := toItem[method].(map[string]interface{})
+				opPointer := jsonPointer("paths", path, method)
+				switch {
+				case fromOp == nil && toOp == nil:
+				case toOp == nil:
+					d.change(true, opPointer, "operation-removed", "operation %s %s was removed", strings.ToUpper(method), path)
+				case fromOp == nil:
+					d.change(false, opPointer, "operation-added", "operation %s %s was added", strings.ToUpper(method), path)
+				default:
+					d.operation(opPointer, fromItem, fromOp, toItem, toOp)
+				}
+			}
+		}
+	}
+}
+
+func (d *differ) operation(pointer string, fromItem, fromOp, toItem, toOp map[string]interface{}) {
+	if fromDep, _ := fromOp["deprecated"].(bool); !fromDep {
+		if toDep, _ := toOp["deprecated"].(bool); toDep {
+			d.change(false, pointer, "operation-deprecated", "operation was deprecated")
+		}
+	}
+	fromParams := d.parameters(d.from, fromItem, fromOp)
+	toParams := d.parameters(d.to, toItem, toOp)
+	for _, id := range unionKeys(fromParams, toParams) {
+		fromParam, _ := fromParams[id].(map[string]interface{})
+		toParam, _ := toParams[id].(map[string]interface{})
+		paramPointer := pointer + jsonPointer("parameters", id)
+		toRequired, _ := toParam["required"].(bool)
+		fromRequired, _ := fromParam["required"].(bool)
+		switch {
+		case toParam == nil:
+			d.change(false, paramPointer, "parameter-removed", "parameter %s was removed", id)
+		case fromParam == nil:
+			d.change(toRequired, paramPointer, "parameter-added", "parameter %s was added (required: %t)", id, toRequired)
+		default:
+			if toRequired && !fromRequired {
+				d.change(true, paramPointer, "parameter-required", "parameter %s became required", id)
+			}
+			d.schema(paramPointer+"/schema", d.resolve(d.from, fromParam["schema"]), d.resolve(d.to, toParam["schema"]), request, map[string]bool{})
+		}
+	}
+	fromBody, toBody := d.resolve(d.from, fromOp["requestBody"]), d.resolve(d.to, toOp["requestBody"])
+	bodyPointer := pointer + "/requestBody"
+	toBodyRequired, _ := toBody["required"].(bool)
+	fromBodyRequired, _ := fromBody["required"].(bool)
+	switch {
+	case fromBody == nil && toBody != nil:
+		d.change(toBodyRequired, bodyPointer, "request-body-added", "request body was added (required: %t)", toBodyRequired)
+	case fromBody != nil && toBody == nil:
+		d.change(false, bodyPointer, "request-body-removed", "request body was removed")
+	case fromBody != nil:
+		if toBodyRequired && !fromBodyRequired {
+			d.change(true, bodyPointer, "request-body-required", "request body became required")
+		}
+		d.content(bodyPointer, objectAt(fromBody, "content"), objectAt(toBody, "content"), request)
+	}
+	fromResponses, toResponses := objectAt(fromOp, "responses"), objectAt(toOp, "responses")
+	for _, code := range unionKeys(fromResponses, toResponses) {
+		fromResp, toResp := d.resolve(d.from, fromResponses[code]), d.resolve(d.to, toResponses[code])
+		respPointer := pointer + jsonPointer("responses", code)
+		switch {
+		case toResp == nil:
+			d.change(strings.HasPrefix(code, "2"), respPointer, "response-removed", "response %s was removed", code)
+		case fromResp == nil:
+			d.change(false, respPointer, "response-added", "response %s was added", code)
+		default:
+			d.content(respPointer, objectAt(fromResp, "content"), objectAt(toResp, "content"), response)
+		}
+	}
+}
+
+// parameters of an operation, including the ones of its path item, by {in}.{name}
+func (d *differ) parameters(doc, item, op map[string]interface{}) map[string]interface{} {
+	params := make(map[string]interface{})
+	for _, list := range [][]interface{}{arrayAt(item, "parameters"), arrayAt(op, "parameters")} {
+		for _, p := range list {
+			if param := d.resolve(doc, p); param != nil {
+				params[stringAt(param, "in")+"."+stringAt(param, "name")] = param
+			}
+		}
+	}
+	return params
+}
+
+func (d *differ) content(pointer string, fromContent, toContent map[string]interface{}, dir direction) {
+	for _, mediaType := range unionKeys(fromContent, toContent) {
+		fromMedia, _ := fromContent[mediaType].(map[string]interface{})
+		toMedia, _ := toContent[mediaType].(map[string]interface{})
+		mediaPointer := pointer + jsonPointer("content", mediaType)
+		switch {
+		case toMedia == nil:
+			d.change(true, mediaPointer, "media-type-removed", "media type %s was removed", mediaType)
+		case fromMedia == nil:
+			d.change(false, mediaPointer, "media-type-added", "media type %s was added", mediaType)
+		default:
+			d.schema(mediaPointer+"/schema", d.resolve(d.from, fromMedia["schema"]), d.resolve(d.to, toMedia["schema"]), dir, map[string]bool{})
+		}
+	}
+}
+
+func (d *differ) schema(pointer string, from, to map[string]interface{}, dir direction, visited map[string]bool) {
+	if from == nil || to == nil {
+		if from != nil || to != nil {
+			d.change(true, pointer, "schema-changed", "schema was changed")
+		}
+		return
+	}
+	visitKey := fmt.Sprintf("%p-%p", from, to)
+	if visited[visitKey] {
+		return
+	}
+	visited[visitKey] = true
+	if fromType, toType := from["type"], to["type"]; !reflect.DeepEqual(fromType, toType) {
+		d.change(true, pointer, "type-changed", "type changed from %v to %v", fromType, toType)
+		return
+	}
+	if fromFormat, toFormat := stringAt(from, "format"), stringAt(to, "format"); fromFormat != toFormat {
+		d.change(true, pointer, "format-changed", "format changed from %s to %s", fromFormat, toFormat)
+	}
+	d.enum(pointer, arrayAt(from, "enum"), arrayAt(to, "enum"), dir)
+	fromRequired, toRequired := stringSet(arrayAt(from, "required")), stringSet(arrayAt(to, "required"))
+	fromProps, toProps := objectAt(from, "properties"), objectAt(to, "properties")
+	for _, name := range unionKeys(fromProps, toProps) {
+		propPointer := pointer + jsonPointer("properties", name)
+		switch {
+		case toProps[name] == nil:
+			d.change(dir == response, propPointer, "property-removed", "property %s was removed", name)
+		case fromProps[name] == nil:
+			d.change(dir == request && toRequired[name], propPointer, "property-added", "property %s was added (required: %t)", name, toRequired[name])
+		default:
+			d.schema(propPointer, d.resolve(d.from, fromProps[name]), d.resolve(d.to, toProps[name]), dir, visited)
+		}
+	}
+	for name := range toRequired {
+		if !fromRequired[name] && fromProps[name] != nil && dir == request {
+			d.change(true, pointer+jsonPointer("required"), "property-required", "property %s became required", name)
+		}
+	}
+	for name := range fromRequired {
+		if !toRequired[name] && toProps[name] != nil && dir == response {
+			d.change(true, pointer+jsonPointer("required"), "property-optional", "property %s is no longer required", name)
+		}
+	}
+	if from["items"] != nil || to["items"] != nil {
+		d.schema(pointer+"/items", d.resolve(d.from, from["items"]), d.resolve(d.to, to["items"]), dir, visited)
+	}
+}
+
+// enum values removed from a request narrow what consumers may send, values added to a
+// response may not be handled by consumers
+func (d *differ) enum(pointer string, from, to []interface{}, dir direction) {
+	if len(from) == 0 && len(to) == 0 {
+		return
+	}
+	if len(from) == 0 {
+		d.change(dir == request, pointer+"/enum", "enum-added", "enum restricted to %v", to)
+		return
+	}
+	if len(to) == 0 {
+		d.change(dir == response, pointer+"/enum", "enum-removed", "enum restriction was removed")
+		return
+	}
+	removed, added := enumDiff(from, to), enumDiff(to, from)
+	if len(removed) > 0 {
+		d.change(dir == request, pointer+"/enum", "enum-narrowed", "enum values %v were removed", removed)
+	}
+	if len(added) > 0 {
+		d.change(dir == response, pointer+"/enum", "enum-widened", "enum values %v were added", added)
+	}
+}
+
+func enumDiff(a, b []interface{}) []interface{} {
+	diff := make([]interface{}, 0)
+	for _, va := range a {
+		found := false
+		for _, vb := range b {
+			if reflect.DeepEqual(va, vb) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diff = append(diff, va)
+		}
+	}
+	return diff
+}
+
+// resolve follows local $refs of the document, returns nil if the value is not an object
+func (d *differ) resolve(doc map[string]interface{}, v interface{}) map[string]interface{} {
+	obj, _ := v.(map[string]interface{})
+	for i := 0; i < 32 && obj != nil; i++ {
+		ref := stringAt(obj, "$ref")
+		if !strings.HasPrefix(ref, "#/") {
+			return obj
+		}
+		tokens := strings.Split(strings.TrimPrefix(ref, "#/"), "/")
+		for j, t := range tokens {
+			tokens[j] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+		}
+		obj = objectAt(doc, tokens...)
+	}
+	return obj
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make(map[string]interface{}, len(a)+len(b))
+	for k := range a {
+		keys[k] = nil
+	}
+	for k := range b {
+		keys[k] = nil
+	}
+	return keysOf(keys)
+}
+
+func stringSet(arr []interface{}) map[string]bool {
+	set := make(map[string]bool, len(arr))
+	for _, s := range arr {
+		if str, ok := s.(string); ok {
+			set[str] = true
+		}
+	}
+	return set
+}
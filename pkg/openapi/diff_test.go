@@ -0,0 +1,142 @@
+package openapi
+
+import (
+	"testing"
+)
+
+const diffFromSpec = `{
+  "openapi": "3.0.0",
+  "info": {"title": "Pets", "version": "1"},
+  "paths": {
+    "/pets": {
+      "get": {
+        "parameters": [{"name": "limit", "in": "query", "schema": {"type": "integer"}}],
+        "responses": {"200": {"description": "ok", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}}
+      },
+      "post": {
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}},
+        "responses": {"201": {"description": "created"}}
+      }
+    },
+    "/pets/{id}": {
+      "delete": {"responses": {"204": {"description": "deleted"}}}
+    }
+  },
+  "components": {
+    "schemas": {
+      "Pet": {
+        "type": "object",
+        "required": ["name"],
+        "properties": {
+          "name": {"type": "string"},
+          "kind": {"type": "string", "enum": ["cat", "dog"]}
+        }
+      }
+    }
+  }
+}`
+
+const diffToSpec = `{
+  "openapi": "3.0.0",
+  "info": {"title": "Pets", "version": "2"},
+  "paths": {
+    "/pets": {
+      "get": {
+        "parameters": [
+          {"name": "limit", "in": "query", "required": true, "schema": {"type": "integer"}},
+          {"name": "offset", "in": "query", "schema": {"type": "integer"}}
+        ],
+        "responses": {"200": {"description": "ok", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}}
+      },
+      "post": {
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}},
+        "responses": {"201": {"description": "created"}}
+      }
+    },
+    "/owners": {
+      "get": {"responses": {"200": {"description": "ok"}}}
+    }
+  },
+  "components": {
+    "schemas": {
+      "Pet": {
+        "type": "object",
+        "required": ["name"],
+        "properties": {
+          "name": {"type": "string"},
+          "kind": {"type": "string", "enum": ["cat"]}
+        }
+      }
+    }
+  }
+}`
+
+func TestDiffDetectsBreakingChanges(t *testing.T) {
+	diff, err := DiffContents([]byte(diffFromSpec), []byte(diffToSpec))
+	check("diff", t, err)
+	kinds := make(map[string]bool)
+	for _, c := range diff.Changes {
+		kinds[c.Kind+"@"+c.Pointer] = c.Breaking
+	}
+	expected := map[string]bool{
+		"path-removed@/paths/~1pets~1{id}":                                                                   true,
+		"path-added@/paths/~1owners":                                                                         false,
+		"parameter-required@/paths/~1pets/get/parameters/query.limit":                                        true,
+		"parameter-added@/paths/~1pets/get/parameters/query.offset":                                          false,
+		"enum-narrowed@/paths/~1pets/post/requestBody/content/application~1json/schema/properties/kind/enum": true,
+	}
+	for k, breaking := range expected {
+		got, ok := kinds[k]
+		if !ok {
+			t.Errorf("expected change %s in %v", k, diff.Changes)
+			continue
+		}
+		if got != breaking {
+			t.Errorf("expected %s to be breaking: %t", k, breaking)
+		}
+	}
+	if !diff.HasBreakingChanges() || diff.Breaking+diff.NonBreaking != len(diff.Changes) {
+		t.Errorf("unexpected counts in %+v", diff)
+	}
+}
+
+func TestDiffOfIdenticalSpecsIsEmpty(t *testing.T) {
+	diff, err := DiffContents([]byte(diffFromSpec), []byte(diffFromSpec))
+	check("diff", t, err)
+	if len(diff.Changes) != 0 || diff.HasBreakingChanges() {
+		t.Errorf("expected no changes, got %v", diff.Changes)
+	}
+}
+
+func TestDiffAcrossSwagger2AndOpenAPI3(t *testing.T) {
+	diff, err := DiffContents([]byte(swagger2Spec), []byte(swagger2Spec))
+	check("diff", t, err)
+	if len(diff.Changes) != 0 {
+		t.Errorf("expected no changes, got %v", diff.Changes)
+	}
+	if _, err := DiffContents([]byte(diffFromSpec), []byte("not a spec")); err == nil {
+		t.Error("expected error diffing an invalid spec")
+	}
+}
+
+func TestRecordedVersionsCountChanges(t *testing.T) {
+	upstream := &mutableSpec{content: diffFromSpec}
+	store := NewMemoryHistory(5)
+	repo := NewCachedRepository(WithHistory(store))
+	check("put", t, repo.Put("source", "key", upstream))
+	spec, err := repo.Spec("key")
+	check("spec", t, err)
+	_, err = spec.Get()
+	check("get", t, err)
+	upstream.content = diffToSpec
+	_, err = spec.Get()
+	check("get", t, err)
+	versions, err := store.Versions("key")
+	check("versions", t, err)
+	if len(versions) != 2 || versions[0].Changes == 0 || versions[0].BreakingChanges == 0 {
+		t.Errorf("expected the latest version to count its changes, got %+v", versions)
+	}
+	if versions[1].Changes != 0 {
+		t.Errorf("expected the first version to have no changes, got %+v", versions[1])
+	}
+}
@@ -0,0 +1,109 @@
+package openapi
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type diskHistory struct {
+	mu          sync.RWMutex
+	dir         string
+	maxVersions int
+}
+
+// NewDiskHistory creates a history store that keeps at most maxVersions per key on disk in dir,
+// each key has a directory named by its hex encoding with an index of its versions and a file per version
+func NewDiskHistory(dir string, maxVersions int) (HistoryStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("diskHistory: unable to create directory %s: %w", dir, err)
+	}
+	return &diskHistory{dir: dir, maxVersions: maxVersions}, nil
+}
+
+// keyDir is the directory of the key, the key is hex encoded so that no key names a path outside of dir
+func (d *diskHistory) keyDir(key string) string {
+	return filepath.Join(d.dir, hex.EncodeToString([]byte(key)))
+}
+
+func (d *diskHistory) indexOf(key string) ([]Version, error) {
+	file, err := os.Open(filepath.Join(d.keyDir(key), "index.json"))
+	if os.IsNotExist(err) {
+		return []Version{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("diskHistory: unable to open index of %s: %w", key, err)
+	}
+	defer file.Close()
+	var versions []Version
+	if err := json.NewDecoder(file).Decode(&versions); err != nil {
+		return nil, fmt.Errorf("diskHistory: unable to decode index of %s: %w", key, err)
+	}
+	return versions, nil
+}
+
+func (d *diskHistory) Record(key string, version Version, content []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	versions, err := d.indexOf(key)
+	if err != nil {
+		return err
+	}
+	dir := d.keyDir(key)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("diskHistory: unable to create directory for %s: %w", key, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, version.ID), content, 0644); err != nil {
+		return fmt.Errorf("diskHistory: unable to write version %s of %s: %w", version.ID, key, err)
+	}
+	versions = append([]Version{version}, versions...)
+	if len(versions) > d.maxVersions {
+		for _, evicted := range versions[d.maxVersions:] {
+			if !containsVersion(versions[:d.maxVersions], evicted.ID) {
+				_ = os.Remove(filepath.Join(dir, evicted.ID))
+			}
+		}
+		versions = versions[:d.maxVersions]
+	}
+	index, err := json.Marshal(versions)
+	if err != nil {
+		return fmt.Errorf("diskHistory: unable to encode index of %s: %w", key, err)
+	}
+	tmp := filepath.Join(dir, "index.json.tmp")
+	if err := ioutil.WriteFile(tmp, index, 0644); err != nil {
+		return fmt.Errorf("diskHistory: unable to write index of %s: %w", key, err)
+	}
+	return os.Rename(tmp, filepath.Join(dir, "index.json"))
+}
+
+func (d *diskHistory) Versions(key string) ([]Version, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.indexOf(key)
+}
+
+func (d *diskHistory) Content(key, id string) ([]byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	versions, err := d.indexOf(key)
+	if err != nil {
+		return nil, err
+	}
+	if !containsVersion(versions, id) {
+		return nil, VersionNotFoundError{Key: key, ID: id}
+	}
+	return ioutil.ReadFile(filepath.Join(d.keyDir(key), id))
+}
+
+func containsVersion(versions []Version, id string) bool {
+	for _, v := range versions {
+		if v.ID == id {
+			return true
+		}
+	}
+	return false
+}
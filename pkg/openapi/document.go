@@ -0,0 +1,184 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Document is the parsed representation of an OpenAPI 3.x or Swagger 2.0 spec
+type Document struct {
+	SpecVersion string
+	Title       string
+	Version     string
+	Description string
+	Servers     []string
+	Tags        []Tag
+	Operations  []Operation
+	Schemas     []string
+	Raw         map[string]interface{}
+}
+
+// Tag is a tag declared in a spec
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operation is a single method on a path of a spec
+type Operation struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	OperationID string   `json:"operationId,omitempty"`
+	Summary     string   `json:"summary,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Deprecated  bool     `json:"deprecated,omitempty"`
+}
+
+// Methods are the http methods that can hold operations in a path item, in display order
+var Methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// IsSwagger2 is true if the document is a Swagger 2.0 document
+func (d *Document) IsSwagger2() bool {
+	return d.SpecVersion == "2.0"
+}
+
+// ParseDocument parses the raw json or yaml bytes of a spec into a Document
+func ParseDocument(data []byte) (*Document, error) {
+	data, err := ConvertFormat(data, JSON)
+	if err != nil {
+		return nil, fmt.Errorf("document: %w", err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("document: unable to decode spec: %w", err)
+	}
+	return documentOf(raw)
+}
+
+func documentOf(raw map[string]interface{}) (*Document, error) {
+	doc := &Document{Raw: raw}
+	if v, ok := raw["openapi"].(string); ok && strings.HasPrefix(v, "3.") {
+		doc.SpecVersion = v
+		doc.Servers = oas3Servers(raw)
+		doc.Schemas = keysOf(objectAt(raw, "components", "schemas"))
+	} else if v, ok := raw["swagger"].(string); ok && v == "2.0" {
+		doc.SpecVersion = v
+		doc.Servers = swagger2Servers(raw)
+		doc.Schemas = keysOf(objectAt(raw, "definitions"))
+	} else {
+		return nil, fmt.Errorf("document: unsupported spec, expected 'openapi: 3.x' or 'swagger: 2.0'")
+	}
+	info := objectAt(raw, "info")
+	doc.Title = stringAt(info, "title")
+	doc.Version = stringAt(info, "version")
+	doc.Description = stringAt(info, "description")
+	for _, t := range arrayAt(raw, "tags") {
+		if tag, ok := t.(map[string]interface{}); ok {
+			doc.Tags = append(doc.Tags, Tag{Name: stringAt(tag, "name"), Description: stringAt(tag, "description")})
+		}
+	}
+	doc.Operations = operationsOf(raw)
+	return doc, nil
+}
+
+func oas3Servers(raw map[string]interface{}) []string {
+	var servers []string
+	for _, s := range arrayAt(raw, "servers") {
+		if server, ok := s.(map[string]interface{}); ok {
+			if url := stringAt(server, "url"); url != "" {
+				servers = append(servers, url)
+			}
+		}
+	}
+	return servers
+}
+
+func swagger2Servers(raw map[string]interface{}) []string {
+	host := stringAt(raw, "host")
+	basePath := stringAt(raw, "basePath")
+	if host == "" {
+		if basePath == "" {
+			return nil
+		}
+		return []string{basePath}
+	}
+	schemes := arrayAt(raw, "schemes")
+	if len(schemes) == 0 {
+		schemes = []interface{}{"https"}
+	}
+	servers := make([]string, 0, len(schemes))
+	for _, s := range schemes {
+		if scheme, ok := s.(string); ok {
+			servers = append(servers, fmt.Sprintf("%s://%s%s", scheme, host, basePath))
+		}
+	}
+	return servers
+}
+
+func operationsOf(raw map[string]interface{}) []Operation {
+	paths := objectAt(raw, "paths")
+	ops := make([]Operation, 0)
+	for _, path := range keysOf(paths) {
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, method := range Methods {
+			op, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var tags []string
+			for _, t := range arrayAt(op, "tags") {
+				if tag, ok := t.(string); ok {
+					tags = append(tags, tag)
+				}
+			}
+			deprecated, _ := op["deprecated"].(bool)
+			ops = append(ops, Operation{
+				Method:      method,
+				Path:        path,
+				OperationID: stringAt(op, "operationId"),
+				Summary:     stringAt(op, "summary"),
+				Description: stringAt(op, "description"),
+				Tags:        tags,
+				Deprecated:  deprecated,
+			})
+		}
+	}
+	return ops
+}
+
+func objectAt(obj map[string]interface{}, path ...string) map[string]interface{} {
+	curr := obj
+	for _, p := range path {
+		next, ok := curr[p].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		curr = next
+	}
+	return curr
+}
+
+func arrayAt(obj map[string]interface{}, key string) []interface{} {
+	arr, _ := obj[key].([]interface{})
+	return arr
+}
+
+func stringAt(obj map[string]interface{}, key string) string {
+	s, _ := obj[key].(string)
+	return s
+}
+
+func keysOf(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
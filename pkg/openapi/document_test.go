@@ -0,0 +1,113 @@
+package openapi
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const oas3Spec = `{
+	"openapi": "3.0.1",
+	"info": {"title": "Invoices", "version": "1.2.0", "description": "Handles invoices"},
+	"servers": [{"url": "http://invoices:8080/api"}],
+	"tags": [{"name": "invoice", "description": "Invoice operations"}],
+	"paths": {
+		"/invoices/{id}": {
+			"delete": {"operationId": "deleteInvoice", "tags": ["invoice"]},
+			"get": {"operationId": "getInvoice", "summary": "Get an invoice", "tags": ["invoice"]}
+		},
+		"/health": {"get": {"operationId": "health", "deprecated": true}}
+	},
+	"components": {"schemas": {"Invoice": {"type": "object"}, "Error": {"type": "object"}}}
+}`
+
+const swagger2Spec = `{
+	"swagger": "2.0",
+	"info": {"title": "Pets", "version": "1"},
+	"host": "petstore.io",
+	"basePath": "/v2",
+	"schemes": ["https", "http"],
+	"paths": {"/pets": {"post": {"operationId": "addPet"}}},
+	"definitions": {"Pet": {"type": "object"}}
+}`
+
+func Test_parseOpenAPI3Document(t *testing.T) {
+	doc, err := ParseDocument([]byte(oas3Spec))
+	check("parse", t, err)
+	if doc.Title != "Invoices" || doc.Version != "1.2.0" || doc.Description != "Handles invoices" {
+		t.Errorf("unexpected info %s %s %s", doc.Title, doc.Version, doc.Description)
+	}
+	if doc.IsSwagger2() {
+		t.Errorf("expected openapi 3 document, got %s", doc.SpecVersion)
+	}
+	if len(doc.Servers) != 1 || doc.Servers[0] != "http://invoices:8080/api" {
+		t.Errorf("unexpected servers %v", doc.Servers)
+	}
+	if len(doc.Tags) != 1 || doc.Tags[0].Name != "invoice" {
+		t.Errorf("unexpected tags %v", doc.Tags)
+	}
+	expectedOps := []string{"health", "getInvoice", "deleteInvoice"}
+	if len(doc.Operations) != len(expectedOps) {
+		t.Fatalf("unexpected operations %v", doc.Operations)
+	}
+	for i, id := range expectedOps {
+		if doc.Operations[i].OperationID != id {
+			t.Errorf("unexpected operation %v in position %d, expected %s", doc.Operations[i], i, id)
+		}
+	}
+	if !doc.Operations[0].Deprecated {
+		t.Errorf("expected health operation to be deprecated")
+	}
+	if len(doc.Schemas) != 2 || doc.Schemas[0] != "Error" || doc.Schemas[1] != "Invoice" {
+		t.Errorf("unexpected schemas %v", doc.Schemas)
+	}
+}
+
+func Test_parseSwagger2Document(t *testing.T) {
+	doc, err := ParseDocument([]byte(swagger2Spec))
+	check("parse", t, err)
+	if !doc.IsSwagger2() {
+		t.Errorf("expected swagger 2 document, got %s", doc.SpecVersion)
+	}
+	if len(doc.Servers) != 2 || doc.Servers[0] != "https://petstore.io/v2" || doc.Servers[1] != "http://petstore.io/v2" {
+		t.Errorf("unexpected servers %v", doc.Servers)
+	}
+	if len(doc.Operations) != 1 || doc.Operations[0].Method != "post" || doc.Operations[0].Path != "/pets" {
+		t.Errorf("unexpected operations %v", doc.Operations)
+	}
+	if len(doc.Schemas) != 1 || doc.Schemas[0] != "Pet" {
+		t.Errorf("unexpected schemas %v", doc.Schemas)
+	}
+}
+
+func Test_parseUnsupportedDocument(t *testing.T) {
+	if _, err := ParseDocument([]byte(`{"ID": "123"}`)); err == nil {
+		t.Errorf("expected error when parsing document without a version")
+	}
+}
+
+type countingSpec struct {
+	calls int
+	err   error
+}
+
+func (c *countingSpec) Get() ([]byte, error) {
+	c.calls++
+	return []byte(oas3Spec), c.err
+}
+
+func Test_cachedSpecReusesDocument(t *testing.T) {
+	delegate := &countingSpec{}
+	spec := Cached(delegate, time.Minute)
+	first, err := DocumentOf(spec)
+	check("first document", t, err)
+	second, err := DocumentOf(spec)
+	check("second document", t, err)
+	if first != second || delegate.calls != 1 {
+		t.Errorf("expected document to be cached, delegate called %d times", delegate.calls)
+	}
+	delegate.err = errors.New("upstream down")
+	if doc, err := DocumentOf(Cached(delegate, time.Minute)); err == nil || doc != nil {
+		t.Errorf("expected error from failing delegate, got %v", doc)
+	}
+}
@@ -0,0 +1,178 @@
+package openapi
+
+import (
+	"sync"
+)
+
+// EventType is the type of change of a key in the repository
+type EventType string
+
+// EventTypes of the repository changes
+const (
+	Added    EventType = "added"
+	Removed  EventType = "removed"
+	Replaced EventType = "replaced"
+	Changed  EventType = "changed"
+	// Resync is the last event of a subscriber that fell too far behind, it missed changes and lists the
+	// keys again
+	Resync EventType = "resync"
+)
+
+// Event is a change of a key in the repository
+type Event struct {
+	Type   EventType `json:"type"`
+	Key    string    `json:"key"`
+	Name   string    `json:"name"`
+	Source string    `json:"source"`
+	// Hash of the new content, only set on changed events
+	Hash string `json:"hash,omitempty"`
+}
+
+// Watchable is a Repository that publishes its changes to subscribers
+type Watchable interface {
+	// Subscribe returns a channel of all changes and a function to unsubscribe. The changes are queued
+	// for subscribers that fall behind, a subscriber that falls too far behind is sent a resync event
+	// and its channel is closed. The channel is closed when unsubscribing
+	Subscribe() (<-chan Event, func())
+}
+
+const (
+	// subscriberBuffer is the number of events a subscriber may still receive after unsubscribing
+	subscriberBuffer = 64
+	// subscriberQueue is the number of events queued for a subscriber before it is resynced
+	subscriberQueue = 1024
+)
+
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[*subscription]struct{}
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: make(map[*subscription]struct{})}
+}
+
+func (b *eventBroker) Subscribe() (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub := newSubscription()
+	b.subscribers[sub] = struct{}{}
+	return sub.events, func() {
+		b.mu.Lock()
+		delete(b.subscribers, sub)
+		b.mu.Unlock()
+		sub.stop()
+	}
+}
+
+// publish queues the event for every subscriber without blocking, the subscribers that fell too far
+// behind are resynced and no longer published to
+func (b *eventBroker) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		if !sub.push(event) {
+			delete(b.subscribers, sub)
+		}
+	}
+}
+
+// subscription delivers the published events in order, queueing them while the subscriber is busy. If
+// the queue overflows the queued events are dropped and the subscriber is sent a resync event instead
+type subscription struct {
+	events     chan Event
+	mu         sync.Mutex
+	queue      []Event
+	overflowed bool
+	wake       chan struct{}
+	done       chan struct{}
+	stopOnce   sync.Once
+}
+
+func newSubscription() *subscription {
+	s := &subscription{
+		events: make(chan Event, subscriberBuffer),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go s.deliver()
+	return s
+}
+
+// push queues the event, false if the queue overflowed and the subscriber is resynced instead
+func (s *subscription) push(event Event) bool {
+	s.mu.Lock()
+	if len(s.queue) < subscriberQueue {
+		s.queue = append(s.queue, event)
+	} else {
+		s.queue, s.overflowed = nil, true
+	}
+	overflowed := s.overflowed
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return !overflowed
+}
+
+func (s *subscription) stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *subscription) deliver() {
+	defer close(s.events)
+	var pending []Event
+	for {
+		s.mu.Lock()
+		overflowed := s.overflowed
+		if len(pending) == 0 {
+			pending, s.queue = s.queue, nil
+		}
+		s.mu.Unlock()
+		if overflowed {
+			select {
+			case s.events <- Event{Type: Resync}:
+			case <-s.done:
+			}
+			return
+		}
+		if len(pending) == 0 {
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				s.flush(nil)
+				return
+			}
+		}
+		select {
+		case s.events <- pending[0]:
+			pending = pending[1:]
+		case <-s.done:
+			s.flush(pending)
+			return
+		}
+	}
+}
+
+// flush the remaining events into the buffer of the channel after unsubscribing, without blocking
+func (s *subscription) flush(pending []Event) {
+	s.mu.Lock()
+	pending = append(pending, s.queue...)
+	s.queue = nil
+	s.mu.Unlock()
+	for _, event := range pending {
+		select {
+		case s.events <- event:
+		default:
+			return
+		}
+	}
+}
+
+func eventOf(eventType EventType, meta SpecMetadata) Event {
+	return Event{Type: eventType, Key: meta.Key, Name: meta.Name, Source: meta.Source}
+}
@@ -0,0 +1,138 @@
+package openapi
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func event(eventType EventType, key, source string) Event {
+	return Event{Type: eventType, Key: key, Name: key, Source: source}
+}
+
+func Test_changesArePublished(t *testing.T) {
+	r := NewCachedRepository()
+	events, unsubscribe := r.(Watchable).Subscribe()
+	check("put", t, r.Put("s1", "a", rndSpec()))
+	check("put again", t, r.Put("s1", "a", rndSpec()))
+	r.ReplaceAllOf("s2", map[string]Spec{"b": rndSpec(), "c": rndSpec()})
+	r.ReplaceAllOf("s2", map[string]Spec{"b": rndSpec()})
+	check("remove", t, r.Remove("s1", "a"))
+	r.RemoveAllOf("s2")
+	expected := []Event{
+		event(Added, "a", "s1"),
+		event(Replaced, "a", "s1"),
+		event(Added, "b", "s2"),
+		event(Added, "c", "s2"),
+		event(Replaced, "b", "s2"),
+		event(Removed, "c", "s2"),
+		event(Removed, "a", "s1"),
+		event(Removed, "b", "s2"),
+	}
+	unsubscribe()
+	received := make([]Event, 0)
+	for e := range events {
+		received = append(received, e)
+	}
+	if len(received) != len(expected) {
+		t.Fatalf("unexpected events %v, expected %v", received, expected)
+	}
+	// the order within a replace all is not deterministic
+	for i, e := range expected {
+		if i == 2 || i == 3 {
+			if received[2] != e && received[3] != e {
+				t.Errorf("expected event %v in position 2 or 3, got %v", e, received[2:4])
+			}
+			continue
+		}
+		if received[i] != e {
+			t.Errorf("unexpected event %v in position %d, expected %v", received[i], i, e)
+		}
+	}
+}
+
+func Test_slowSubscribersReceiveAllEvents(t *testing.T) {
+	r := NewCachedRepository()
+	events, unsubscribe := r.(Watchable).Subscribe()
+	defer unsubscribe()
+	specs := make(map[string]Spec)
+	for i := 0; i < 3*subscriberBuffer; i++ {
+		specs[fmt.Sprintf("key-%d", i)] = rndSpec()
+	}
+	r.ReplaceAllOf("s1", specs)
+	r.RemoveAllOf("s1")
+	for i := 0; i < 2*len(specs); i++ {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				t.Fatalf("expected the subscription to stay open, closed after %d events", i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after %d of %d events", i, 2*len(specs))
+		}
+	}
+	select {
+	case e := <-events:
+		t.Errorf("expected no more events, got %v", e)
+	default:
+	}
+}
+
+func Test_stalledSubscribersAreResynced(t *testing.T) {
+	broker := newEventBroker()
+	stalled, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+	published := 3 * subscriberQueue
+	for i := 0; i < published; i++ {
+		broker.publish(event(Added, fmt.Sprintf("key-%d", i), "s1"))
+	}
+	received := 0
+	var last Event
+	for e := range stalled {
+		received, last = received+1, e
+	}
+	if last.Type != Resync || received >= published {
+		t.Errorf("expected the stalled subscriber to be resynced, got %d events ending with %v", received, last)
+	}
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if len(broker.subscribers) != 0 {
+		t.Errorf("expected the resynced subscriber to no longer be published to, got %d", len(broker.subscribers))
+	}
+}
+
+func Test_contentChangesArePublished(t *testing.T) {
+	t.Run("with history", func(t *testing.T) {
+		testContentChangesArePublished(t, NewCachedRepository(WithHistory(NewMemoryHistory(5))))
+	})
+	t.Run("without history", func(t *testing.T) {
+		testContentChangesArePublished(t, NewCachedRepository())
+	})
+}
+
+func testContentChangesArePublished(t *testing.T, r SpecRepoStore) {
+	upstream := &mutableSpec{content: "v1"}
+	check("put", t, r.Put("s1", "a", upstream))
+	events, unsubscribe := r.(Watchable).Subscribe()
+	spec, err := r.Spec("a")
+	check("spec", t, err)
+	get := func() {
+		_, err := spec.Get()
+		check("get", t, err)
+	}
+	get()
+	get()
+	upstream.content = "v2"
+	get()
+	get()
+	unsubscribe()
+	received := make([]Event, 0)
+	for e := range events {
+		received = append(received, e)
+	}
+	changed := event(Changed, "a", "s1")
+	changed.Hash = ContentHash([]byte("v2"))
+	if len(received) != 1 || received[0] != changed {
+		t.Errorf("expected only %v, got %v", changed, received)
+	}
+}
@@ -0,0 +1,236 @@
+package openapi
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SimonSchneider/docs-prox/pkg/metrics"
+)
+
+// FetcherOptions configure how remote specs are fetched
+type FetcherOptions struct {
+	// ConnectTimeout of establishing the connection, including the TLS handshake
+	ConnectTimeout time.Duration
+	// ReadTimeout of receiving the response once connected
+	ReadTimeout time.Duration
+	// Retries of a fetch failing with a network error, 5xx or 429 response
+	Retries int
+	// Backoff before the first retry, doubled for every following retry
+	Backoff time.Duration
+	// MaxBodySize in bytes of a spec, larger specs are rejected
+	MaxBodySize int64
+	// Auth are the named profiles of credentials the specs can be fetched with
+	Auth map[string]AuthProfile
+}
+
+// DefaultFetcherOptions are used by NewRemoteSpec
+var DefaultFetcherOptions = FetcherOptions{
+	ConnectTimeout: 5 * time.Second,
+	ReadTimeout:    30 * time.Second,
+	Retries:        2,
+	Backoff:        500 * time.Millisecond,
+	MaxBodySize:    10 << 20,
+}
+
+// Fetcher fetches remote specs, only successful responses are accepted as specs
+type Fetcher struct {
+	client *http.Client
+	opts   FetcherOptions
+	auth   map[string]*upstreamAuth
+}
+
+// NewFetcher creates a fetcher with the options, failing if the TLS files of an auth profile cannot be loaded
+func NewFetcher(opts FetcherOptions) (*Fetcher, error) {
+	auth := make(map[string]*upstreamAuth, len(opts.Auth))
+	for name, profile := range opts.Auth {
+		a, err := newUpstreamAuth(profile, opts)
+		if err != nil {
+			return nil, fmt.Errorf("remoteSpec: invalid auth profile %s: %w", name, err)
+		}
+		auth[name] = a
+	}
+	return &Fetcher{client: newClient(opts, nil), opts: opts, auth: auth}, nil
+}
+
+func newClient(opts FetcherOptions, tlsConfig *tls.Config) *http.Client {
+	dialer := &net.Dialer{Timeout: opts.ConnectTimeout}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		ResponseHeaderTimeout: opts.ReadTimeout,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &http.Client{Transport: transport}
+}
+
+var defaultFetcher = &Fetcher{client: newClient(DefaultFetcherOptions, nil), opts: DefaultFetcherOptions}
+
+// DefaultFetcher returns the fetcher with the DefaultFetcherOptions
+func DefaultFetcher() *Fetcher {
+	return defaultFetcher
+}
+
+// Spec returns a spec fetched from the url. Unchanged specs are not downloaded again, the spec is
+// requested with the ETag and Last-Modified of the previous response
+func (f *Fetcher) Spec(url string) Spec {
+	return &remoteSpec{fetcher: f, url: url}
+}
+
+// SpecWithAuth returns a spec fetched from the url with the credentials of the auth profile,
+// without credentials if profile is empty
+func (f *Fetcher) SpecWithAuth(url, profile string) (Spec, error) {
+	if profile == "" {
+		return f.Spec(url), nil
+	}
+	auth, ok := f.auth[profile]
+	if !ok {
+		return nil, &UnknownAuthProfileError{Profile: profile}
+	}
+	return &remoteSpec{fetcher: f, auth: auth, url: url}, nil
+}
+
+// UpstreamError is returned when the upstream of a spec responds with a non-2xx status
+type UpstreamError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("upstream %s responded with %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+type validators struct {
+	etag, lastModified string
+}
+
+// fetch the url, retrying with an exponential backoff on network errors, 5xx and 429 responses.
+// Returns nil content if it was not modified since the validators
+func (f *Fetcher) fetch(url string, auth *upstreamAuth, cached validators) ([]byte, validators, error) {
+	backoff := f.opts.Backoff
+	for attempt := 0; ; attempt++ {
+		content, current, retry, err := f.fetchOnce(url, auth, cached)
+		if err == nil || !retry || attempt >= f.opts.Retries {
+			return content, current, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (f *Fetcher) fetchOnce(url string, auth *upstreamAuth, cached validators) ([]byte, validators, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, cached, false, fmt.Errorf("invalid url %s: %w", url, err)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, cached, false, fmt.Errorf("invalid url %s: scheme must be http or https", url)
+	}
+	if f.opts.ConnectTimeout > 0 && f.opts.ReadTimeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), f.opts.ConnectTimeout+f.opts.ReadTimeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	if cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	if cached.lastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.lastModified)
+	}
+	client := f.client
+	if auth != nil {
+		if err := auth.authenticate(req); err != nil {
+			return nil, cached, true, err
+		}
+		client = auth.client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		metrics.UpstreamResponses.WithLabelValues("error").Inc()
+		return nil, cached, true, err
+	}
+	defer resp.Body.Close()
+	metrics.UpstreamResponses.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	if resp.StatusCode == http.StatusNotModified && (cached.etag != "" || cached.lastModified != "") {
+		return nil, cached, false, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		if auth != nil && resp.StatusCode == http.StatusUnauthorized {
+			auth.rejected()
+		}
+		return nil, cached, retry, &UpstreamError{URL: url, StatusCode: resp.StatusCode}
+	}
+	content, err := f.read(resp)
+	if err != nil {
+		return nil, cached, false, err
+	}
+	return content, validators{etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified")}, false, nil
+}
+
+// read the body of the response, rejecting bodies larger than the max body size
+func (f *Fetcher) read(resp *http.Response) ([]byte, error) {
+	if f.opts.MaxBodySize <= 0 {
+		return ioutil.ReadAll(resp.Body)
+	}
+	if resp.ContentLength > f.opts.MaxBodySize {
+		return nil, fmt.Errorf("spec of %d bytes exceeds the max size of %d bytes", resp.ContentLength, f.opts.MaxBodySize)
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, f.opts.MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > f.opts.MaxBodySize {
+		return nil, fmt.Errorf("spec exceeds the max size of %d bytes", f.opts.MaxBodySize)
+	}
+	return content, nil
+}
+
+type remoteSpec struct {
+	fetcher    *Fetcher
+	auth       *upstreamAuth
+	url        string
+	mu         sync.Mutex
+	validators validators
+	content    []byte
+}
+
+// NewRemoteSpec creates a spec that is proxied from a remote url with the default fetcher
+func NewRemoteSpec(url string) Spec {
+	return DefaultFetcher().Spec(url)
+}
+
+// Origin is the url the spec is fetched from
+func (s *remoteSpec) Origin() string {
+	return s.url
+}
+
+func (s *remoteSpec) Get() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, current, err := s.fetcher.fetch(s.url, s.auth, s.validators)
+	if err != nil {
+		return nil, fmt.Errorf("remoteSpec: unable to fetch spec from %s: %w", s.url, err)
+	}
+	if content == nil {
+		return s.content, nil
+	}
+	s.validators = current
+	if current.etag != "" || current.lastModified != "" {
+		s.content = content
+	} else {
+		s.content = nil
+	}
+	return content, nil
+}
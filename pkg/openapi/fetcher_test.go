@@ -0,0 +1,76 @@
+package openapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type upstream struct {
+	mu       sync.Mutex
+	statuses []int
+	requests int
+	notMod   int
+}
+
+func (u *upstream) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.requests++
+	if len(u.statuses) > 0 {
+		status := u.statuses[0]
+		u.statuses = u.statuses[1:]
+		rw.WriteHeader(status)
+		_, _ = rw.Write([]byte("<html>error</html>"))
+		return
+	}
+	if r.Header.Get("If-None-Match") == `"v1"` {
+		u.notMod++
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	rw.Header().Set("ETag", `"v1"`)
+	_, _ = rw.Write([]byte(`{"openapi":"3.0.0"}`))
+}
+
+func testFetcher(maxBodySize int64) *Fetcher {
+	f, _ := NewFetcher(FetcherOptions{ConnectTimeout: time.Second, ReadTimeout: time.Second, Retries: 2, Backoff: time.Millisecond, MaxBodySize: maxBodySize})
+	return f
+}
+
+func TestFetcherRetriesAndRevalidatesWithETag(t *testing.T) {
+	u := &upstream{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	server := httptest.NewServer(u)
+	defer server.Close()
+	spec := testFetcher(1024).Spec(server.URL)
+	for i := 0; i < 2; i++ {
+		b, err := spec.Get()
+		if err != nil || string(b) != `{"openapi":"3.0.0"}` {
+			t.Fatalf("expected the spec, got %s, %v", b, err)
+		}
+	}
+	if u.requests != 4 || u.notMod != 1 {
+		t.Errorf("expected 2 retries and 1 conditional request, got %d requests and %d not modified", u.requests, u.notMod)
+	}
+}
+
+func TestFetcherRejectsErrorResponsesAndLargeSpecs(t *testing.T) {
+	u := &upstream{statuses: []int{http.StatusNotFound}}
+	server := httptest.NewServer(u)
+	defer server.Close()
+	_, err := testFetcher(1024).Spec(server.URL).Get()
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) || upstreamErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a not found upstream error, got %v", err)
+	}
+	if u.requests != 1 {
+		t.Errorf("expected a 404 not to be retried, got %d requests", u.requests)
+	}
+	if _, err := testFetcher(5).Spec(server.URL).Get(); err == nil || !strings.Contains(err.Error(), "max size") {
+		t.Errorf("expected the spec to exceed the max size, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package openapi
+
+import (
+	"path"
+)
+
+// GroupLabel groups the specs in the listing, ie. by the namespace of a kubernetes service
+const GroupLabel = "docs-prox/group"
+
+type labeledSpec struct {
+	delegate Spec
+	labels   map[string]string
+}
+
+// WithLabels returns a spec that carries the given labels, ie. the labels of a kubernetes service
+func WithLabels(delegate Spec, labels map[string]string) Spec {
+	return &labeledSpec{delegate: delegate, labels: labels}
+}
+
+func (s *labeledSpec) Get() ([]byte, error) {
+	return s.delegate.Get()
+}
+
+func (s *labeledSpec) Unwrap() Spec {
+	return s.delegate
+}
+
+func (s *labeledSpec) Labels() map[string]string {
+	return s.labels
+}
+
+type labeler interface {
+	Labels() map[string]string
+}
+
+// LabelsOf returns the labels of the spec, nil if it has none
+func LabelsOf(spec Spec) map[string]string {
+	for ; spec != nil; spec = unwrap(spec) {
+		if l, ok := spec.(labeler); ok {
+			return l.Labels()
+		}
+	}
+	return nil
+}
+
+// MetadataFilter selects specs by key, source and labels. Keys are matched as glob patterns,
+// a spec matches if it matches any of the keys, any of the sources and all of the labels.
+// Empty fields match everything
+type MetadataFilter struct {
+	Keys    []string          `json:"keys"`
+	Sources []string          `json:"sources"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// Matches is true if the spec metadata is selected by the filter
+func (f MetadataFilter) Matches(meta SpecMetadata) bool {
+	if len(f.Keys) > 0 && !matchesAny(f.Keys, meta.Key) {
+		return false
+	}
+	if len(f.Sources) > 0 && !matchesAny(f.Sources, meta.Source) {
+		return false
+	}
+	for k, v := range f.Labels {
+		if actual, ok := meta.Labels[k]; !ok || actual != v {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if ok, err := path.Match(p, value); p == value || err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
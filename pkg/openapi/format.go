@@ -0,0 +1,116 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Format is the serialization format of a spec
+type Format string
+
+// Supported spec formats
+const (
+	JSON Format = "json"
+	YAML Format = "yaml"
+)
+
+var contentTypes = map[string]Format{
+	"application/json":   JSON,
+	"application/yaml":   YAML,
+	"application/x-yaml": YAML,
+	"text/yaml":          YAML,
+	"text/x-yaml":        YAML,
+}
+
+// ContentType is the canonical content type of the format
+func (f Format) ContentType() string {
+	if f == YAML {
+		return "application/yaml"
+	}
+	return "application/json"
+}
+
+// ParseFormat parses the name of a format
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "json":
+		return JSON, nil
+	case "yaml", "yml":
+		return YAML, nil
+	}
+	return "", fmt.Errorf("format: unsupported format %s", name)
+}
+
+// DetectFormat detects the format of a serialized spec, anything that is not a json object
+// or array is considered yaml
+func DetectFormat(data []byte) Format {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return JSON
+	}
+	return YAML
+}
+
+// ConvertFormat converts the serialized spec to the given format
+func ConvertFormat(data []byte, to Format) ([]byte, error) {
+	from := DetectFormat(data)
+	if from == to {
+		return data, nil
+	}
+	var converted []byte
+	var err error
+	switch to {
+	case JSON:
+		converted, err = yaml.YAMLToJSON(data)
+	case YAML:
+		converted, err = yaml.JSONToYAML(data)
+	default:
+		return nil, fmt.Errorf("format: unsupported format %s", to)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("format: unable to convert from %s to %s: %w", from, to, err)
+	}
+	return converted, nil
+}
+
+// NegotiateFormat picks the format out of an Accept header, ordered by quality, falls back to
+// the given format when no supported format is accepted
+func NegotiateFormat(accept string, fallback Format) Format {
+	type mediaRange struct {
+		format Format
+		q      float64
+	}
+	ranges := make([]mediaRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		format, ok := contentTypes[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{format: format, q: q})
+		}
+	}
+	if len(ranges) == 0 {
+		return fallback
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	return ranges[0].format
+}
@@ -0,0 +1,68 @@
+package openapi
+
+import (
+	"testing"
+)
+
+const yamlSpec = `
+openapi: 3.0.0
+info:
+  title: Yaml
+  version: "1"
+paths:
+  /yaml:
+    get:
+      operationId: getYaml
+`
+
+func Test_detectFormat(t *testing.T) {
+	tests := []struct {
+		data   string
+		format Format
+	}{
+		{oas3Spec, JSON},
+		{"  \n[]", JSON},
+		{yamlSpec, YAML},
+		{"", YAML},
+	}
+	for _, tt := range tests {
+		if f := DetectFormat([]byte(tt.data)); f != tt.format {
+			t.Errorf("detected %s expected %s for %s", f, tt.format, tt.data)
+		}
+	}
+}
+
+func Test_convertFormatRoundTrip(t *testing.T) {
+	asJSON, err := ConvertFormat([]byte(yamlSpec), JSON)
+	check("yaml to json", t, err)
+	if DetectFormat(asJSON) != JSON {
+		t.Errorf("expected json after conversion, got %s", asJSON)
+	}
+	asYAML, err := ConvertFormat(asJSON, YAML)
+	check("json to yaml", t, err)
+	doc, err := ParseDocument(asYAML)
+	check("parse yaml", t, err)
+	if doc.Title != "Yaml" || len(doc.Operations) != 1 || doc.Operations[0].OperationID != "getYaml" {
+		t.Errorf("unexpected document after round trip %v", doc)
+	}
+}
+
+func Test_negotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept   string
+		fallback Format
+		expected Format
+	}{
+		{"", YAML, YAML},
+		{"*/*", JSON, JSON},
+		{"application/yaml", JSON, YAML},
+		{"application/json,*/*", YAML, JSON},
+		{"application/json;q=0.5, text/yaml", JSON, YAML},
+		{"application/yaml;q=0, application/json", YAML, JSON},
+	}
+	for _, tt := range tests {
+		if f := NegotiateFormat(tt.accept, tt.fallback); f != tt.expected {
+			t.Errorf("negotiated %s expected %s for '%s'", f, tt.expected, tt.accept)
+		}
+	}
+}
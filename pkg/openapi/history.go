@@ -0,0 +1,128 @@
+package openapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Version is a snapshot of the content served under a key
+type Version struct {
+	ID        string    `json:"id"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+	Source    string    `json:"source"`
+	Size      int       `json:"size"`
+	// Changes and BreakingChanges compared to the previous version, if both could be parsed
+	Changes         int `json:"changes,omitempty"`
+	BreakingChanges int `json:"breakingChanges,omitempty"`
+}
+
+// HistoryStore stores a bounded history of versions per key
+type HistoryStore interface {
+	// Record stores a new version of the key, evicting the oldest versions above the bound
+	Record(key string, version Version, content []byte) error
+	// Versions of the key, newest first
+	Versions(key string) ([]Version, error)
+	// Content of the version with id of the key
+	Content(key, id string) ([]byte, error)
+}
+
+// Versioned is a Repository that keeps the history of its specs
+type Versioned interface {
+	History() HistoryStore
+}
+
+// VersionNotFoundError is returned when a version of a key is not found
+type VersionNotFoundError struct {
+	Key string
+	ID  string
+}
+
+func (e VersionNotFoundError) Error() string {
+	return fmt.Sprintf("history: version %s of %s not found", e.ID, e.Key)
+}
+
+// ContentHash is the hex encoded sha256 hash of the content
+func ContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// versionOf creates a version of the content, the id is derived from the content hash
+func versionOf(source string, content []byte) Version {
+	hash := ContentHash(content)
+	return Version{ID: hash[:12], Hash: hash, Timestamp: time.Now(), Source: source, Size: len(content)}
+}
+
+// recordVersion stores the content as the newest version of the key unless it already is, true if the
+// content replaced a previous version
+func recordVersion(store HistoryStore, key, source string, content []byte) (Version, bool, error) {
+	version := versionOf(source, content)
+	versions, err := store.Versions(key)
+	if err == nil && len(versions) > 0 && versions[0].Hash == version.Hash {
+		return versions[0], false, nil
+	}
+	hasPrevious := err == nil && len(versions) > 0
+	if hasPrevious {
+		if previous, err := store.Content(key, versions[0].ID); err == nil {
+			if diff, err := DiffContents(previous, content); err == nil {
+				version.Changes, version.BreakingChanges = len(diff.Changes), diff.Breaking
+			}
+		}
+	}
+	if err := store.Record(key, version, content); err != nil {
+		return version, false, fmt.Errorf("unable to record version %s: %w", version.ID, err)
+	}
+	return version, hasPrevious, nil
+}
+
+type versionContent struct {
+	Version
+	content []byte
+}
+
+type memoryHistory struct {
+	mu          sync.RWMutex
+	maxVersions int
+	versions    map[string][]versionContent
+}
+
+// NewMemoryHistory creates a history store that keeps at most maxVersions per key in memory
+func NewMemoryHistory(maxVersions int) HistoryStore {
+	return &memoryHistory{maxVersions: maxVersions, versions: make(map[string][]versionContent)}
+}
+
+func (m *memoryHistory) Record(key string, version Version, content []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	versions := append([]versionContent{{Version: version, content: content}}, m.versions[key]...)
+	if len(versions) > m.maxVersions {
+		versions = versions[:m.maxVersions]
+	}
+	m.versions[key] = versions
+	return nil
+}
+
+func (m *memoryHistory) Versions(key string) ([]Version, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	versions := make([]Version, 0, len(m.versions[key]))
+	for _, v := range m.versions[key] {
+		versions = append(versions, v.Version)
+	}
+	return versions, nil
+}
+
+func (m *memoryHistory) Content(key, id string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, v := range m.versions[key] {
+		if v.ID == id {
+			return v.content, nil
+		}
+	}
+	return nil, VersionNotFoundError{Key: key, ID: id}
+}
@@ -0,0 +1,102 @@
+package openapi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type mutableSpec struct {
+	content string
+}
+
+func (m *mutableSpec) Get() ([]byte, error) {
+	return []byte(m.content), nil
+}
+
+func testHistoryStore(t *testing.T, store HistoryStore) {
+	upstream := &mutableSpec{content: "v1"}
+	repo := NewCachedRepository(WithHistory(store))
+	check("put", t, repo.Put("source", "key", upstream))
+	spec, err := repo.Spec("key")
+	check("spec", t, err)
+	get := func() {
+		if _, err := spec.Get(); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	get()
+	get()
+	upstream.content = "v2"
+	get()
+	upstream.content = "v3"
+	get()
+	get()
+	versions, err := store.Versions("key")
+	check("versions", t, err)
+	if len(versions) != 2 {
+		t.Fatalf("expected versions to be bounded to 2, got %v", versions)
+	}
+	if versions[0].Hash != ContentHash([]byte("v3")) || versions[1].Hash != ContentHash([]byte("v2")) {
+		t.Errorf("expected newest versions first, got %v", versions)
+	}
+	if versions[0].Source != "source" || versions[0].Size != 2 {
+		t.Errorf("unexpected version metadata %v", versions[0])
+	}
+	content, err := store.Content("key", versions[1].ID)
+	check("content", t, err)
+	if string(content) != "v2" {
+		t.Errorf("unexpected content %s", content)
+	}
+	if _, err := store.Content("key", versionOf("", []byte("v1")).ID); err == nil {
+		t.Errorf("expected evicted version to be gone")
+	}
+	restarted := NewCachedRepository(WithHistory(store))
+	check("put", t, restarted.Put("source", "key", upstream))
+	spec, err = restarted.Spec("key")
+	check("spec", t, err)
+	if _, err := spec.Get(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if versions, _ := store.Versions("key"); len(versions) != 2 || versions[0].Hash != ContentHash([]byte("v3")) {
+		t.Errorf("expected unchanged content to not be recorded again, got %v", versions)
+	}
+}
+
+func Test_memoryHistory(t *testing.T) {
+	testHistoryStore(t, NewMemoryHistory(2))
+}
+
+func Test_diskHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	check("tempdir", t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewDiskHistory(dir, 2)
+	check("disk history", t, err)
+	testHistoryStore(t, store)
+	reopened, err := NewDiskHistory(dir, 2)
+	check("reopen disk history", t, err)
+	if versions, err := reopened.Versions("key"); err != nil || len(versions) != 2 {
+		t.Errorf("expected versions to survive reopening, got %v %v", versions, err)
+	}
+}
+
+func Test_diskHistoryKeepsKeysInItsDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	check("tempdir", t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewDiskHistory(filepath.Join(dir, "history"), 2)
+	check("disk history", t, err)
+	for _, key := range []string{"..", ".", "../escaped", "a/b"} {
+		check("record", t, store.Record(key, versionOf("s1", []byte(key)), []byte(key)))
+		if content, err := store.Content(key, versionOf("s1", []byte(key)).ID); err != nil || string(content) != key {
+			t.Errorf("expected the content of %s, got %s %v", key, content, err)
+		}
+	}
+	entries, err := ioutil.ReadDir(dir)
+	check("read dir", t, err)
+	if len(entries) != 1 || entries[0].Name() != "history" {
+		t.Errorf("expected nothing to be written outside of the history directory, got %v", entries)
+	}
+}
@@ -0,0 +1,352 @@
+package openapi
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Severity of a lint problem
+type Severity string
+
+// Severities of the lint problems, from the most to the least severe
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+	// SeverityOff disables a rule
+	SeverityOff Severity = "off"
+)
+
+// ParseSeverity parses the name of a severity
+func ParseSeverity(name string) (Severity, error) {
+	switch s := Severity(strings.ToLower(name)); s {
+	case SeverityError, SeverityWarning, SeverityInfo, SeverityOff:
+		return s, nil
+	}
+	return "", fmt.Errorf("lint: unknown severity %s", name)
+}
+
+// penalty is subtracted from the score of a spec for every problem of the severity
+func (s Severity) penalty() int {
+	switch s {
+	case SeverityError:
+		return 10
+	case SeverityWarning:
+		return 3
+	case SeverityInfo:
+		return 1
+	}
+	return 0
+}
+
+// LintProblem is a single problem found by a lint rule
+type LintProblem struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Pointer  string   `json:"pointer"`
+	Message  string   `json:"message"`
+}
+
+// LintReport are the problems of a spec and its score, 100 for a spec without problems
+type LintReport struct {
+	Score    int           `json:"score"`
+	Errors   int           `json:"errors"`
+	Warnings int           `json:"warnings"`
+	Infos    int           `json:"infos"`
+	Problems []LintProblem `json:"problems"`
+}
+
+// HasProblems is true if the report has any problem at least as severe as the severity
+func (r *LintReport) HasProblems(severity Severity) bool {
+	switch severity {
+	case SeverityError:
+		return r.Errors > 0
+	case SeverityWarning:
+		return r.Errors+r.Warnings > 0
+	case SeverityInfo:
+		return len(r.Problems) > 0
+	}
+	return false
+}
+
+// LintRule checks the raw spec and reports its problems. Custom rules are added with NewLinter
+type LintRule struct {
+	Name        string
+	Severity    Severity
+	Description string
+	Check       func(raw map[string]interface{}, report func(pointer, message string, args ...interface{}))
+}
+
+// LintOptions override the severities of the rules by name, SeverityOff disables a rule
+type LintOptions struct {
+	Severities map[string]Severity
+}
+
+// Linter runs lint rules over specs
+type Linter struct {
+	rules []LintRule
+	mu    sync.Mutex
+	cache map[string]lintedDocument
+}
+
+type lintedDocument struct {
+	doc    *Document
+	report *LintReport
+}
+
+// NewLinter returns a linter running the rules with their severities overridden by the options
+func NewLinter(opts LintOptions, rules ...LintRule) *Linter {
+	l := &Linter{cache: make(map[string]lintedDocument)}
+	for _, rule := range rules {
+		if s, ok := opts.Severities[rule.Name]; ok {
+			rule.Severity = s
+		}
+		if rule.Severity != SeverityOff {
+			l.rules = append(l.rules, rule)
+		}
+	}
+	return l
+}
+
+// DefaultLinter runs the built in rules with their default severities
+func DefaultLinter() *Linter {
+	return NewLinter(LintOptions{}, DefaultLintRules()...)
+}
+
+// Lint the document
+func (l *Linter) Lint(doc *Document) *LintReport {
+	report := &LintReport{Score: 100, Problems: make([]LintProblem, 0)}
+	for _, rule := range l.rules {
+		rule.Check(doc.Raw, func(pointer, message string, args ...interface{}) {
+			report.Problems = append(report.Problems, LintProblem{
+				Rule: rule.Name, Severity: rule.Severity, Pointer: pointer, Message: fmt.Sprintf(message, args...),
+			})
+			report.Score -= rule.Severity.penalty()
+			switch rule.Severity {
+			case SeverityError:
+				report.Errors++
+			case SeverityWarning:
+				report.Warnings++
+			case SeverityInfo:
+				report.Infos++
+			}
+		})
+	}
+	if report.Score < 0 {
+		report.Score = 0
+	}
+	sort.SliceStable(report.Problems, func(i, j int) bool {
+		return report.Problems[i].Severity.penalty() > report.Problems[j].Severity.penalty()
+	})
+	return report
+}
+
+// LintContent parses and lints the content of a spec
+func (l *Linter) LintContent(content []byte) (*LintReport, error) {
+	doc, err := ParseDocument(content)
+	if err != nil {
+		return nil, fmt.Errorf("lint: unable to parse spec: %w", err)
+	}
+	return l.Lint(doc), nil
+}
+
+// reportOf the document of the key, reusing the last report while the document is unchanged
+func (l *Linter) reportOf(key string, doc *Document) *LintReport {
+	l.mu.Lock()
+	linted, ok := l.cache[key]
+	l.mu.Unlock()
+	if ok && linted.doc == doc {
+		return linted.report
+	}
+	report := l.Lint(doc)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cache[key] = lintedDocument{doc: doc, report: report}
+	return report
+}
+
+// DefaultLintRules are the built in lint rules
+func DefaultLintRules() []LintRule {
+	return []LintRule{
+		{Name: "operation-operationId", Severity: SeverityWarning, Description: "operations have an operationId", Check: lintOperationIDs},
+		{Name: "operation-description", Severity: SeverityWarning, Description: "operations have a summary or description", Check: lintOperationDescriptions},
+		{Name: "info-description", Severity: SeverityInfo, Description: "the spec has a description", Check: lintInfoDescription},
+		{Name: "no-undefined-refs", Severity: SeverityError, Description: "local $refs point at existing definitions", Check: lintUndefinedRefs},
+		{Name: "operationId-naming", Severity: SeverityWarning, Description: "operationIds use the same casing", Check: lintOperationIDNaming},
+		{Name: "operation-error-responses", Severity: SeverityWarning, Description: "operations document a 4xx, 5xx or default response", Check: lintErrorResponses},
+		{Name: "paths-kebab-case", Severity: SeverityWarning, Description: "path segments are kebab-case", Check: lintKebabPaths},
+	}
+}
+
+// forEachOperation calls fun with every operation of the spec in path and method order
+func forEachOperation(raw map[string]interface{}, fun func(pointer, method, path string, op map[string]interface{})) {
+	paths := objectAt(raw, "paths")
+	for _, path := range keysOf(paths) {
+		item, _ := paths[path].(map[string]interface{})
+		for _, method := range Methods {
+			if op, ok := item[method].(map[string]interface{}); ok {
+				fun(jsonPointer("paths", path, method), method, path, op)
+			}
+		}
+	}
+}
+
+func lintOperationIDs(raw map[string]interface{}, report func(pointer, message string, args ...interface{})) {
+	seen := make(map[string]string)
+	forEachOperation(raw, func(pointer, method, path string, op map[string]interface{}) {
+		id := stringAt(op, "operationId")
+		if id == "" {
+			report(pointer, "operation %s %s has no operationId", strings.ToUpper(method), path)
+			return
+		}
+		if other, ok := seen[id]; ok {
+			report(pointer+"/operationId", "operationId %s is also used by %s", id, other)
+			return
+		}
+		seen[id] = strings.ToUpper(method) + " " + path
+	})
+}
+
+func lintOperationDescriptions(raw map[string]interface{}, report func(pointer, message string, args ...interface{})) {
+	forEachOperation(raw, func(pointer, method, path string, op map[string]interface{}) {
+		if stringAt(op, "summary") == "" && stringAt(op, "description") == "" {
+			report(pointer, "operation %s %s has no summary or description", strings.ToUpper(method), path)
+		}
+	})
+}
+
+func lintInfoDescription(raw map[string]interface{}, report func(pointer, message string, args ...interface{})) {
+	if stringAt(objectAt(raw, "info"), "description") == "" {
+		report("/info", "the spec has no description")
+	}
+}
+
+func lintUndefinedRefs(raw map[string]interface{}, report func(pointer, message string, args ...interface{})) {
+	var walk func(pointer string, v interface{})
+	walk = func(pointer string, v interface{}) {
+		switch value := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := value["$ref"].(string); ok && strings.HasPrefix(ref, "#") {
+				if _, found := resolvePointer(raw, strings.TrimPrefix(ref, "#")); !found {
+					report(pointer+"/$ref", "$ref %s is not defined", ref)
+				}
+			}
+			for _, k := range keysOf(value) {
+				walk(pointer+jsonPointer(k), value[k])
+			}
+		case []interface{}:
+			for i, child := range value {
+				walk(pointer+jsonPointer(strconv.Itoa(i)), child)
+			}
+		}
+	}
+	walk("", raw)
+}
+
+// resolvePointer returns the value at the json pointer in v
+func resolvePointer(v interface{}, pointer string) (interface{}, bool) {
+	if pointer == "" {
+		return v, true
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, false
+	}
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch value := v.(type) {
+		case map[string]interface{}:
+			child, ok := value[token]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(value) {
+				return nil, false
+			}
+			v = value[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+var namingStyles = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{name: "camelCase", pattern: regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)},
+	{name: "PascalCase", pattern: regexp.MustCompile(`^[A-Z][a-zA-Z0-9]*$`)},
+	{name: "snake_case", pattern: regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)+$`)},
+	{name: "kebab-case", pattern: regexp.MustCompile(`^[a-z][a-z0-9]*(-[a-z0-9]+)+$`)},
+}
+
+// namingStyle of the name, empty if it doesn't follow any of the styles
+func namingStyle(name string) string {
+	for _, style := range namingStyles {
+		if style.pattern.MatchString(name) {
+			return style.name
+		}
+	}
+	return ""
+}
+
+// lintOperationIDNaming reports the operationIds that don't use the casing of the majority
+func lintOperationIDNaming(raw map[string]interface{}, report func(pointer, message string, args ...interface{})) {
+	type named struct{ pointer, id, style string }
+	var ids []named
+	counts := make(map[string]int)
+	forEachOperation(raw, func(pointer, method, path string, op map[string]interface{}) {
+		if id := stringAt(op, "operationId"); id != "" {
+			style := namingStyle(id)
+			ids = append(ids, named{pointer: pointer + "/operationId", id: id, style: style})
+			if style != "" {
+				counts[style]++
+			}
+		}
+	})
+	majority := ""
+	for _, style := range namingStyles {
+		if counts[style.name] > counts[majority] {
+			majority = style.name
+		}
+	}
+	for _, n := range ids {
+		if n.style != majority {
+			report(n.pointer, "operationId %s is not %s like the other operationIds", n.id, majority)
+		}
+	}
+}
+
+func lintErrorResponses(raw map[string]interface{}, report func(pointer, message string, args ...interface{})) {
+	forEachOperation(raw, func(pointer, method, path string, op map[string]interface{}) {
+		for code := range objectAt(op, "responses") {
+			if code == "default" || strings.HasPrefix(code, "4") || strings.HasPrefix(code, "5") {
+				return
+			}
+		}
+		report(pointer+"/responses", "operation %s %s documents no error response", strings.ToUpper(method), path)
+	})
+}
+
+var kebabSegment = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*(\.[a-z0-9]+)?$`)
+
+func lintKebabPaths(raw map[string]interface{}, report func(pointer, message string, args ...interface{})) {
+	for _, path := range keysOf(objectAt(raw, "paths")) {
+		for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+			if segment == "" || strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				continue
+			}
+			if !kebabSegment.MatchString(segment) {
+				report(jsonPointer("paths", path), "segment %s of path %s is not kebab-case", segment, path)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const lintTestSpec = `{
+  "openapi": "3.0.3",
+  "info": {"title": "pets", "version": "1"},
+  "paths": {
+    "/pets": {
+      "get": {"operationId": "listPets", "summary": "list", "responses": {"200": {"$ref": "#/components/responses/Pets"}, "default": {"description": "error"}}},
+      "post": {"operationId": "createPet", "responses": {"201": {"description": "created"}}}
+    },
+    "/petOwners/{ownerId}": {
+      "get": {"operationId": "get_owner", "summary": "owner", "responses": {"404": {"description": "not found"}}},
+      "put": {"summary": "update", "responses": {"400": {"description": "invalid"}}}
+    }
+  },
+  "components": {"responses": {"Pet": {"description": "a pet"}}}
+}`
+
+func TestLintBuiltInRules(t *testing.T) {
+	report, err := DefaultLinter().LintContent([]byte(lintTestSpec))
+	check("lint", t, err)
+	expected := map[string]Severity{
+		"no-undefined-refs@/paths/~1pets/get/responses/200/$ref":           SeverityError,
+		"operation-description@/paths/~1pets/post":                         SeverityWarning,
+		"operation-error-responses@/paths/~1pets/post/responses":           SeverityWarning,
+		"operation-operationId@/paths/~1petOwners~1{ownerId}/put":          SeverityWarning,
+		"operationId-naming@/paths/~1petOwners~1{ownerId}/get/operationId": SeverityWarning,
+		"paths-kebab-case@/paths/~1petOwners~1{ownerId}":                   SeverityWarning,
+		"info-description@/info":                                           SeverityInfo,
+	}
+	actual := make(map[string]Severity, len(report.Problems))
+	for _, p := range report.Problems {
+		actual[p.Rule+"@"+p.Pointer] = p.Severity
+	}
+	for problem, severity := range expected {
+		if actual[problem] != severity {
+			t.Errorf("expected %s to be reported as %s, got %v", problem, severity, report.Problems)
+		}
+	}
+	if len(actual) != len(expected) || report.Score != 100-10-5*3-1 || report.Problems[0].Severity != SeverityError {
+		t.Errorf("expected only the %d problems ordered by severity with score 74, got %d with %v", len(expected), report.Score, report.Problems)
+	}
+
+	linter := NewLinter(LintOptions{Severities: map[string]Severity{"no-undefined-refs": SeverityOff, "info-description": SeverityError}}, DefaultLintRules()...)
+	report, err = linter.LintContent([]byte(lintTestSpec))
+	check("lint", t, err)
+	if report.Errors != 1 || report.Problems[0].Rule != "info-description" || !report.HasProblems(SeverityError) {
+		t.Errorf("expected the severities to be overridden, got %v", report.Problems)
+	}
+}
+
+func TestLintEndpointAndListingScore(t *testing.T) {
+	r := NewCachedRepository()
+	check("put", t, r.Put("s1", "pets", Cached(testSpec(lintTestSpec), time.Minute)))
+	router := mux.NewRouter()
+	for _, fun := range []repoHandlerFunc{keyHandler(DefaultLinter()), lintHandler(DefaultLinter())} {
+		path, handler := fun(r)
+		router.Handle("/docs"+path, handler)
+	}
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/docs/pets/lint", nil))
+	var report LintReport
+	check("decode report", t, json.NewDecoder(rw.Body).Decode(&report))
+	if rw.Code != http.StatusOK || report.Score != 74 || len(report.Problems) != 7 {
+		t.Errorf("expected the lint report of the spec, got %d %v", rw.Code, report)
+	}
+	rw = httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+	var keys []KeyUrls
+	check("decode keys", t, json.NewDecoder(rw.Body).Decode(&keys))
+	if len(keys) != 1 || keys[0].LintScore == nil || *keys[0].LintScore != 74 {
+		t.Errorf("expected the listing to contain the lint score, got %v", keys)
+	}
+}
@@ -0,0 +1,230 @@
+package openapi
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// MergeConflict is a part of a spec that could not be merged without overwriting another spec
+type MergeConflict struct {
+	Key     string `json:"key"`
+	Pointer string `json:"pointer,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// MergeResult is the merged raw OpenAPI 3 document and the conflicts found while merging
+type MergeResult struct {
+	Document  map[string]interface{}
+	Conflicts []MergeConflict
+}
+
+// MergeOptions configure the info of the merged document
+type MergeOptions struct {
+	Title   string
+	Version string
+}
+
+var componentTypes = []string{
+	"schemas", "responses", "parameters", "examples", "requestBodies", "headers", "securitySchemes", "links", "callbacks",
+}
+
+// Merge combines all specs of the repository that match the filter into one OpenAPI 3 document.
+// The paths of every spec are prefixed with /{key} and its components are namespaced as {key}.{name},
+// Swagger 2.0 specs are converted before merging. Conflicts are reported and the first spec wins
+func Merge(ctx context.Context, repo Repository, filter MetadataFilter, opts MergeOptions) *MergeResult {
+	keys := make([]SpecMetadata, 0)
+	for _, k := range repo.Keys() {
+		if filter.Matches(k) {
+			keys = append(keys, k)
+		}
+	}
+	docs := documentsOf(ctx, repo, keys)
+	raws := make(map[string]map[string]interface{}, len(docs))
+	version := OpenAPI30
+	m := &merger{
+		paths:      make(map[string]interface{}),
+		components: make(map[string]map[string]interface{}),
+		tags:       make([]interface{}, 0),
+		tagIndex:   make(map[string]map[string]interface{}),
+		opIDs:      make(map[string]string),
+		conflicts:  make([]MergeConflict, 0),
+	}
+	for _, k := range keys {
+		doc, ok := docs[k.Key]
+		if !ok || doc == nil {
+			m.conflict(k.Key, "", "spec is unavailable or not a valid OpenAPI document, skipped")
+			continue
+		}
+		raw := doc.Raw
+		if doc.IsSwagger2() {
+			raw = swagger2ToOpenAPI30(raw)
+		}
+		if strings.HasPrefix(stringAt(raw, "openapi"), "3.1") {
+			version = OpenAPI31
+		}
+		raws[k.Key] = raw
+	}
+	for _, k := range keys {
+		raw, ok := raws[k.Key]
+		if !ok {
+			continue
+		}
+		if version == OpenAPI31 && strings.HasPrefix(stringAt(raw, "openapi"), "3.0") {
+			raw = openAPI30To31(raw)
+		}
+		m.add(k.Key, raw)
+	}
+	title := opts.Title
+	if title == "" {
+		title = "Merged specification"
+	}
+	ver := opts.Version
+	if ver == "" {
+		ver = "1.0.0"
+	}
+	merged := map[string]interface{}{
+		"openapi": string(version),
+		"info":    map[string]interface{}{"title": title, "version": ver},
+		"paths":   m.paths,
+	}
+	if len(m.tags) > 0 {
+		merged["tags"] = m.tags
+	}
+	components := make(map[string]interface{})
+	for t, c := range m.components {
+		components[t] = c
+	}
+	if len(components) > 0 {
+		merged["components"] = components
+	}
+	return &MergeResult{Document: merged, Conflicts: m.conflicts}
+}
+
+type merger struct {
+	paths      map[string]interface{}
+	components map[string]map[string]interface{}
+	tags       []interface{}
+	tagIndex   map[string]map[string]interface{}
+	opIDs      map[string]string
+	conflicts  []MergeConflict
+}
+
+func (m *merger) conflict(key, pointer, reason string, args ...interface{}) {
+	m.conflicts = append(m.conflicts, MergeConflict{Key: key, Pointer: pointer, Reason: fmt.Sprintf(reason, args...)})
+}
+
+func (m *merger) add(key string, raw map[string]interface{}) {
+	namespaced := namespaceRefs(key, raw).(map[string]interface{})
+	for _, t := range componentTypes {
+		for name, c := range objectAt(namespaced, "components", t) {
+			if _, ok := m.components[t]; !ok {
+				m.components[t] = make(map[string]interface{})
+			}
+			merged := namespacedName(key, name)
+			if _, ok := m.components[t][merged]; ok {
+				m.conflict(key, jsonPointer("components", t, name), "component %s already exists", merged)
+				continue
+			}
+			m.components[t][merged] = c
+		}
+	}
+	globalSecurity, hasGlobalSecurity := namespaced["security"]
+	for path, item := range objectAt(namespaced, "paths") {
+		prefixed := "/" + key + path
+		if _, ok := m.paths[prefixed]; ok {
+			m.conflict(key, jsonPointer("paths", path), "path %s already exists", prefixed)
+			continue
+		}
+		if pathItem, ok := item.(map[string]interface{}); ok {
+			for method, o := range pathItem {
+				op, ok := o.(map[string]interface{})
+				if !ok || !isMethod(method) {
+					continue
+				}
+				if id := stringAt(op, "operationId"); id != "" {
+					if owner, ok := m.opIDs[id]; ok {
+						m.conflict(key, jsonPointer("paths", path, method), "operationId %s is already used by %s", id, owner)
+					} else {
+						m.opIDs[id] = key
+					}
+				}
+				if _, ok := op["security"]; !ok && hasGlobalSecurity {
+					op["security"] = globalSecurity
+				}
+			}
+		}
+		m.paths[prefixed] = item
+	}
+	for i, t := range arrayAt(namespaced, "tags") {
+		tag, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name := stringAt(tag, "name")
+		if existing, ok := m.tagIndex[name]; ok {
+			if !reflect.DeepEqual(existing, tag) {
+				m.conflict(key, jsonPointer("tags", fmt.Sprintf("%d", i)), "tag %s is already defined differently", name)
+			}
+			continue
+		}
+		m.tagIndex[name] = tag
+		m.tags = append(m.tags, tag)
+	}
+}
+
+func namespacedName(key, name string) string {
+	return key + "." + name
+}
+
+// namespaceRefs deep copies the raw document, namespacing local component references and
+// security requirements with the key
+func namespaceRefs(key string, v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			if ref, ok := child.(string); ok && k == "$ref" && strings.HasPrefix(ref, "#/components/") {
+				parts := strings.SplitN(strings.TrimPrefix(ref, "#/components/"), "/", 3)
+				if len(parts) >= 2 {
+					parts[1] = namespacedName(key, parts[1])
+					converted[k] = "#/components/" + strings.Join(parts, "/")
+					continue
+				}
+			}
+			if k == "security" {
+				if reqs, ok := child.([]interface{}); ok {
+					converted[k] = namespaceSecurity(key, reqs)
+					continue
+				}
+			}
+			converted[k] = namespaceRefs(key, child)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(val))
+		for i, child := range val {
+			converted[i] = namespaceRefs(key, child)
+		}
+		return converted
+	}
+	return v
+}
+
+func namespaceSecurity(key string, reqs []interface{}) []interface{} {
+	converted := make([]interface{}, 0, len(reqs))
+	for _, r := range reqs {
+		req, ok := r.(map[string]interface{})
+		if !ok {
+			converted = append(converted, r)
+			continue
+		}
+		namespaced := make(map[string]interface{}, len(req))
+		for scheme, scopes := range req {
+			namespaced[namespacedName(key, scheme)] = scopes
+		}
+		converted = append(converted, namespaced)
+	}
+	return converted
+}
@@ -0,0 +1,69 @@
+package openapi
+
+import (
+	"context"
+	"testing"
+)
+
+const conflictingSpec = `{
+	"openapi": "3.0.0",
+	"info": {"title": "Billing", "version": "1"},
+	"security": [{"key": []}],
+	"tags": [{"name": "invoice", "description": "Billing invoices"}],
+	"paths": {"/invoices": {"get": {"operationId": "getInvoice", "responses": {"200": {"$ref": "#/components/responses/Ok"}}}}},
+	"components": {
+		"responses": {"Ok": {"description": "ok", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Invoice"}}}}},
+		"schemas": {"Invoice": {"type": "object"}},
+		"securitySchemes": {"key": {"type": "apiKey", "name": "key", "in": "header"}}
+	}
+}`
+
+func Test_mergeNamespacesAndReportsConflicts(t *testing.T) {
+	r := NewCachedRepository()
+	check("put invoices", t, r.Put("s1", "invoices", testSpec(oas3Spec)))
+	check("put billing", t, r.Put("s1", "billing", testSpec(conflictingSpec)))
+	check("put pets", t, r.Put("s2", "pets", WithLabels(testSpec(swagger2Spec), map[string]string{"team": "pets"})))
+	check("put broken", t, r.Put("s2", "broken", testSpec(`{"ID": "1"}`)))
+	result := Merge(context.Background(), r, MetadataFilter{}, MergeOptions{})
+	doc := result.Document
+	if doc["openapi"] != string(OpenAPI30) {
+		t.Errorf("unexpected version %v", doc["openapi"])
+	}
+	for _, path := range []string{"/invoices/invoices/{id}", "/billing/invoices", "/pets/pets"} {
+		if objectAt(doc, "paths", path) == nil {
+			t.Errorf("expected prefixed path %s in %v", path, objectAt(doc, "paths"))
+		}
+	}
+	for _, schema := range []string{"invoices.Invoice", "billing.Invoice", "pets.Pet"} {
+		if objectAt(doc, "components", "schemas", schema) == nil {
+			t.Errorf("expected namespaced schema %s", schema)
+		}
+	}
+	billing := objectAt(doc, "paths", "/billing/invoices", "get")
+	if ref := stringAt(objectAt(billing, "responses", "200"), "$ref"); ref != "#/components/responses/billing.Ok" {
+		t.Errorf("unexpected namespaced ref %s", ref)
+	}
+	ok := objectAt(doc, "components", "responses", "billing.Ok", "content", "application/json", "schema")
+	if ref := stringAt(ok, "$ref"); ref != "#/components/schemas/billing.Invoice" {
+		t.Errorf("unexpected namespaced component ref %s", ref)
+	}
+	security := arrayAt(billing, "security")
+	if len(security) != 1 || security[0].(map[string]interface{})["billing.key"] == nil {
+		t.Errorf("expected global security to be namespaced on operation, got %v", security)
+	}
+	reasons := make(map[string]int)
+	for _, c := range result.Conflicts {
+		reasons[c.Key]++
+	}
+	if len(result.Conflicts) != 3 || reasons["broken"] != 1 || reasons["invoices"] != 2 {
+		t.Errorf("expected conflicts for broken spec, duplicate operationId and tag, got %v", result.Conflicts)
+	}
+
+	filtered := Merge(context.Background(), r, MetadataFilter{Labels: map[string]string{"team": "pets"}}, MergeOptions{Title: "Pets"})
+	if len(objectAt(filtered.Document, "paths")) != 1 || len(filtered.Conflicts) != 0 {
+		t.Errorf("expected only pets to be merged, got %v %v", objectAt(filtered.Document, "paths"), filtered.Conflicts)
+	}
+	if stringAt(objectAt(filtered.Document, "info"), "title") != "Pets" {
+		t.Errorf("expected title to be set")
+	}
+}
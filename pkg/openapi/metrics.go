@@ -0,0 +1,119 @@
+package openapi
+
+import (
+	"github.com/SimonSchneider/docs-prox/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type repositoryCollector struct {
+	repo       Repository
+	perKey     bool
+	keys       *prometheus.Desc
+	fetches    *prometheus.Desc
+	fetchError *prometheus.Desc
+}
+
+// NewRepositoryCollector collects the number of keys per source and the upstream fetch latency
+// and errors per key of the repository when scraped
+func NewRepositoryCollector(repo Repository) prometheus.Collector {
+	return newRepositoryCollector(repo, true)
+}
+
+// NewSourceCollector collects the same metrics as the repository collector with the fetches summed up per
+// source, the metrics don't expose the keys of specs that are hidden from some of the callers
+func NewSourceCollector(repo Repository) prometheus.Collector {
+	return newRepositoryCollector(repo, false)
+}
+
+func newRepositoryCollector(repo Repository, perKey bool) *repositoryCollector {
+	labels, by := []string{"source"}, "source"
+	if perKey {
+		labels, by = []string{"key", "source"}, "key"
+	}
+	return &repositoryCollector{
+		repo:   repo,
+		perKey: perKey,
+		keys:   prometheus.NewDesc("docsprox_keys", "Registered keys by source.", []string{"source"}, nil),
+		fetches: prometheus.NewDesc("docsprox_upstream_fetch_duration_seconds",
+			"Duration of the fetches of specs from their upstream by "+by+".", labels, nil),
+		fetchError: prometheus.NewDesc("docsprox_upstream_fetch_errors_total",
+			"Failed fetches of specs from their upstream by "+by+".", labels, nil),
+	}
+}
+
+func (c *repositoryCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.keys
+	descs <- c.fetches
+	descs <- c.fetchError
+}
+
+func (c *repositoryCollector) Collect(ms chan<- prometheus.Metric) {
+	sources := make(map[string]int)
+	fetches := make(map[string]*FetchStats)
+	for _, k := range c.repo.Keys() {
+		sources[k.Source]++
+		spec, err := c.repo.Spec(k.Key)
+		if err != nil {
+			continue
+		}
+		stats, ok := FetchStatsOf(spec)
+		if !ok {
+			continue
+		}
+		if c.perKey {
+			c.collectFetches(ms, stats, k.Key, k.Source)
+			continue
+		}
+		sum, ok := fetches[k.Source]
+		if !ok {
+			sum = &FetchStats{LatencyBuckets: make(map[float64]uint64, len(stats.LatencyBuckets))}
+			fetches[k.Source] = sum
+		}
+		sum.Count += stats.Count
+		sum.Errors += stats.Errors
+		sum.LatencySum += stats.LatencySum
+		for bound, n := range stats.LatencyBuckets {
+			sum.LatencyBuckets[bound] += n
+		}
+	}
+	for source, stats := range fetches {
+		c.collectFetches(ms, *stats, source)
+	}
+	for source, n := range sources {
+		ms <- prometheus.MustNewConstMetric(c.keys, prometheus.GaugeValue, float64(n), source)
+	}
+}
+
+func (c *repositoryCollector) collectFetches(ms chan<- prometheus.Metric, stats FetchStats, labels ...string) {
+	ms <- prometheus.MustNewConstHistogram(c.fetches, stats.Count, stats.LatencySum, stats.LatencyBuckets, labels...)
+	ms <- prometheus.MustNewConstMetric(c.fetchError, prometheus.CounterValue, float64(stats.Errors), labels...)
+}
+
+type instrumentedSpecStore struct {
+	delegate SpecStore
+}
+
+// Instrumented wraps the Spec Store in a spec store counting its mutations
+func Instrumented(delegate SpecStore) SpecStore {
+	return &instrumentedSpecStore{delegate: delegate}
+}
+
+func (s *instrumentedSpecStore) Put(source, key string, spec Spec) error {
+	metrics.StoreOperations.WithLabelValues("put", source).Inc()
+	return s.delegate.Put(source, key, spec)
+}
+
+func (s *instrumentedSpecStore) ReplaceAllOf(source string, specs map[string]Spec) {
+	metrics.StoreOperations.WithLabelValues("replace_all", source).Inc()
+	s.delegate.ReplaceAllOf(source, specs)
+}
+
+func (s *instrumentedSpecStore) Remove(source, key string) error {
+	metrics.StoreOperations.WithLabelValues("remove", source).Inc()
+	return s.delegate.Remove(source, key)
+}
+
+func (s *instrumentedSpecStore) RemoveAllOf(source string) {
+	metrics.StoreOperations.WithLabelValues("remove_all", source).Inc()
+	s.delegate.RemoveAllOf(source)
+}
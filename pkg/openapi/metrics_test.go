@@ -0,0 +1,62 @@
+package openapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRepositoryCollectorReportsKeysAndFetches(t *testing.T) {
+	r := NewCachedRepository()
+	check("put", t, r.Put("s1", "a", Cached(testSpec("a"), 0)))
+	check("put", t, r.Put("s1", "b", Cached(failingSpec{}, 0)))
+	check("put", t, r.Put("s2", "c", rndSpec()))
+	for _, key := range []string{"a", "b"} {
+		spec, err := r.Spec(key)
+		check("spec", t, err)
+		_, _ = spec.Get()
+	}
+	expected := `
+# HELP docsprox_keys Registered keys by source.
+# TYPE docsprox_keys gauge
+docsprox_keys{source="s1"} 2
+docsprox_keys{source="s2"} 1
+# HELP docsprox_upstream_fetch_errors_total Failed fetches of specs from their upstream by key.
+# TYPE docsprox_upstream_fetch_errors_total counter
+docsprox_upstream_fetch_errors_total{key="a",source="s1"} 0
+docsprox_upstream_fetch_errors_total{key="b",source="s1"} 1
+`
+	collector := NewRepositoryCollector(r)
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "docsprox_keys", "docsprox_upstream_fetch_errors_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(collector); n != 6 {
+		t.Errorf("expected 2 key gauges and a histogram and error counter per fetched key, got %d metrics", n)
+	}
+}
+
+func TestSourceCollectorSumsTheFetchesOfTheKeys(t *testing.T) {
+	r := NewCachedRepository()
+	check("put", t, r.Put("s1", "a", Cached(testSpec("a"), 0)))
+	check("put", t, r.Put("s1", "b", Cached(failingSpec{}, 0)))
+	check("put", t, r.Put("s2", "c", Cached(failingSpec{}, 0)))
+	for _, key := range []string{"a", "b", "c"} {
+		spec, err := r.Spec(key)
+		check("spec", t, err)
+		_, _ = spec.Get()
+	}
+	expected := `
+# HELP docsprox_upstream_fetch_errors_total Failed fetches of specs from their upstream by source.
+# TYPE docsprox_upstream_fetch_errors_total counter
+docsprox_upstream_fetch_errors_total{source="s1"} 1
+docsprox_upstream_fetch_errors_total{source="s2"} 1
+`
+	collector := NewSourceCollector(r)
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "docsprox_upstream_fetch_errors_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(collector, "docsprox_upstream_fetch_duration_seconds"); n != 2 {
+		t.Errorf("expected a histogram per source, got %d", n)
+	}
+}
@@ -0,0 +1,213 @@
+package openapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SimonSchneider/docs-prox/pkg/authn"
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+	"github.com/gorilla/mux"
+)
+
+type originSpec interface {
+	Origin() string
+}
+
+// OriginOf returns the url the spec was discovered at, false if it was not fetched from a url
+func OriginOf(spec Spec) (string, bool) {
+	for ; spec != nil; spec = unwrap(spec) {
+		if o, ok := spec.(originSpec); ok {
+			origin := o.Origin()
+			return origin, origin != ""
+		}
+	}
+	return "", false
+}
+
+// ProxyPrefix is the path the try-it-out requests of a key are proxied on
+const ProxyPrefix = "/proxy"
+
+// ProxyOptions configure the proxy that forwards the try-it-out requests of the docs to the upstreams
+type ProxyOptions struct {
+	// Hosts are the glob patterns of the upstream hosts requests may be forwarded to, ie. *.svc.cluster.local
+	// or payments:8080. Nothing is proxied if empty
+	Hosts []string
+	// Methods that are forwarded, all but CONNECT and TRACE by default
+	Methods []string
+	// StripHeaders are removed from the forwarded requests in addition to the credentials of docs-prox
+	StripHeaders []string
+	// ConnectTimeout of the connections to the upstreams
+	ConnectTimeout time.Duration
+	// Timeout of a proxied request including reading the response
+	Timeout time.Duration
+	// MaxBodySize of the forwarded request bodies
+	MaxBodySize int64
+	// RewriteServers points the servers (OpenAPI 3) or host and basePath (Swagger 2) of the served specs
+	// at the proxy so Swagger UI calls the upstreams through it
+	RewriteServers bool
+}
+
+// DefaultProxyOptions are used for the unset proxy options
+var DefaultProxyOptions = ProxyOptions{
+	Methods:        []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
+	ConnectTimeout: 5 * time.Second,
+	Timeout:        30 * time.Second,
+	MaxBodySize:    10 << 20,
+}
+
+// UpstreamAuthorizationHeader carries the credentials of the upstream when the Authorization header carries
+// those of docs-prox, it is forwarded as the Authorization header
+const UpstreamAuthorizationHeader = "X-Upstream-Authorization"
+
+// localHeaders are meant for docs-prox and are never forwarded, the cookies are those of docs-prox
+var localHeaders = []string{"Cookie", "Proxy-Authorization"}
+
+// WithProxy serves the try-it-out proxy on /proxy/{key}/... forwarding the requests to the url the spec
+// of the key was discovered at
+func WithProxy(opts ProxyOptions) ServeOption {
+	return func(o *serveOptions) {
+		o.proxy = newSpecProxy(opts)
+	}
+}
+
+type specProxy struct {
+	opts        ProxyOptions
+	methods     map[string]bool
+	transport   http.RoundTripper
+	credentials []string
+}
+
+func newSpecProxy(opts ProxyOptions) *specProxy {
+	defaults := DefaultProxyOptions
+	if len(opts.Methods) == 0 {
+		opts.Methods = defaults.Methods
+	}
+	if opts.ConnectTimeout <= 0 {
+		opts.ConnectTimeout = defaults.ConnectTimeout
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaults.Timeout
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaults.MaxBodySize
+	}
+	p := &specProxy{opts: opts, methods: make(map[string]bool, len(opts.Methods))}
+	for _, m := range opts.Methods {
+		p.methods[strings.ToUpper(m)] = true
+	}
+	p.transport = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: opts.ConnectTimeout}).DialContext,
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConnsPerHost:   8,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return p
+}
+
+// authenticatedBy returns a copy of the proxy that strips the credential headers of the middleware
+func (p *specProxy) authenticatedBy(auth *authn.Middleware) *specProxy {
+	authenticated := *p
+	authenticated.credentials = auth.CredentialHeaders()
+	return &authenticated
+}
+
+// target is the base url of the upstream of the spec, nil if the spec may not be proxied
+func (p *specProxy) target(spec Spec) *url.URL {
+	origin, ok := OriginOf(spec)
+	if !ok {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil
+	}
+	if !matchesAny(p.opts.Hosts, u.Host) && !matchesAny(p.opts.Hosts, u.Hostname()) {
+		return nil
+	}
+	return &url.URL{Scheme: u.Scheme, Host: u.Host}
+}
+
+// rewrite points the servers of the spec at the proxy of the key if the spec may be proxied
+func (p *specProxy) rewrite(key string, spec Spec) Spec {
+	if p == nil || !p.opts.RewriteServers || p.target(spec) == nil {
+		return spec
+	}
+	return ThroughProxy(spec, ProxyPrefix+"/"+url.PathEscape(key))
+}
+
+func (p *specProxy) handler(repo Repository) (string, http.Handler) {
+	return ProxyPrefix + "/{key}", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		key := mux.Vars(r)["key"]
+		spec, err := repo.Spec(key)
+		if err != nil {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		target := p.target(spec)
+		if target == nil {
+			http.Error(rw, "the upstream of the spec is not proxied", http.StatusForbidden)
+			return
+		}
+		if !p.methods[r.Method] {
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		prefix := ProxyPrefix + "/" + key
+		ctx, cancel := context.WithTimeout(r.Context(), p.opts.Timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(rw, r.Body, p.opts.MaxBodySize)
+		}
+		logger := logging.FromContext(ctx)
+		proxy := &httputil.ReverseProxy{
+			Transport: p.transport,
+			Director: func(out *http.Request) {
+				out.URL.Scheme, out.URL.Host, out.Host = target.Scheme, target.Host, target.Host
+				out.URL.Path = "/" + strings.TrimLeft(strings.TrimPrefix(out.URL.Path, prefix), "/")
+				out.URL.RawPath = ""
+				p.stripCredentials(out)
+			},
+			ModifyResponse: func(resp *http.Response) error {
+				// cookies of the upstream would be set for docs-prox
+				resp.Header.Del("Set-Cookie")
+				return nil
+			},
+			ErrorHandler: func(rw http.ResponseWriter, r *http.Request, err error) {
+				logger.Warn("unable to proxy request", "key", key, "upstream", target.Host, "err", err)
+				status := http.StatusBadGateway
+				if errors.Is(err, context.DeadlineExceeded) {
+					status = http.StatusGatewayTimeout
+				}
+				rw.WriteHeader(status)
+			},
+		}
+		proxy.ServeHTTP(rw, r)
+	})
+}
+
+// stripCredentials removes the credentials of docs-prox and the stripped headers from the forwarded request.
+// The Authorization header is only removed if the caller was authenticated with it, the upstream
+// authorization header replaces it
+func (p *specProxy) stripCredentials(out *http.Request) {
+	for _, headers := range [][]string{localHeaders, p.credentials, p.opts.StripHeaders} {
+		for _, h := range headers {
+			out.Header.Del(h)
+		}
+	}
+	if principal, ok := authn.FromContext(out.Context()); ok && principal.Header != "" {
+		out.Header.Del(principal.Header)
+	}
+	if upstream := out.Header.Get(UpstreamAuthorizationHeader); upstream != "" {
+		out.Header.Set("Authorization", upstream)
+		out.Header.Del(UpstreamAuthorizationHeader)
+	}
+}
@@ -0,0 +1,169 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SimonSchneider/docs-prox/pkg/authn"
+	"github.com/SimonSchneider/docs-prox/pkg/authn/authntest"
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+	"github.com/gorilla/mux"
+)
+
+func TestProxyForwardsToTheOriginOfTheSpec(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		http.SetCookie(rw, &http.Cookie{Name: "upstream", Value: "1"})
+		_ = json.NewEncoder(rw).Encode(map[string]string{
+			"method": r.Method, "uri": r.URL.RequestURI(), "cookie": r.Header.Get("Cookie"),
+			"apiKey": r.Header.Get("X-API-Key"), "authorization": r.Header.Get("Authorization"),
+		})
+	}))
+	defer upstream.Close()
+	r := NewCachedRepository()
+	check("put", t, r.Put("s1", "api", NewRemoteSpec(upstream.URL+"/swagger.json")))
+	check("put", t, r.Put("s1", "file", testSpec("{}")))
+	serve := func(opts ProxyOptions, method, target string) *httptest.ResponseRecorder {
+		router := mux.NewRouter()
+		path, handler := newSpecProxy(opts).handler(r)
+		router.PathPrefix(path).Handler(handler)
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Cookie", "docsprox_session=secret")
+		req.Header.Set("X-API-Key", "secret")
+		req.Header.Set("Authorization", "Bearer upstream")
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, req)
+		return rw
+	}
+	allowed := ProxyOptions{Hosts: []string{"127.0.0.1"}, Timeout: 100 * time.Millisecond}
+
+	rw := serve(allowed, http.MethodPost, "/proxy/api/v1/pets?limit=1")
+	var echo map[string]string
+	check("decode echo", t, json.NewDecoder(rw.Body).Decode(&echo))
+	if rw.Code != http.StatusOK || echo["method"] != http.MethodPost || echo["uri"] != "/v1/pets?limit=1" {
+		t.Errorf("expected the request to be forwarded to the upstream, got %d %v", rw.Code, echo)
+	}
+	if echo["cookie"] != "" || echo["apiKey"] != "secret" || echo["authorization"] != "Bearer upstream" {
+		t.Errorf("expected only the cookies of docs-prox to be stripped without authentication, got %v", echo)
+	}
+	if rw.Header().Get("Set-Cookie") != "" {
+		t.Error("expected the cookies of the upstream not to be forwarded")
+	}
+	cases := []struct {
+		name   string
+		opts   ProxyOptions
+		method string
+		target string
+		status int
+	}{
+		{name: "unknown key", opts: allowed, method: http.MethodGet, target: "/proxy/missing/", status: http.StatusNotFound},
+		{name: "spec without origin", opts: allowed, method: http.MethodGet, target: "/proxy/file/", status: http.StatusForbidden},
+		{name: "host not allowed", opts: ProxyOptions{Hosts: []string{"*.svc.cluster.local"}}, method: http.MethodGet, target: "/proxy/api/", status: http.StatusForbidden},
+		{name: "no hosts allowed", opts: ProxyOptions{}, method: http.MethodGet, target: "/proxy/api/", status: http.StatusForbidden},
+		{name: "method not allowed", opts: allowed, method: http.MethodTrace, target: "/proxy/api/", status: http.StatusMethodNotAllowed},
+		{name: "timeout", opts: allowed, method: http.MethodGet, target: "/proxy/api/slow", status: http.StatusGatewayTimeout},
+	}
+	for _, c := range cases {
+		if rw := serve(c.opts, c.method, c.target); rw.Code != c.status {
+			t.Errorf("%s: expected %d, got %d", c.name, c.status, rw.Code)
+		}
+	}
+}
+
+func TestProxyWithOIDCForwardsOnlyUpstreamCredentials(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(rw).Encode(map[string]string{
+			"cookie": r.Header.Get("Cookie"), "apiKey": r.Header.Get(authn.APIKeyHeader),
+			"authorization": r.Header.Get("Authorization"), "upstreamAuthorization": r.Header.Get(UpstreamAuthorizationHeader),
+		})
+	}))
+	defer upstream.Close()
+	idp := authntest.NewIssuer(t, "docs-prox")
+	defer idp.Close()
+	free, err := net.Listen("tcp4", "127.0.0.1:0")
+	check("find free port", t, err)
+	port := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+	app := fmt.Sprintf("http://127.0.0.1:%d", port)
+	oidc, err := authn.NewOIDC(context.Background(), authn.OIDCOptions{IssuerURL: idp.URL, ClientID: "docs-prox",
+		ClientSecret: authntest.ClientSecret, RedirectURL: app + authn.CallbackPath, CookieSecret: "cookie-secret"})
+	check("create oidc", t, err)
+	keys := authn.APIKeys(authn.APIKey{Key: "secret", Principal: authn.Principal{Subject: "ci"}})
+	auth := authn.New(authn.Options{Logger: logging.Nop()}, oidc, keys)
+	r := NewCachedRepository()
+	check("put", t, r.Put("s1", "api", NewRemoteSpec(upstream.URL+"/swagger.json")))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, errs := Serve(ctx, r, "127.0.0.1", port, WithAuth(auth, Visibility{}), WithServerLogger(logging.Nop()),
+		WithProxy(ProxyOptions{Hosts: []string{"127.0.0.1"}}))
+	select {
+	case err := <-errs:
+		t.Fatalf("unable to serve: %v", err)
+	default:
+	}
+	proxied := func(client *http.Client, headers map[string]string) (int, map[string]string) {
+		req, _ := http.NewRequest(http.MethodGet, app+"/proxy/api/echo", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.Do(req)
+		check("proxy", t, err)
+		defer resp.Body.Close()
+		echo := make(map[string]string)
+		_ = json.NewDecoder(resp.Body).Decode(&echo)
+		return resp.StatusCode, echo
+	}
+
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+	req, _ := http.NewRequest(http.MethodGet, app+"/docs/", nil)
+	req.Header.Set("Accept", "text/html")
+	resp, err := browser.Do(req)
+	check("login", t, err)
+	resp.Body.Close()
+	status, echo := proxied(browser, map[string]string{"Authorization": "Bearer upstream", authn.APIKeyHeader: "secret"})
+	if status != http.StatusOK || echo["authorization"] != "Bearer upstream" || echo["cookie"] != "" || echo["apiKey"] != "" {
+		t.Errorf("expected a logged in browser to send the bearer token of the upstream only, got %d %v", status, echo)
+	}
+	token := "Bearer " + idp.Token(t, nil)
+	status, echo = proxied(http.DefaultClient, map[string]string{"Authorization": token})
+	if status != http.StatusOK || echo["authorization"] != "" {
+		t.Errorf("expected the id token of docs-prox not to be forwarded, got %d %v", status, echo)
+	}
+	status, echo = proxied(http.DefaultClient, map[string]string{"Authorization": token, UpstreamAuthorizationHeader: "Bearer upstream"})
+	if status != http.StatusOK || echo["authorization"] != "Bearer upstream" || echo["upstreamAuthorization"] != "" {
+		t.Errorf("expected the upstream authorization to be forwarded as the authorization, got %d %v", status, echo)
+	}
+	if status, _ = proxied(http.DefaultClient, map[string]string{"Authorization": "Bearer upstream"}); status != http.StatusUnauthorized {
+		t.Errorf("expected a request without credentials of docs-prox to be rejected, got %d", status)
+	}
+}
+
+func TestThroughProxyRewritesServers(t *testing.T) {
+	oas3 := ThroughProxy(testSpec(`{"openapi": "3.0.3", "servers": [{"url": "http://localhost:8080/v1/", "description": "local"}, {"url": "https://api.example.com/v1"}, {"url": "/v2"}]}`), "/proxy/api")
+	doc, err := DocumentOf(oas3)
+	check("parse oas3", t, err)
+	if len(doc.Servers) != 2 || doc.Servers[0] != "/proxy/api/v1" || doc.Servers[1] != "/proxy/api/v2" {
+		t.Errorf("expected the servers to point at the proxy, got %v", doc.Servers)
+	}
+	swagger := ThroughProxy(testSpec("swagger: \"2.0\"\nhost: localhost:8080\nbasePath: /v1\nschemes: [http]\n"), "/proxy/api")
+	content, err := swagger.Get()
+	check("get swagger", t, err)
+	if DetectFormat(content) != YAML {
+		t.Errorf("expected the format of the spec to be kept, got %s", content)
+	}
+	doc, err = DocumentOf(swagger)
+	check("parse swagger", t, err)
+	if doc.Raw["host"] != nil || doc.Raw["schemes"] != nil || doc.Raw["basePath"] != "/proxy/api/v1" {
+		t.Errorf("expected the base path to point at the proxy, got %v", doc.Raw)
+	}
+}
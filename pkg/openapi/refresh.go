@@ -0,0 +1,63 @@
+package openapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+)
+
+type refresher interface {
+	Refresh() (bool, error)
+}
+
+// RefreshOf refreshes the spec if it is revalidated in the background and has expired, true if it was
+// fetched. Specs that are not cached in the background are never refreshed
+func RefreshOf(spec Spec) (bool, error) {
+	for ; spec != nil; spec = unwrap(spec) {
+		if r, ok := spec.(refresher); ok {
+			return r.Refresh()
+		}
+	}
+	return false, nil
+}
+
+const refreshParallelism = 8
+
+// RefreshInBackground refreshes the expired specs of the repo every interval until the context is done
+func RefreshInBackground(ctx context.Context, repo Repository, interval time.Duration, logger logging.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refreshAll(repo, logger)
+		}
+	}
+}
+
+// refreshAll refreshes the expired specs of the repo with bounded parallelism
+func refreshAll(repo Repository, logger logging.Logger) {
+	sem := make(chan struct{}, refreshParallelism)
+	var wg sync.WaitGroup
+	for _, meta := range repo.Keys() {
+		spec, err := repo.Spec(meta.Key)
+		if err != nil {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(key string, spec Spec) {
+			defer func() { <-sem; wg.Done() }()
+			if refreshed, err := RefreshOf(spec); err != nil {
+				logger.Warn("unable to refresh spec, serving last good copy", "key", key, "err", err)
+			} else if refreshed {
+				logger.Debug("refreshed spec", "key", key)
+			}
+		}(meta.Key, spec)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,94 @@
+package openapi
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+)
+
+type upstreamSpec struct {
+	mu      sync.Mutex
+	content string
+	down    bool
+	fetches int
+}
+
+func (u *upstreamSpec) Get() ([]byte, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.fetches++
+	if u.down {
+		return nil, errors.New("upstream down")
+	}
+	return []byte(u.content), nil
+}
+
+func (u *upstreamSpec) set(content string, down bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.content, u.down = content, down
+}
+
+func expectContent(t *testing.T, spec Spec, expected string, stale bool) {
+	t.Helper()
+	b, err := spec.Get()
+	if err != nil || string(b) != expected {
+		t.Fatalf("expected %s, got %s, %v", expected, b, err)
+	}
+	if stats, _ := FetchStatsOf(spec); stats.Stale != stale {
+		t.Errorf("expected stale %v of %s, got %v", stale, expected, stats.Stale)
+	}
+}
+
+func TestCachedSpecServesLastGoodCopyWhenUpstreamIsDown(t *testing.T) {
+	upstream := &upstreamSpec{content: "v1"}
+	spec := Cached(upstream, 0)
+	expectContent(t, spec, "v1", false)
+	upstream.set("v2", true)
+	expectContent(t, spec, "v1", true)
+	upstream.set("v2", false)
+	expectContent(t, spec, "v2", false)
+
+	unavailable := Cached(&upstreamSpec{down: true}, 0)
+	if _, err := unavailable.Get(); err == nil {
+		t.Error("expected an error without a last good copy")
+	}
+}
+
+func TestCachedSpecRevalidatesInBackground(t *testing.T) {
+	upstream := &upstreamSpec{content: "v1"}
+	spec := CachedWith(upstream, CacheOptions{TTL: 10 * time.Millisecond, Background: true})
+	expectContent(t, spec, "v1", false)
+	upstream.set("v2", false)
+	time.Sleep(20 * time.Millisecond)
+	expectContent(t, spec, "v1", true)
+	deadline := time.Now().Add(time.Second)
+	for b, _ := spec.Get(); string(b) != "v2"; b, _ = spec.Get() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the spec to be revalidated in the background")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRefreshAllRecordsRefreshedSpecs(t *testing.T) {
+	history := NewMemoryHistory(5)
+	r := NewCachedRepository(WithHistory(history))
+	upstream := &upstreamSpec{content: "v1"}
+	check("put", t, r.Put("s1", "a", CachedWith(upstream, CacheOptions{Background: true})))
+	check("put", t, r.Put("s1", "b", Cached(testSpec("b"), 0)))
+	refreshAll(r, logging.Nop())
+	upstream.set("v2", false)
+	refreshAll(r, logging.Nop())
+	versions, err := history.Versions("a")
+	check("versions", t, err)
+	if len(versions) != 2 || versions[0].Hash != ContentHash([]byte("v2")) {
+		t.Errorf("expected both refreshed versions to be recorded, got %v", versions)
+	}
+	if versions, _ := history.Versions("b"); len(versions) != 0 {
+		t.Errorf("expected specs cached on-demand not to be refreshed, got %v", versions)
+	}
+}
@@ -2,10 +2,11 @@ package openapi
 
 import (
 	"fmt"
-	"log"
 	"sort"
 	"strings"
 	"sync"
+
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
 )
 
 // Repository abstracts a documentation provider holding keys and specs
@@ -17,6 +18,8 @@ type Repository interface {
 // SpecMetadata contains metadata regarding the spec
 type SpecMetadata struct {
 	Key, Name string
+	Source    string
+	Labels    map[string]string
 }
 
 // SpecMetadataOf name
@@ -37,6 +40,15 @@ func (e KeyNotFoundError) Error() string {
 	return fmt.Sprintf("%s: SpecMetadata %s not found", e.Repo, e.Key)
 }
 
+// ReservedKeyError is returned when a spec is stored with a key that is shadowed by an endpoint of the server
+type ReservedKeyError struct {
+	Key string
+}
+
+func (e ReservedKeyError) Error() string {
+	return fmt.Sprintf("key %s is reserved by the server", e.Key)
+}
+
 // SpecStore is a concurrent Spec store
 type SpecStore interface {
 	Put(source, key string, spec Spec) error
@@ -47,30 +59,41 @@ type SpecStore interface {
 
 type loggingSpecStore struct {
 	delegate SpecStore
+	logger   logging.Logger
 }
 
 // Logging wraps the Spec Store in a logging spec store
-func Logging(delegate SpecStore) SpecStore {
-	return &loggingSpecStore{delegate: delegate}
+func Logging(delegate SpecStore, logger logging.Logger) SpecStore {
+	return &loggingSpecStore{delegate: delegate, logger: logger}
 }
 
 func (l *loggingSpecStore) Put(source, key string, spec Spec) error {
-	fmt.Printf("Putting (%s - %s)\n", source, key)
-	return l.delegate.Put(source, key, spec)
+	err := l.delegate.Put(source, key, spec)
+	if err != nil {
+		l.logger.Warn("unable to put spec", "source", source, "key", key, "err", err)
+	} else {
+		l.logger.Info("put spec", "source", source, "key", key)
+	}
+	return err
 }
 
 func (l *loggingSpecStore) ReplaceAllOf(source string, specs map[string]Spec) {
-	fmt.Printf("Replacing all (%s)\n", source)
+	l.logger.Info("replacing all specs", "source", source, "count", len(specs))
 	l.delegate.ReplaceAllOf(source, specs)
 }
 
 func (l *loggingSpecStore) Remove(source, key string) error {
-	fmt.Printf("Removing (%s - %s)\n", source, key)
-	return l.delegate.Remove(source, key)
+	err := l.delegate.Remove(source, key)
+	if err != nil {
+		l.logger.Warn("unable to remove spec", "source", source, "key", key, "err", err)
+	} else {
+		l.logger.Info("removed spec", "source", source, "key", key)
+	}
+	return err
 }
 
 func (l *loggingSpecStore) RemoveAllOf(source string) {
-	fmt.Printf("Removing all (%s)\n", source)
+	l.logger.Info("removing all specs", "source", source)
 	l.delegate.RemoveAllOf(source)
 }
 
@@ -85,6 +108,29 @@ type cachedRepository struct {
 	mu      *sync.RWMutex
 	sources map[string]map[string]struct{}
 	specs   *sortedMap
+	index   *searchIndex
+	events  *eventBroker
+	history HistoryStore
+	logger  logging.Logger
+	hashMu  sync.Mutex
+	hashes  map[string]string
+}
+
+// RepositoryOption configures optional features of the cached repository
+type RepositoryOption func(*cachedRepository)
+
+// WithLogger logs the repository warnings with the logger
+func WithLogger(logger logging.Logger) RepositoryOption {
+	return func(r *cachedRepository) {
+		r.logger = logger
+	}
+}
+
+// WithHistory records the versions of all specs put in the repository in the history store
+func WithHistory(history HistoryStore) RepositoryOption {
+	return func(r *cachedRepository) {
+		r.history = history
+	}
 }
 
 type keySpec struct {
@@ -93,12 +139,20 @@ type keySpec struct {
 }
 
 // NewCachedRepository creats a new CachedRepo
-func NewCachedRepository() SpecRepoStore {
-	return &cachedRepository{
+func NewCachedRepository(opts ...RepositoryOption) SpecRepoStore {
+	r := &cachedRepository{
 		mu:      &sync.RWMutex{},
 		sources: make(map[string]map[string]struct{}),
 		specs:   newSortedMap(),
+		index:   newSearchIndex(),
+		events:  newEventBroker(),
+		logger:  logging.Default(),
+		hashes:  make(map[string]string),
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 func (r *cachedRepository) Keys() []SpecMetadata {
@@ -120,6 +174,76 @@ func (r *cachedRepository) Spec(key string) (Spec, error) {
 	return nil, KeyNotFoundError{Repo: "cachedRepo", Key: key}
 }
 
+func (r *cachedRepository) metadata(key string) (SpecMetadata, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	spec, ok := r.specs.get(key)
+	return spec.SpecMetadata, ok
+}
+
+// Search returns the ranked hits of the query from the index, no spec is fetched
+func (r *cachedRepository) Search(query string, limit int) []SearchHit {
+	return r.index.search(query, limit, nil)
+}
+
+func (r *cachedRepository) searchMatching(query string, limit int, matches func(SpecMetadata) bool) []SearchHit {
+	return r.index.search(query, limit, matches)
+}
+
+// History of the specs in the repository, nil if the history is not recorded
+func (r *cachedRepository) History() HistoryStore {
+	return r.history
+}
+
+// wrap the spec so that it is stored as it is served and every new content of the spec is observed by the
+// repository
+func (r *cachedRepository) wrap(key SpecMetadata, spec Spec) Spec {
+	tracked := &trackedSpec{delegate: served(key, spec)}
+	tracked.observe = func(hash string, content []byte) {
+		r.index.observe(key.Key, tracked, content)
+		r.observe(key, hash, content)
+	}
+	return tracked
+}
+
+// observe the content of a key, recording it in the history and publishing a changed event if it differs
+// from the previous content of the key. Without history the content is compared with the content of the
+// key seen last, with history it is compared with the latest recorded version
+func (r *cachedRepository) observe(key SpecMetadata, hash string, content []byte) {
+	r.hashMu.Lock()
+	defer r.hashMu.Unlock()
+	previous, seen := r.hashes[key.Key]
+	if seen && previous == hash {
+		return
+	}
+	r.hashes[key.Key] = hash
+	changed := seen
+	if r.history != nil {
+		_, replaced, err := recordVersion(r.history, key.Key, key.Source, content)
+		if err != nil {
+			r.logger.Error("unable to record version", "key", key.Key, "source", key.Source, "err", err)
+		}
+		changed = replaced
+	}
+	if changed {
+		event := eventOf(Changed, key)
+		event.Hash = hash
+		r.events.publish(event)
+	}
+}
+
+// forget the content seen of the removed key
+func (r *cachedRepository) forget(key string) {
+	r.hashMu.Lock()
+	defer r.hashMu.Unlock()
+	delete(r.hashes, key)
+}
+
+// Subscribe to the changes of the repository
+func (r *cachedRepository) Subscribe() (<-chan Event, func()) {
+	return r.events.Subscribe()
+}
+
 func (r *cachedRepository) sourceOfKey(key string) (string, bool) {
 	for source, specs := range r.sources {
 		if _, ok := specs[key]; ok {
@@ -130,6 +254,9 @@ func (r *cachedRepository) sourceOfKey(key string) (string, bool) {
 }
 
 func (r *cachedRepository) checkForConflict(source, key string) error {
+	if _, reserved := reservedKeys[key]; reserved {
+		return ReservedKeyError{Key: key}
+	}
 	if _, ok := r.specs.get(key); !ok {
 		return nil
 	}
@@ -149,11 +276,20 @@ func (r *cachedRepository) Put(source, name string, spec Spec) error {
 	if err := r.checkForConflict(source, key.Key); err != nil {
 		return err
 	}
+	key.Source, key.Labels = source, LabelsOf(spec)
+	spec = r.wrap(key, spec)
+	_, existed := r.specs.get(key.Key)
 	r.sources[source][key.Key] = struct{}{}
 	r.specs.set(key.Key, keySpec{
 		SpecMetadata: key,
 		Spec:         spec,
 	})
+	r.index.set(key, spec)
+	if existed {
+		r.events.publish(eventOf(Replaced, key))
+	} else {
+		r.events.publish(eventOf(Added, key))
+	}
 	return nil
 }
 
@@ -162,21 +298,39 @@ func (r *cachedRepository) ReplaceAllOf(source string, specs map[string]Spec) {
 	defer r.mu.Unlock()
 	multi := r.specs.newMultiChange()
 	defer multi.finished()
+	previous := make(map[string]SpecMetadata, len(r.sources[source]))
 	for key := range r.sources[source] {
+		if old, ok := r.specs.get(key); ok {
+			previous[key] = old.SpecMetadata
+		}
 		multi.delete(key)
+		r.index.remove(key)
 	}
 	r.sources[source] = make(map[string]struct{}, len(specs))
 	for name, spec := range specs {
 		key := SpecMetadataOf(name)
 		if err := r.checkForConflict(source, key.Key); err != nil {
-			log.Printf("ignoring key %s from source %s when replacing all: %v", key, source, err)
+			r.logger.Warn("ignoring key when replacing all", "source", source, "key", key.Key, "err", err)
 			continue
 		}
+		key.Source, key.Labels = source, LabelsOf(spec)
+		spec = r.wrap(key, spec)
 		r.sources[source][key.Key] = struct{}{}
 		multi.set(key.Key, keySpec{
 			SpecMetadata: key,
 			Spec:         spec,
 		})
+		r.index.set(key, spec)
+		if _, ok := previous[key.Key]; ok {
+			delete(previous, key.Key)
+			r.events.publish(eventOf(Replaced, key))
+		} else {
+			r.events.publish(eventOf(Added, key))
+		}
+	}
+	for _, removed := range previous {
+		r.forget(removed.Key)
+		r.events.publish(eventOf(Removed, removed))
 	}
 }
 
@@ -186,9 +340,15 @@ func (r *cachedRepository) Remove(source, name string) error {
 	key := SpecMetadataOf(name)
 	delete(r.sources[source], key.Key)
 	if currSource, found := r.sourceOfKey(key.Key); found {
-		return fmt.Errorf("key %s already owned by %s", key, currSource)
+		return fmt.Errorf("key %s already owned by %s", key.Key, currSource)
 	}
+	old, existed := r.specs.get(key.Key)
 	r.specs.delete(key.Key)
+	r.index.remove(key.Key)
+	if existed {
+		r.forget(key.Key)
+		r.events.publish(eventOf(Removed, old.SpecMetadata))
+	}
 	return nil
 }
 
@@ -198,11 +358,76 @@ func (r *cachedRepository) RemoveAllOf(source string) {
 	multi := r.specs.newMultiChange()
 	defer multi.finished()
 	for key := range r.sources[source] {
+		old, existed := r.specs.get(key)
 		multi.delete(key)
+		r.index.remove(key)
+		if existed {
+			r.forget(key)
+			r.events.publish(eventOf(Removed, old.SpecMetadata))
+		}
 	}
 	delete(r.sources, source)
 }
 
+// trackedSpec passes every new content of the delegate to observe and holds the conversions of the delegate
+type trackedSpec struct {
+	delegate  Spec
+	observe   func(hash string, content []byte)
+	mu        sync.Mutex
+	lastHash  string
+	converted map[OpenAPIVersion]Spec
+}
+
+func (s *trackedSpec) Get() ([]byte, error) {
+	content, err := s.delegate.Get()
+	if err != nil {
+		return nil, err
+	}
+	hash := ContentHash(content)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hash != s.lastHash {
+		s.lastHash = hash
+		s.observe(hash, content)
+	}
+	return content, nil
+}
+
+func (s *trackedSpec) Document() (*Document, error) {
+	if _, err := s.Get(); err != nil {
+		return nil, err
+	}
+	return DocumentOf(s.delegate)
+}
+
+func (s *trackedSpec) Unwrap() Spec {
+	return s.delegate
+}
+
+// ConvertedTo returns the conversion of the spec to the version, it is only converted again when the content
+// of the spec changes
+func (s *trackedSpec) ConvertedTo(version OpenAPIVersion) Spec {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if converted, ok := s.converted[version]; ok {
+		return converted
+	}
+	if s.converted == nil {
+		s.converted = make(map[OpenAPIVersion]Spec)
+	}
+	s.converted[version] = convertedToOpenAPI3(s, version)
+	return s.converted[version]
+}
+
+// Refresh observes the content of the spec after it was refreshed in the background
+func (s *trackedSpec) Refresh() (bool, error) {
+	refreshed, err := RefreshOf(s.delegate)
+	if refreshed && err == nil {
+		_, err = s.Get()
+	}
+	return refreshed, err
+}
+
 type sortedMap struct {
 	m map[string]keySpec
 	l []string
@@ -1,9 +1,13 @@
 package openapi
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 type testSpec string
@@ -16,6 +20,17 @@ func rndSpec() Spec {
 	return testSpec(fmt.Sprintf("test-spec-%d", rand.Int()))
 }
 
+// sameSpec is true if the stored spec serves the content of the expected spec, the repository wraps
+// the specs it stores
+func sameSpec(stored, expected Spec) bool {
+	if stored == nil {
+		return false
+	}
+	content, err := stored.Get()
+	expectedContent, _ := expected.Get()
+	return err == nil && string(content) == string(expectedContent)
+}
+
 func Test_cantOverwriteKeyOwnedByOtherSource(t *testing.T) {
 	source1 := "existingSourceOwningKey"
 	source2 := "source2"
@@ -70,7 +85,7 @@ func Test_cantOverwriteKeyOwnedByOtherSource(t *testing.T) {
 			if err := r.Put(tt.args.source, tt.args.name, tt.args.specToPut); (err != nil) != tt.wantErr {
 				t.Errorf("Put() error = %v, wantErr %v", err, tt.wantErr)
 			}
-			if spec, err := r.Spec(tt.args.name); err != nil || spec != tt.args.specAfterPut {
+			if spec, err := r.Spec(tt.args.name); err != nil || !sameSpec(spec, tt.args.specAfterPut) {
 				t.Errorf("Expected to find spec %v found %v and err %v", tt.args.specAfterPut, spec, err)
 			}
 		})
@@ -86,7 +101,7 @@ func Test_cantDeleteKeyOwnedByOtherSource(t *testing.T) {
 	if err := r.Remove("not-owner", key); err == nil {
 		t.Errorf("was able to remove key owned by another repo with no error")
 	}
-	if fs, err := r.Spec(key); fs != spec {
+	if fs, err := r.Spec(key); !sameSpec(fs, spec) {
 		t.Errorf("found spec %v differes from expected spec %v (error: %v)", fs, spec, err)
 	}
 	check("owner remove", t, r.Remove(ownerSource, key))
@@ -101,7 +116,7 @@ func Test_cantReplaceKeyOwnedByOtherSource(t *testing.T) {
 	key := "key"
 	spec := rndSpec()
 	checkForSpec := func(expectedSpec Spec) {
-		if fs, err := r.Spec(key); fs != expectedSpec {
+		if fs, err := r.Spec(key); !sameSpec(fs, expectedSpec) {
 			t.Errorf("found spec %v differes from expected spec %v (error: %v)", fs, expectedSpec, err)
 		}
 	}
@@ -114,6 +129,17 @@ func Test_cantReplaceKeyOwnedByOtherSource(t *testing.T) {
 	checkForSpec(newSpec)
 }
 
+func Test_cantStoreReservedKeys(t *testing.T) {
+	r := NewCachedRepository()
+	if err := r.Put("s1", "Search", rndSpec()); err == nil {
+		t.Errorf("expected the key of the search endpoint to be rejected")
+	}
+	r.ReplaceAllOf("s1", map[string]Spec{"_merged": rndSpec(), "pets": rndSpec()})
+	if keys := r.Keys(); len(keys) != 1 || keys[0].Key != "pets" {
+		t.Errorf("expected only the unreserved key to be stored, got %v", keys)
+	}
+}
+
 func Test_keysAreSorted(t *testing.T) {
 	type sourceAndKey struct {
 		source, key string
@@ -146,3 +172,53 @@ func check(operation string, t *testing.T, err error) {
 		t.Errorf("op: '%s' expected no error got: %v", operation, err)
 	}
 }
+
+func TestListingGroupsSpecsByGroupLabel(t *testing.T) {
+	r := NewCachedRepository()
+	for name, group := range map[string]string{"orders.team-b": "team-b", "env-spec": "", "orders.team-a": "team-a", "pets.team-b": "team-b"} {
+		if err := r.Put("s1", name, WithLabels(testSpec("{}"), map[string]string{GroupLabel: group})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, handler := keyHandler(nil)(r)
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+	var keys []KeyUrls
+	if err := json.NewDecoder(rw.Body).Decode(&keys); err != nil {
+		t.Fatal(err)
+	}
+	var listed []string
+	for _, k := range keys {
+		listed = append(listed, k.Group+":"+k.Key)
+	}
+	if fmt.Sprint(listed) != "[:env-spec team-a:orders.team-a team-b:orders.team-b team-b:pets.team-b]" {
+		t.Errorf("expected the specs to be listed by group, got %v", listed)
+	}
+}
+
+func TestListingDoesNotFetchSpecs(t *testing.T) {
+	r := NewCachedRepository()
+	upstream := &countingSpec{}
+	check("put", t, r.Put("s1", "invoices", Cached(upstream, time.Minute)))
+	_, handler := keyHandler(DefaultLinter())(r)
+	list := func() KeyUrls {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+		var keys []KeyUrls
+		check("decode keys", t, json.NewDecoder(rw.Body).Decode(&keys))
+		if len(keys) != 1 {
+			t.Fatalf("expected a single key, got %v", keys)
+		}
+		return keys[0]
+	}
+	if listed := list(); upstream.calls != 0 || listed.Title != "" || listed.LintScore != nil {
+		t.Errorf("expected the listing not to fetch the spec, got %d fetches and %v", upstream.calls, listed)
+	}
+	spec, err := r.Spec("invoices")
+	check("spec", t, err)
+	_, err = spec.Get()
+	check("get", t, err)
+	if listed := list(); upstream.calls != 1 || listed.Title != "Invoices" || len(listed.Operations) != 3 || listed.LintScore == nil {
+		t.Errorf("expected the listing to contain the cached document, got %d fetches and %v", upstream.calls, listed)
+	}
+}
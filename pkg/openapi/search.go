@@ -0,0 +1,221 @@
+package openapi
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Searchable is a Repository whose specs can be searched
+type Searchable interface {
+	Search(query string, limit int) []SearchHit
+}
+
+// filteredSearchable is a Searchable that ranks the hits of the specs matching the filter only, so that
+// the hits of the other specs don't count towards the limit
+type filteredSearchable interface {
+	searchMatching(query string, limit int, matches func(SpecMetadata) bool) []SearchHit
+}
+
+// SearchHit is a single ranked match of a search
+type SearchHit struct {
+	Key     string  `json:"key"`
+	Name    string  `json:"name"`
+	Pointer string  `json:"pointer"`
+	Field   string  `json:"field"`
+	Method  string  `json:"method,omitempty"`
+	Path    string  `json:"path,omitempty"`
+	Schema  string  `json:"schema,omitempty"`
+	Summary string  `json:"summary,omitempty"`
+	Score   float64 `json:"score"`
+}
+
+type searchField struct {
+	name   string
+	weight float64
+	text   string
+}
+
+type searchDoc struct {
+	hit    SearchHit
+	fields []searchField
+}
+
+type indexEntry struct {
+	meta SpecMetadata
+	spec Spec
+	docs []searchDoc
+}
+
+// searchIndex is an incrementally updated index over the documents of specs. Queries are served from the
+// index only, entries are indexed from the cached document of their spec when they are stored and
+// re-indexed whenever new content of their spec is observed, the index never fetches a spec
+type searchIndex struct {
+	mu      sync.Mutex
+	entries map[string]*indexEntry
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{entries: make(map[string]*indexEntry)}
+}
+
+// set the spec of the key, indexing its cached document if it has one
+func (i *searchIndex) set(meta SpecMetadata, spec Spec) {
+	e := &indexEntry{meta: meta, spec: spec}
+	if doc, ok := CachedDocumentOf(spec); ok {
+		e.docs = searchDocsOf(meta, doc)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.entries[meta.Key] = e
+}
+
+func (i *searchIndex) remove(key string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.entries, key)
+}
+
+// observe new content of the spec of the key, re-indexing its entry unless the spec was replaced
+func (i *searchIndex) observe(key string, spec Spec, content []byte) {
+	doc, err := ParseDocument(content)
+	if err != nil {
+		doc = nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if e := i.entries[key]; e != nil && e.spec == spec {
+		e.docs = searchDocsOf(e.meta, doc)
+	}
+}
+
+// search the entries matching the filter, all entries if it is nil
+func (i *searchIndex) search(query string, limit int, matches func(SpecMetadata) bool) []SearchHit {
+	terms := strings.Fields(strings.ToLower(query))
+	hits := make([]SearchHit, 0)
+	if len(terms) == 0 {
+		return hits
+	}
+	i.mu.Lock()
+	for _, e := range i.entries {
+		if matches != nil && !matches(e.meta) {
+			continue
+		}
+		for _, d := range e.docs {
+			if hit, ok := d.match(terms); ok {
+				hits = append(hits, hit)
+			}
+		}
+	}
+	i.mu.Unlock()
+	sort.Slice(hits, func(a, b int) bool {
+		if hits[a].Score != hits[b].Score {
+			return hits[a].Score > hits[b].Score
+		}
+		if hits[a].Key != hits[b].Key {
+			return hits[a].Key < hits[b].Key
+		}
+		return hits[a].Pointer < hits[b].Pointer
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// match requires every term to match at least one field, an exact word match scores double
+func (d searchDoc) match(terms []string) (SearchHit, bool) {
+	hit := d.hit
+	best := 0.0
+	for _, term := range terms {
+		termScore := 0.0
+		for _, f := range d.fields {
+			if !strings.Contains(f.text, term) {
+				continue
+			}
+			score := f.weight
+			if containsWord(f.text, term) {
+				score *= 2
+			}
+			termScore += score
+			if score > best {
+				best = score
+				hit.Field = f.name
+			}
+		}
+		if termScore == 0 {
+			return SearchHit{}, false
+		}
+		hit.Score += termScore
+	}
+	return hit, true
+}
+
+func containsWord(text, word string) bool {
+	for _, w := range strings.FieldsFunc(text, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127)
+	}) {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+func searchDocsOf(meta SpecMetadata, doc *Document) []searchDoc {
+	docs := make([]searchDoc, 0)
+	if doc == nil {
+		return docs
+	}
+	for _, op := range doc.Operations {
+		docs = append(docs, searchDoc{
+			hit: SearchHit{
+				Key:     meta.Key,
+				Name:    meta.Name,
+				Pointer: jsonPointer("paths", op.Path, op.Method),
+				Method:  op.Method,
+				Path:    op.Path,
+				Summary: op.Summary,
+			},
+			fields: []searchField{
+				{"operationId", 4, strings.ToLower(op.OperationID)},
+				{"path", 3, strings.ToLower(op.Path)},
+				{"summary", 3, strings.ToLower(op.Summary)},
+				{"tags", 2, strings.ToLower(strings.Join(op.Tags, " "))},
+				{"description", 1, strings.ToLower(op.Description)},
+			},
+		})
+	}
+	schemaRoot := []string{"components", "schemas"}
+	if doc.IsSwagger2() {
+		schemaRoot = []string{"definitions"}
+	}
+	schemas := objectAt(doc.Raw, schemaRoot...)
+	for _, name := range doc.Schemas {
+		schema, _ := schemas[name].(map[string]interface{})
+		docs = append(docs, searchDoc{
+			hit: SearchHit{
+				Key:     meta.Key,
+				Name:    meta.Name,
+				Pointer: jsonPointer(append(schemaRoot, name)...),
+				Schema:  name,
+				Summary: stringAt(schema, "title"),
+			},
+			fields: []searchField{
+				{"schema", 4, strings.ToLower(name)},
+				{"description", 1, strings.ToLower(stringAt(schema, "description"))},
+			},
+		})
+	}
+	return docs
+}
+
+// jsonPointer builds a json pointer (RFC 6901) from the given reference tokens
+func jsonPointer(tokens ...string) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteString("/")
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(t, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
@@ -0,0 +1,127 @@
+package openapi
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_searchFindsOperationsAndSchemas(t *testing.T) {
+	r := NewCachedRepository()
+	check("put invoices", t, r.Put("s1", "invoices", testSpec(oas3Spec)))
+	check("put pets", t, r.Put("s1", "pets", testSpec(swagger2Spec)))
+	fetchAll(t, r)
+	searchable := r.(Searchable)
+	hits := searchable.Search("invoice", 0)
+	if len(hits) == 0 {
+		t.Fatalf("expected hits for invoice")
+	}
+	expected := []string{"/paths/~1invoices~1{id}/get", "/paths/~1invoices~1{id}/delete", "/components/schemas/Invoice"}
+	if len(hits) != len(expected) {
+		t.Fatalf("unexpected hits %v", hits)
+	}
+	for i, pointer := range expected {
+		if hits[i].Key != "invoices" || hits[i].Pointer != pointer {
+			t.Errorf("unexpected hit %v in position %d, expected %s", hits[i], i, pointer)
+		}
+	}
+	hits = searchable.Search("get invoice", 0)
+	if len(hits) != 1 || hits[0].Pointer != "/paths/~1invoices~1{id}/get" {
+		t.Errorf("expected single hit on get invoice operation, got %v", hits)
+	}
+	hits = searchable.Search("pet", 1)
+	if len(hits) != 1 || hits[0].Key != "pets" || hits[0].Pointer != "/definitions/Pet" {
+		t.Errorf("expected limited hit on Pet definition, got %v", hits)
+	}
+}
+
+func Test_searchIndexFollowsStoreChanges(t *testing.T) {
+	r := NewCachedRepository()
+	searchable := r.(Searchable)
+	search := func() []SearchHit {
+		return searchable.Search("pets", 0)
+	}
+	r.ReplaceAllOf("s1", map[string]Spec{"pets": testSpec(swagger2Spec)})
+	fetchAll(t, r)
+	if len(search()) == 0 {
+		t.Errorf("expected hits after replacing all")
+	}
+	r.ReplaceAllOf("s1", map[string]Spec{"invoices": testSpec(oas3Spec)})
+	if hits := search(); len(hits) != 0 {
+		t.Errorf("expected no hits after replacing pets, got %v", hits)
+	}
+	check("put", t, r.Put("s2", "pets", testSpec(swagger2Spec)))
+	fetchAll(t, r)
+	if len(search()) == 0 {
+		t.Errorf("expected hits after put")
+	}
+	check("remove", t, r.Remove("s2", "pets"))
+	if hits := search(); len(hits) != 0 {
+		t.Errorf("expected no hits after remove, got %v", hits)
+	}
+}
+
+func Test_searchServesQueriesFromTheIndex(t *testing.T) {
+	r := NewCachedRepository()
+	upstream := &countingSpec{}
+	check("put", t, r.Put("s1", "invoices", upstream))
+	searchable := r.(Searchable)
+	if hits := searchable.Search("invoice", 0); len(hits) != 0 || upstream.calls != 0 {
+		t.Fatalf("expected the spec not to be fetched nor found before its content is known, got %v", hits)
+	}
+	fetchAll(t, r)
+	for i := 0; i < 3; i++ {
+		if hits := searchable.Search("invoice", 0); len(hits) == 0 {
+			t.Fatalf("expected hits for invoice")
+		}
+	}
+	if upstream.calls != 1 {
+		t.Errorf("expected the spec to be fetched once, got %d fetches", upstream.calls)
+	}
+}
+
+func Test_searchIndexesCachedDocumentsWhenStored(t *testing.T) {
+	r := NewCachedRepository()
+	upstream := &countingSpec{}
+	cached := Cached(upstream, time.Minute)
+	_, err := cached.Get()
+	check("get", t, err)
+	check("put", t, r.Put("s1", "invoices", cached))
+	if hits := r.(Searchable).Search("invoice", 0); len(hits) == 0 {
+		t.Errorf("expected the cached document to be indexed when stored")
+	}
+	if upstream.calls != 1 {
+		t.Errorf("expected the spec not to be fetched again, got %d fetches", upstream.calls)
+	}
+}
+
+func Test_searchIndexFollowsObservedContent(t *testing.T) {
+	r := NewCachedRepository()
+	upstream := &mutableSpec{content: swagger2Spec}
+	check("put", t, r.Put("s1", "pets", upstream))
+	fetchAll(t, r)
+	searchable := r.(Searchable)
+	if len(searchable.Search("pet", 0)) == 0 {
+		t.Fatalf("expected hits for pet")
+	}
+	upstream.content = oas3Spec
+	spec, err := r.Spec("pets")
+	check("spec", t, err)
+	_, err = spec.Get()
+	check("get", t, err)
+	if hits := searchable.Search("pet", 0); len(hits) != 0 {
+		t.Errorf("expected no hits for pet after the content changed, got %v", hits)
+	}
+	if len(searchable.Search("invoice", 0)) == 0 {
+		t.Errorf("expected hits for invoice after the content changed")
+	}
+}
+
+// fetchAll fetches every spec of the repository so that its content is indexed
+func fetchAll(t *testing.T, r Repository) {
+	for _, meta := range r.Keys() {
+		spec, err := r.Spec(meta.Key)
+		check("spec", t, err)
+		_, err = spec.Get()
+		check("get", t, err)
+	}
+}
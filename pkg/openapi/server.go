@@ -3,25 +3,102 @@ package openapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/SimonSchneider/docs-prox/pkg/authn"
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+	"github.com/SimonSchneider/docs-prox/pkg/metrics"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 )
 
+type serveOptions struct {
+	status     *StatusRegistry
+	logger     logging.Logger
+	auth       *authn.Middleware
+	visibility Visibility
+	proxy      *specProxy
+	linter     *Linter
+}
+
+// ServeOption configures optional features of the server
+type ServeOption func(*serveOptions)
+
+// WithStatus reports the status of the providers in the registry on /healthz and /readyz
+func WithStatus(status *StatusRegistry) ServeOption {
+	return func(o *serveOptions) {
+		o.status = status
+	}
+}
+
+// WithServerLogger logs the requests and the errors of the server with the logger
+func WithServerLogger(logger logging.Logger) ServeOption {
+	return func(o *serveOptions) {
+		o.logger = logger
+	}
+}
+
+// WithAuth requires the requests to be authenticated by the middleware, the callers only see the specs
+// visible to them
+func WithAuth(auth *authn.Middleware, visibility Visibility) ServeOption {
+	return func(o *serveOptions) {
+		o.auth = auth
+		o.visibility = visibility
+	}
+}
+
+// WithLinter lints the specs with the linter instead of the default linter, nil disables linting
+func WithLinter(linter *Linter) ServeOption {
+	return func(o *serveOptions) {
+		o.linter = linter
+	}
+}
+
+// reservedKeys are the keys of the endpoints served under /docs next to the specs, specs can not be stored
+// with them as they would be shadowed
+var reservedKeys = map[string]struct{}{"search": {}, "_merged": {}, "_events": {}, "_status": {}}
+
 // Serve starts a server that serves the repo
-func Serve(ctx context.Context, repo Repository, host string, port int) (net.Listener, <-chan error) {
+func Serve(ctx context.Context, repo Repository, host string, port int, opts ...ServeOption) (net.Listener, <-chan error) {
+	options := &serveOptions{status: NewStatusRegistry(), logger: logging.Default(), linter: DefaultLinter()}
+	for _, opt := range opts {
+		opt(options)
+	}
 	r := mux.NewRouter()
 	fs := http.FileServer(http.Dir("./dist"))
-	for _, fun := range []repoHandlerFunc{keyHandler, docsHandler} {
+	r.Handle("/healthz", metrics.InstrumentHandler("/healthz", healthHandler(options.status, options.status.Healthy)))
+	r.Handle("/readyz", metrics.InstrumentHandler("/readyz", healthHandler(options.status, options.status.Ready)))
+	collector := NewRepositoryCollector(repo)
+	if options.auth != nil && options.visibility.restricted() {
+		collector = NewSourceCollector(repo)
+	}
+	r.Handle("/metrics", metrics.Handler(metrics.NewRegistry(collector)))
+	for _, fun := range []repoHandlerFunc{keyHandler(options.linter), searchHandler, mergedHandler, eventsHandler, statusHandler(options.status), docsHandler(options.proxy), versionsHandler, versionHandler, diffHandler, lintHandler(options.linter)} {
 		path, handler := fun(repo)
-		r.Handle(fmt.Sprintf("/docs%s", path), handler)
+		if options.auth != nil {
+			handler = visibleHandler(fun, repo, options.visibility)
+		}
+		r.Handle(fmt.Sprintf("/docs%s", path), metrics.InstrumentHandler(fmt.Sprintf("/docs%s", path), handler))
 	}
-	r.PathPrefix("/").Handler(http.StripPrefix("/", fs))
+	if proxy := options.proxy; proxy != nil {
+		if options.auth != nil {
+			proxy = proxy.authenticatedBy(options.auth)
+		}
+		path, handler := proxy.handler(repo)
+		if options.auth != nil {
+			handler = visibleHandler(proxy.handler, repo, options.visibility)
+		}
+		r.PathPrefix(path).Handler(metrics.InstrumentHandler(path, handler))
+	}
+	r.PathPrefix("/").Handler(metrics.InstrumentHandler("/", http.StripPrefix("/", fs)))
 
 	listener, err := net.Listen("tcp4", net.JoinHostPort(host, strconv.Itoa(port)))
 	errFuture := make(chan error)
@@ -31,7 +108,12 @@ func Serve(ctx context.Context, repo Repository, host string, port int) (net.Lis
 		return nil, errFuture
 	}
 	docServer := new(http.Server)
-	docServer.Handler = handlers.CORS()(r)
+	var handler http.Handler = r
+	if options.auth != nil {
+		handler = options.auth.Wrap(r)
+	}
+	docServer.Handler = accessLog(options.logger, handlers.CORS()(handler))
+	docServer.BaseContext = func(net.Listener) context.Context { return ctx }
 	go func() {
 		defer close(errFuture)
 		err := docServer.Serve(listener)
@@ -41,54 +123,606 @@ func Serve(ctx context.Context, repo Repository, host string, port int) (net.Lis
 		<-ctx.Done()
 		deadline, cancel := context.WithDeadline(context.Background(), time.Now().Add(10*time.Second))
 		defer cancel()
-		fmt.Printf("shutting down server gracefully with a 10 second timeout\n")
+		options.logger.Info("shutting down server gracefully", "timeout", 10*time.Second)
 		docServer.Shutdown(deadline)
 	}()
 	return listener, errFuture
 }
 
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.size += n
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// quietPaths are polled by probes and scrapers and only logged at debug level
+var quietPaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// accessLog logs every request and makes the logger available to the handlers through the request context
+func accessLog(logger logging.Logger, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		reqLogger := logger.With("method", r.Method, "path", r.URL.Path)
+		recorder := &statusRecorder{ResponseWriter: rw}
+		handler.ServeHTTP(recorder, r.WithContext(logging.NewContext(r.Context(), reqLogger)))
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		log := reqLogger.Info
+		if quietPaths[r.URL.Path] {
+			log = reqLogger.Debug
+		}
+		log("request", "status", recorder.status, "bytes", recorder.size,
+			"duration", time.Since(start), "remote", r.RemoteAddr, "userAgent", r.UserAgent())
+	})
+}
+
 type repoHandlerFunc func(repository Repository) (string, http.Handler)
 
-func keyHandler(repo Repository) (string, http.Handler) {
-	return "/", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		rw.Header().Set("Content-Type", "application/json")
-		keys := repo.Keys()
-		prep := make([]KeyUrls, 0, len(keys))
+// visibleHandler serves every request with the view of the repo visible to the principal of the request
+func visibleHandler(fun repoHandlerFunc, repo Repository, visibility Visibility) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		principal, _ := authn.FromContext(r.Context())
+		_, handler := fun(VisibleTo(repo, visibility.For(principal)))
+		handler.ServeHTTP(rw, r)
+	})
+}
+
+// keyHandler lists the keys with the lint score of their specs if there is a linter. The listing is built
+// from the cached documents only, specs that have not been warmed or opened yet are listed without their info
+func keyHandler(linter *Linter) repoHandlerFunc {
+	return func(repo Repository) (string, http.Handler) {
+		return "/", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", "application/json")
+			keys := repo.Keys()
+			prep := make([]KeyUrls, 0, len(keys))
+			for _, k := range keys {
+				var doc *Document
+				if spec, err := repo.Spec(k.Key); err == nil {
+					doc, _ = CachedDocumentOf(spec)
+				}
+				urls := keyUrlsOf(k, r.URL.Path+k.Key, doc)
+				if linter != nil && doc != nil {
+					score := linter.reportOf(k.Key, doc).Score
+					urls.LintScore = &score
+				}
+				prep = append(prep, urls)
+			}
+			sort.SliceStable(prep, func(i, j int) bool { return prep[i].Group < prep[j].Group })
+			err := json.NewEncoder(rw).Encode(prep)
+			if err != nil {
+				rw.WriteHeader(http.StatusInternalServerError)
+			}
+		})
+	}
+}
+
+// KeyUrls is returned in the Keys endpoint
+type KeyUrls struct {
+	Key         string            `json:"key"`
+	Name        string            `json:"name"`
+	Path        string            `json:"path"`
+	Source      string            `json:"source"`
+	Group       string            `json:"group,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Title       string            `json:"title,omitempty"`
+	Version     string            `json:"version,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Servers     []string          `json:"servers,omitempty"`
+	Tags        []Tag             `json:"tags,omitempty"`
+	Operations  []Operation       `json:"operations,omitempty"`
+	LintScore   *int              `json:"lintScore,omitempty"`
+}
+
+func keyUrlsOf(k SpecMetadata, path string, doc *Document) KeyUrls {
+	urls := KeyUrls{Key: k.Key, Name: k.Name, Path: path, Source: k.Source, Group: k.Labels[GroupLabel], Labels: k.Labels}
+	if doc != nil {
+		urls.Title = doc.Title
+		urls.Version = doc.Version
+		urls.Description = doc.Description
+		urls.Servers = doc.Servers
+		urls.Tags = doc.Tags
+		urls.Operations = doc.Operations
+	}
+	return urls
+}
+
+const (
+	fetchParallelism = 16
+	fetchTimeout     = 5 * time.Second
+)
+
+// documentsOf fetches and parses the documents of all keys in parallel, keys that fail or that
+// are not done within the timeout are left out
+func documentsOf(ctx context.Context, repo Repository, keys []SpecMetadata) map[string]*Document {
+	type keyDoc struct {
+		key string
+		doc *Document
+	}
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	results := make(chan keyDoc, len(keys))
+	sem := make(chan struct{}, fetchParallelism)
+	go func() {
 		for _, k := range keys {
-			prep = append(prep, KeyUrls{Key: k.Key, Name: k.Name, Path: r.URL.Path + k.Key})
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(key string) {
+				defer func() { <-sem }()
+				var doc *Document
+				if spec, err := repo.Spec(key); err == nil {
+					doc, _ = DocumentOf(spec)
+				}
+				results <- keyDoc{key: key, doc: doc}
+			}(k.Key)
+		}
+	}()
+	docs := make(map[string]*Document, len(keys))
+	for range keys {
+		select {
+		case res := <-results:
+			docs[res.key] = res.doc
+		case <-ctx.Done():
+			return docs
+		}
+	}
+	return docs
+}
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+func searchHandler(repo Repository) (string, http.Handler) {
+	return "/search", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		searchable, ok := repo.(Searchable)
+		if !ok {
+			rw.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		limit := defaultSearchLimit
+		if l := r.URL.Query().Get("limit"); l != "" {
+			parsed, err := strconv.Atoi(l)
+			if err != nil || parsed <= 0 {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			limit = parsed
 		}
-		err := json.NewEncoder(rw).Encode(prep)
+		if limit > maxSearchLimit {
+			limit = maxSearchLimit
+		}
+		hits := searchable.Search(r.URL.Query().Get("q"), limit)
+		rw.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(rw).Encode(hits); err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+}
+
+func mergedHandler(repo Repository) (string, http.Handler) {
+	return "/_merged", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter, err := filterOf(query)
 		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		format, err := requestedFormat(r, JSON)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		result := Merge(r.Context(), repo, filter, MergeOptions{Title: query.Get("title"), Version: query.Get("version")})
+		rw.Header().Set("X-Merge-Conflicts", strconv.Itoa(len(result.Conflicts)))
+		if len(result.Conflicts) > 0 {
+			if strict, _ := strconv.ParseBool(query.Get("strict")); strict {
+				rw.Header().Set("Content-Type", "application/json")
+				rw.WriteHeader(http.StatusConflict)
+				_ = json.NewEncoder(rw).Encode(result.Conflicts)
+				return
+			}
+			result.Document["x-merge-conflicts"] = result.Conflicts
+		}
+		bytes, err := json.Marshal(result.Document)
+		if err == nil {
+			bytes, err = ConvertFormat(bytes, format)
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("unable to encode merged spec", "err", err)
 			rw.WriteHeader(http.StatusInternalServerError)
+			return
 		}
+		rw.Header().Set("Content-Type", format.ContentType())
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write(bytes)
 	})
 }
 
-// KeyUrls is returned in the Keys endpoint
-type KeyUrls struct {
-	Key  string `json:"key"`
-	Name string `json:"name"`
-	Path string `json:"path"`
+// filterOf parses the repeatable key, source and label (name=value) query parameters
+func filterOf(query url.Values) (MetadataFilter, error) {
+	filter := MetadataFilter{Keys: query["key"], Sources: query["source"]}
+	for _, l := range query["label"] {
+		pair := strings.SplitN(l, "=", 2)
+		if len(pair) != 2 {
+			return filter, fmt.Errorf("invalid label filter %s, expected name=value", l)
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[pair[0]] = pair[1]
+	}
+	return filter, nil
 }
 
-func docsHandler(repo Repository) (string, http.Handler) {
-	return "/{key}", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
+const eventsKeepAlive = 30 * time.Second
+
+func eventsHandler(repo Repository) (string, http.Handler) {
+	return "/_events", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		watchable, ok := repo.(Watchable)
+		if !ok {
+			rw.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		flusher, ok := rw.(http.Flusher)
+		if !ok {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		events, unsubscribe := watchable.Subscribe()
+		defer unsubscribe()
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.Header().Set("Connection", "keep-alive")
+		rw.WriteHeader(http.StatusOK)
+		fmt.Fprintf(rw, "retry: %d\n\n", 3000)
+		flusher.Flush()
+		keepAlive := time.NewTicker(eventsKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(rw, ": keep-alive\n\n")
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", event.Type, data)
+			}
+			flusher.Flush()
+		}
+	})
+}
+
+// HealthStatus is the response of the health and readiness endpoints
+type HealthStatus struct {
+	Status    string           `json:"status"`
+	Providers []ProviderStatus `json:"providers"`
+}
+
+func healthHandler(status *StatusRegistry, check func() bool) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		rw.Header().Set("Content-Type", "application/json")
+		resp := HealthStatus{Status: "ok", Providers: status.Providers()}
+		if !check() {
+			resp.Status = "unavailable"
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(rw).Encode(resp); err != nil {
+			logging.FromContext(r.Context()).Error("unable to encode health status", "err", err)
+		}
+	})
+}
+
+// SpecStatus is the result of the last fetch of a key
+type SpecStatus struct {
+	Key        string     `json:"key"`
+	Name       string     `json:"name"`
+	Source     string     `json:"source"`
+	State      string     `json:"state"`
+	FetchedAt  *time.Time `json:"fetchedAt,omitempty"`
+	LatencyMs  int64      `json:"latencyMs"`
+	AgeSeconds int64      `json:"ageSeconds"`
+	Stale      bool       `json:"stale,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Status is the response of the status endpoint
+type Status struct {
+	Providers []ProviderStatus `json:"providers"`
+	Specs     []SpecStatus     `json:"specs"`
+}
+
+func statusHandler(status *StatusRegistry) repoHandlerFunc {
+	return func(repo Repository) (string, http.Handler) {
+		return "/_status", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", "application/json")
+			keys := repo.Keys()
+			resp := Status{Providers: status.Providers(), Specs: make([]SpecStatus, 0, len(keys))}
+			for _, k := range keys {
+				specStatus := SpecStatus{Key: k.Key, Name: k.Name, Source: k.Source, State: "pending"}
+				if spec, err := repo.Spec(k.Key); err == nil {
+					if stats, ok := FetchStatsOf(spec); ok {
+						fetch := stats.Last
+						specStatus.State = "ok"
+						specStatus.FetchedAt = &fetch.FetchedAt
+						specStatus.LatencyMs = fetch.Latency.Milliseconds()
+						specStatus.AgeSeconds = int64(time.Since(fetch.FetchedAt).Seconds())
+						specStatus.Stale = stats.Stale
+						if fetch.Err != nil {
+							specStatus.State, specStatus.Error = "error", fetch.Err.Error()
+						}
+					}
+				}
+				resp.Specs = append(resp.Specs, specStatus)
+			}
+			if err := json.NewEncoder(rw).Encode(resp); err != nil {
+				logging.FromContext(r.Context()).Error("unable to encode status", "err", err)
+			}
+		})
+	}
+}
+
+// docsHandler serves the specs with their transforms applied, pointing their servers at the proxy if it
+// rewrites them
+func docsHandler(proxy *specProxy) repoHandlerFunc {
+	return func(repo Repository) (string, http.Handler) {
+		return "/{key}", specHandler(repo, proxy)
+	}
+}
+
+func specHandler(repo Repository, proxy *specProxy) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
 		key := vars["key"]
 		spec, err := repo.Spec(key)
 		if err != nil {
-			fmt.Printf("unable to get key %s: %v\n", key, err)
+			logging.FromContext(r.Context()).Debug("unable to get key", "key", key, "err", err)
 			rw.WriteHeader(http.StatusNotFound)
 			return
 		}
+		upstream := spec
+		if v := r.URL.Query().Get("openapi"); v != "" {
+			version, err := ParseOpenAPIVersion(v)
+			if err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			spec = ConvertedToOpenAPI3(spec, version)
+		}
+		spec = proxy.rewrite(key, spec)
 		bytes, err := spec.Get()
 		if err != nil {
-			fmt.Printf("unable to retrieve spec %s: %v\n", key, err)
+			logging.FromContext(r.Context()).Warn("unable to retrieve spec", "key", key, "err", err)
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		format, err := requestedFormat(r, DetectFormat(bytes))
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		bytes, err = ConvertFormat(bytes, format)
+		if err != nil {
+			logging.FromContext(r.Context()).Warn("unable to convert spec", "key", key, "err", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", format.ContentType())
+		rw.Header().Add("Vary", "Accept")
+		setStaleness(rw.Header(), upstream)
 		rw.WriteHeader(http.StatusOK)
 		_, _ = rw.Write(bytes)
 	})
 }
+
+// setStaleness sets the Age of the served content and warns if it is stale, ie. the upstream is down or
+// the spec is being revalidated in the background
+func setStaleness(header http.Header, spec Spec) {
+	stats, ok := FetchStatsOf(spec)
+	if !ok || stats.ContentFetchedAt.IsZero() {
+		return
+	}
+	header.Set("Age", strconv.Itoa(int(time.Since(stats.ContentFetchedAt).Seconds())))
+	if stats.Stale {
+		header.Set("Warning", `110 - "Response is Stale"`)
+	}
+}
+
+// requestedFormat uses the format query parameter if present and otherwise negotiates the format
+// based on the Accept header, falling back to the format of the spec
+func requestedFormat(r *http.Request, specFormat Format) (Format, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return ParseFormat(f)
+	}
+	return NegotiateFormat(r.Header.Get("Accept"), specFormat), nil
+}
+
+func historyOf(repo Repository) (HistoryStore, bool) {
+	if v, ok := repo.(Versioned); ok && v.History() != nil {
+		return v.History(), true
+	}
+	return nil, false
+}
+
+func versionsHandler(repo Repository) (string, http.Handler) {
+	return "/{key}/versions", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		key := mux.Vars(r)["key"]
+		history, ok := historyOf(repo)
+		if !ok {
+			rw.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		if _, err := repo.Spec(key); err != nil {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		versions, err := history.Versions(key)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("unable to get versions", "key", key, "err", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(rw).Encode(versions); err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+}
+
+func versionHandler(repo Repository) (string, http.Handler) {
+	return "/{key}/versions/{id}", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		key, id := vars["key"], vars["id"]
+		history, ok := historyOf(repo)
+		if !ok {
+			rw.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		if _, err := repo.Spec(key); err != nil {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		bytes, err := history.Content(key, id)
+		if errors.As(err, &VersionNotFoundError{}) {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("unable to get version", "key", key, "version", id, "err", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		format, err := requestedFormat(r, DetectFormat(bytes))
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if bytes, err = ConvertFormat(bytes, format); err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", format.ContentType())
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write(bytes)
+	})
+}
+
+// diffHandler diffs two versions of a key, by default the latest version against its predecessor
+func diffHandler(repo Repository) (string, http.Handler) {
+	return "/{key}/diff", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		key := mux.Vars(r)["key"]
+		history, ok := historyOf(repo)
+		if !ok {
+			rw.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		if _, err := repo.Spec(key); err != nil {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		versions, err := history.Versions(key)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+		if to == "" && len(versions) > 0 {
+			to = versions[0].ID
+		}
+		if from == "" {
+			for i, v := range versions {
+				if v.ID == to && i+1 < len(versions) {
+					from = versions[i+1].ID
+					break
+				}
+			}
+		}
+		if from == "" || to == "" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fromContent, err := history.Content(key, from)
+		if err != nil {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		toContent, err := history.Content(key, to)
+		if err != nil {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		diff, err := DiffContents(fromContent, toContent)
+		if err != nil {
+			rw.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		diff.From, diff.To = from, to
+		rw.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(rw).Encode(diff); err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+}
+
+// lintHandler reports the lint problems of the spec of a key
+func lintHandler(linter *Linter) repoHandlerFunc {
+	return func(repo Repository) (string, http.Handler) {
+		return "/{key}/lint", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if linter == nil {
+				rw.WriteHeader(http.StatusNotImplemented)
+				return
+			}
+			key := mux.Vars(r)["key"]
+			spec, err := repo.Spec(key)
+			if err != nil {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if _, err := spec.Get(); err != nil {
+				logging.FromContext(r.Context()).Warn("unable to retrieve spec", "key", key, "err", err)
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			doc, err := DocumentOf(spec)
+			if err != nil {
+				rw.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(rw).Encode(linter.reportOf(key, doc)); err != nil {
+				rw.WriteHeader(http.StatusInternalServerError)
+			}
+		})
+	}
+}
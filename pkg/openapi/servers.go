@@ -0,0 +1,127 @@
+package openapi
+
+import (
+	"net/url"
+	"strings"
+)
+
+// rewriteServers returns a spec that serves the delegate with every server url (OpenAPI 3) or the
+// host and basePath (Swagger 2) replaced by the rewritten url. A spec without servers is rewritten
+// as if it had an empty server url
+func rewriteServers(delegate Spec, rewrite func(server string) string) Spec {
+	s := serverRewrite(rewrite)
+	return derived(delegate, func(from *Document) map[string]interface{} {
+		raw := make(map[string]interface{}, len(from.Raw))
+		for k, v := range from.Raw {
+			raw[k] = v
+		}
+		if from.IsSwagger2() {
+			s.swagger2(raw)
+		} else {
+			raw["servers"] = s.servers(arrayAt(raw, "servers"))
+		}
+		return raw
+	})
+}
+
+// serverRewrite rewrites a server url
+type serverRewrite func(server string) string
+
+// WithServer returns a spec that serves the delegate with its servers moved to the base url. The scheme
+// and host of the base replace those of the servers if set, its path replaces their base paths if set,
+// ie. http://svc:8080 fixes servers advertising localhost and /payments fixes a wrong base path
+func WithServer(delegate Spec, base string) Spec {
+	return rewriteServers(delegate, func(server string) string {
+		return rebase(server, base)
+	})
+}
+
+// ThroughProxy returns a spec that serves the delegate with its servers (OpenAPI 3) or host and
+// basePath (Swagger 2) pointing at the proxy path prefix, keeping the base paths of the servers
+func ThroughProxy(delegate Spec, prefix string) Spec {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return rewriteServers(delegate, func(server string) string {
+		if u, err := url.Parse(server); err == nil {
+			return prefix + absolutePath(u.Path)
+		}
+		return prefix
+	})
+}
+
+// servers rewrites the url of every server, keeping their descriptions
+func (s serverRewrite) servers(servers []interface{}) []interface{} {
+	if len(servers) == 0 {
+		servers = []interface{}{map[string]interface{}{"url": ""}}
+	}
+	rewritten := make([]interface{}, 0, len(servers))
+	seen := make(map[string]bool)
+	for _, server := range servers {
+		obj, ok := server.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		serverURL := s(stringAt(obj, "url"))
+		if serverURL == "" {
+			serverURL = "/"
+		}
+		if seen[serverURL] {
+			continue
+		}
+		seen[serverURL] = true
+		proxied := map[string]interface{}{"url": serverURL}
+		if d := stringAt(obj, "description"); d != "" {
+			proxied["description"] = d
+		}
+		rewritten = append(rewritten, proxied)
+	}
+	return rewritten
+}
+
+// swagger2 rewrites the first server of the spec into its host, schemes and basePath
+func (s serverRewrite) swagger2(raw map[string]interface{}) {
+	server := ""
+	if servers := swagger2Servers(raw); len(servers) > 0 {
+		server = servers[0]
+	}
+	delete(raw, "host")
+	delete(raw, "schemes")
+	delete(raw, "basePath")
+	u, err := url.Parse(s(server))
+	if err != nil {
+		return
+	}
+	if u.Host != "" {
+		raw["host"] = u.Host
+		raw["schemes"] = []interface{}{u.Scheme}
+	}
+	if p := absolutePath(u.Path); p != "" {
+		raw["basePath"] = p
+	}
+}
+
+// rebase moves the server to the scheme and host of the base if set and to its path if set
+func rebase(server, base string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	s, err := url.Parse(server)
+	if err != nil {
+		s = &url.URL{}
+	}
+	rebased := &url.URL{Scheme: s.Scheme, Host: s.Host, Path: s.Path}
+	if b.Host != "" {
+		rebased.Scheme, rebased.Host = b.Scheme, b.Host
+	}
+	if p := absolutePath(b.Path); p != "" {
+		rebased.Path = p
+	}
+	return rebased.String()
+}
+
+func absolutePath(p string) string {
+	if p = strings.TrimSuffix(p, "/"); p != "" && !strings.HasPrefix(p, "/") {
+		return "/" + p
+	}
+	return p
+}
@@ -1,11 +1,10 @@
 package openapi
 
 import (
-	"fmt"
-	"io/ioutil"
-	"net/http"
 	"sync"
 	"time"
+
+	"github.com/SimonSchneider/docs-prox/pkg/metrics"
 )
 
 // Spec is the openApi spec abstraction
@@ -13,74 +12,212 @@ type Spec interface {
 	Get() ([]byte, error)
 }
 
+type wrapper interface {
+	Unwrap() Spec
+}
+
+// unwrap returns the spec decorated by the spec, nil if it is not a decorator. Decorators only implement the
+// capabilities they change, the others are looked up along the chain of decorated specs. Decorators that
+// change the content implement Document and CachedDocument
+func unwrap(spec Spec) Spec {
+	if w, ok := spec.(wrapper); ok {
+		return w.Unwrap()
+	}
+	return nil
+}
+
+type documentSpec interface {
+	Document() (*Document, error)
+}
+
+// DocumentOf parses the spec, reusing the parsed document if the spec caches it
+func DocumentOf(spec Spec) (*Document, error) {
+	for s := spec; s != nil; s = unwrap(s) {
+		if d, ok := s.(documentSpec); ok {
+			return d.Document()
+		}
+	}
+	bytes, err := spec.Get()
+	if err != nil {
+		return nil, err
+	}
+	return ParseDocument(bytes)
+}
+
+type cachedDocumentSpec interface {
+	CachedDocument() (*Document, bool)
+}
+
+// CachedDocumentOf returns the parsed document of the spec if its content is cached, false if the spec
+// would have to be fetched first
+func CachedDocumentOf(spec Spec) (*Document, bool) {
+	for ; spec != nil; spec = unwrap(spec) {
+		if d, ok := spec.(cachedDocumentSpec); ok {
+			return d.CachedDocument()
+		}
+	}
+	return nil, false
+}
+
+// CacheOptions configure how a spec is cached
+type CacheOptions struct {
+	// TTL after which the spec is fetched again
+	TTL time.Duration
+	// Background revalidates expired specs in the background while serving the last good copy,
+	// instead of fetching them when requested. Expired specs are refreshed by RefreshInBackground
+	Background bool
+}
+
 type cachedSpec struct {
-	delegate  Spec
-	ttl       time.Duration
-	mu        sync.RWMutex
-	expiresAt time.Time
-	resp      []byte
+	delegate   Spec
+	opts       CacheOptions
+	mu         sync.RWMutex
+	expiresAt  time.Time
+	fetchedAt  time.Time
+	resp       []byte
+	failing    bool
+	refreshing bool
+	doc        *Document
+	docErr     error
+	stats      FetchStats
 }
 
+// Get returns the cached spec. The last good copy is served if the delegate fails, expired specs are
+// fetched before returning unless they are revalidated in the background
 func (c *cachedSpec) Get() ([]byte, error) {
 	c.mu.RLock()
-	if r, ok := c.tryGetFromCache(); ok {
-		c.mu.RUnlock()
-		return r, nil
-	}
+	resp, fresh := c.resp, c.fresh()
 	c.mu.RUnlock()
+	if resp != nil && (fresh || c.opts.Background) {
+		metrics.CacheRequests.WithLabelValues("hit").Inc()
+		if !fresh {
+			c.revalidate()
+		}
+		return resp, nil
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if r, ok := c.tryGetFromCache(); ok {
-		return r, nil
+	if c.resp != nil && (c.fresh() || c.opts.Background) {
+		metrics.CacheRequests.WithLabelValues("hit").Inc()
+		return c.resp, nil
 	}
-	return c.getFromDelegateAndUpdateCache()
+	metrics.CacheRequests.WithLabelValues("miss").Inc()
+	start := time.Now()
+	resp, err := c.delegate.Get()
+	c.update(start, resp, err)
+	if c.resp == nil {
+		return nil, err
+	}
+	return c.resp, nil
 }
 
-func (c *cachedSpec) tryGetFromCache() ([]byte, bool) {
-	if c.resp != nil && c.expiresAt.After(time.Now()) {
-		return c.resp, true
+func (c *cachedSpec) fresh() bool {
+	return c.expiresAt.After(time.Now())
+}
+
+// update the cache with the result of a fetch, keeping the last good copy if the fetch failed
+func (c *cachedSpec) update(start time.Time, resp []byte, err error) {
+	c.stats.observe(FetchResult{FetchedAt: start, Latency: time.Since(start), Err: err})
+	c.expiresAt = time.Now().Add(c.opts.TTL)
+	if err != nil {
+		c.failing = true
+		return
 	}
-	return nil, false
+	c.resp, c.fetchedAt, c.failing = resp, start, false
+	c.doc, c.docErr = nil, nil
 }
 
-func (c *cachedSpec) getFromDelegateAndUpdateCache() ([]byte, error) {
+func (c *cachedSpec) revalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refreshing {
+		return
+	}
+	c.refreshing = true
+	go c.refresh()
+}
+
+// refresh fetches the delegate without blocking the readers of the cache
+func (c *cachedSpec) refresh() error {
+	start := time.Now()
 	resp, err := c.delegate.Get()
-	if err != nil {
-		c.resp = nil
-		return nil, err
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshing = false
+	c.update(start, resp, err)
+	return err
+}
+
+// Refresh fetches the spec if it is revalidated in the background and has expired, true if it was fetched
+func (c *cachedSpec) Refresh() (bool, error) {
+	if !c.opts.Background {
+		return false, nil
 	}
-	c.resp = resp
-	c.expiresAt = time.Now().Add(c.ttl)
-	return resp, nil
+	c.mu.Lock()
+	if c.refreshing || c.fresh() {
+		c.mu.Unlock()
+		return false, nil
+	}
+	c.refreshing = true
+	c.mu.Unlock()
+	return true, c.refresh()
 }
 
-// Cached returns a spec that wraps and caches the delegate spec
-func Cached(delegate Spec, ttl time.Duration) Spec {
-	return &cachedSpec{
-		delegate: delegate,
-		ttl:      ttl,
-		mu:       sync.RWMutex{},
-		resp:     nil,
+// Document returns the parsed cached spec, it is only re-parsed when the cache is updated
+func (c *cachedSpec) Document() (*Document, error) {
+	if _, err := c.Get(); err != nil {
+		return nil, err
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.parsed()
 }
 
-type remoteSpec struct {
-	client *http.Client
-	url    string
+// CachedDocument returns the parsed last good copy without fetching, expired copies included
+func (c *cachedSpec) CachedDocument() (*Document, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resp == nil {
+		return nil, false
+	}
+	doc, err := c.parsed()
+	return doc, err == nil
 }
 
-// NewRemoteSpec creates a spec that is proxied from a remote url
-func NewRemoteSpec(url string) Spec {
-	return &remoteSpec{client: &http.Client{}, url: url}
+func (c *cachedSpec) parsed() (*Document, error) {
+	if c.doc == nil && c.docErr == nil {
+		c.doc, c.docErr = ParseDocument(c.resp)
+	}
+	return c.doc, c.docErr
 }
 
-func (s *remoteSpec) Get() ([]byte, error) {
-	resp, err := s.client.Get(s.url)
-	if err != nil {
-		return nil, fmt.Errorf("remoteSpec: unable to fetch spec from %s: %w", s.url, err)
+// FetchStats returns the stats of the fetches from the delegate
+func (c *cachedSpec) FetchStats() (FetchStats, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.stats.Count == 0 {
+		return FetchStats{}, false
 	}
-	defer resp.Body.Close()
-	return ioutil.ReadAll(resp.Body)
+	stats := c.stats.copy()
+	stats.ContentFetchedAt = c.fetchedAt
+	// expired specs are only served while they are revalidated in the background
+	stats.Stale = c.resp != nil && (c.failing || (c.opts.Background && !c.fresh()))
+	return stats, true
+}
+
+// Unwrap returns the cached delegate
+func (c *cachedSpec) Unwrap() Spec {
+	return c.delegate
+}
+
+// Cached returns a spec that wraps and caches the delegate spec for the ttl
+func Cached(delegate Spec, ttl time.Duration) Spec {
+	return CachedWith(delegate, CacheOptions{TTL: ttl})
+}
+
+// CachedWith returns a spec that wraps and caches the delegate spec with the options
+func CachedWith(delegate Spec, opts CacheOptions) Spec {
+	return &cachedSpec{delegate: delegate, opts: opts}
 }
 
 //NewCachedRemoteSpec is a convenience constructor for a cached remote spec
@@ -0,0 +1,165 @@
+package openapi
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProviderState is the state of a provider
+type ProviderState string
+
+// ProviderStates, a provider is ready once it is running
+const (
+	Starting ProviderState = "starting"
+	Running  ProviderState = "running"
+	// Reconnecting providers lost their connection and serve their last known specs until it is restored
+	Reconnecting ProviderState = "reconnecting"
+	Failed       ProviderState = "failed"
+)
+
+// ProviderStatus is the last reported state of a provider
+type ProviderStatus struct {
+	Name    string        `json:"name"`
+	State   ProviderState `json:"state"`
+	Message string        `json:"message,omitempty"`
+	Since   time.Time     `json:"since"`
+}
+
+// StatusReporter is used by the providers to report their state
+type StatusReporter interface {
+	Report(provider string, state ProviderState, message string, args ...interface{})
+	// Remove the status of a provider that was stopped
+	Remove(provider string)
+}
+
+// StatusRegistry keeps the last reported status of every provider
+type StatusRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]ProviderStatus
+}
+
+// NewStatusRegistry creates an empty status registry
+func NewStatusRegistry() *StatusRegistry {
+	return &StatusRegistry{providers: make(map[string]ProviderStatus)}
+}
+
+// Report the state of the provider, the message is formatted with the args
+func (s *StatusRegistry) Report(provider string, state ProviderState, message string, args ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := ProviderStatus{Name: provider, State: state, Message: fmt.Sprintf(message, args...), Since: time.Now()}
+	if previous, ok := s.providers[provider]; ok && previous.State == state {
+		status.Since = previous.Since
+	}
+	s.providers[provider] = status
+}
+
+// Remove the status of the provider, ie. of the watches of a namespace that is no longer watched
+func (s *StatusRegistry) Remove(provider string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.providers, provider)
+}
+
+// Providers returns the status of all providers sorted by name
+func (s *StatusRegistry) Providers() []ProviderStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	providers := make([]ProviderStatus, 0, len(s.providers))
+	for _, p := range s.providers {
+		providers = append(providers, p)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Name < providers[j].Name })
+	return providers
+}
+
+// Healthy is true unless a provider has failed
+func (s *StatusRegistry) Healthy() bool {
+	return s.all(func(p ProviderStatus) bool { return p.State != Failed })
+}
+
+// Ready is true when all providers are running or reconnecting, a provider reporting every watch separately
+// is ready once all of them are
+func (s *StatusRegistry) Ready() bool {
+	return s.all(func(p ProviderStatus) bool { return p.State == Running || p.State == Reconnecting })
+}
+
+func (s *StatusRegistry) all(predicate func(ProviderStatus) bool) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.providers {
+		if !predicate(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// FetchResult is the result of a fetch of a spec from its upstream
+type FetchResult struct {
+	FetchedAt time.Time
+	Latency   time.Duration
+	Err       error
+}
+
+// FetchLatencyBuckets are the upper bounds in seconds of the fetch latency histogram
+var FetchLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// FetchStats are the last and the accumulated results of the fetches of a spec from its upstream
+type FetchStats struct {
+	Last   FetchResult
+	Count  uint64
+	Errors uint64
+	// LatencySum of all fetches in seconds
+	LatencySum float64
+	// LatencyBuckets is the cumulative count of fetches per upper bound of FetchLatencyBuckets
+	LatencyBuckets map[float64]uint64
+	// ContentFetchedAt is when the served content was fetched, zero if there is none
+	ContentFetchedAt time.Time
+	// Stale is true if the last fetch failed or the served content is being revalidated
+	Stale bool
+}
+
+func (s *FetchStats) observe(result FetchResult) {
+	if s.LatencyBuckets == nil {
+		s.LatencyBuckets = make(map[float64]uint64, len(FetchLatencyBuckets))
+	}
+	s.Last = result
+	s.Count++
+	if result.Err != nil {
+		s.Errors++
+	}
+	seconds := result.Latency.Seconds()
+	s.LatencySum += seconds
+	for _, bound := range FetchLatencyBuckets {
+		if seconds <= bound {
+			s.LatencyBuckets[bound]++
+		}
+	}
+}
+
+func (s FetchStats) copy() FetchStats {
+	buckets := make(map[float64]uint64, len(s.LatencyBuckets))
+	for k, v := range s.LatencyBuckets {
+		buckets[k] = v
+	}
+	s.LatencyBuckets = buckets
+	return s
+}
+
+type fetchReporter interface {
+	FetchStats() (FetchStats, bool)
+}
+
+// FetchStatsOf returns the fetch stats of the spec, false if the spec was never fetched or
+// does not keep track of its fetches
+func FetchStatsOf(spec Spec) (FetchStats, bool) {
+	for ; spec != nil; spec = unwrap(spec) {
+		if f, ok := spec.(fetchReporter); ok {
+			return f.FetchStats()
+		}
+	}
+	return FetchStats{}, false
+}
@@ -0,0 +1,94 @@
+package openapi
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStatusRegistryHealthAndReadiness(t *testing.T) {
+	status := NewStatusRegistry()
+	if !status.Healthy() || !status.Ready() {
+		t.Error("expected an empty registry to be healthy and ready")
+	}
+	status.Report("a", Starting, "starting")
+	status.Report("b", Running, "loaded %d specs", 2)
+	if !status.Healthy() || status.Ready() {
+		t.Error("expected a starting provider to be healthy but not ready")
+	}
+	status.Report("a", Reconnecting, "watch closed")
+	if !status.Healthy() || !status.Ready() {
+		t.Error("expected a reconnecting provider to be healthy and ready")
+	}
+	status.Report("a", Failed, "stopped")
+	if status.Healthy() || status.Ready() {
+		t.Error("expected a failed provider to be neither healthy nor ready")
+	}
+	providers := status.Providers()
+	if len(providers) != 2 || providers[0].Name != "a" || providers[1].Message != "loaded 2 specs" {
+		t.Errorf("unexpected providers %v", providers)
+	}
+}
+
+func TestStatusRegistryIsReadyOnceAllWatchesOfAProviderAre(t *testing.T) {
+	status := NewStatusRegistry()
+	status.Report("kubernetes-services/team-a", Running, "connected")
+	status.Report("kubernetes-services/team-b", Starting, "connecting")
+	if status.Ready() {
+		t.Error("expected the provider not to be ready while the watch of a namespace is starting")
+	}
+	status.Report("kubernetes-services/team-a", Reconnecting, "watch closed")
+	status.Report("kubernetes-services/team-b", Running, "connected")
+	if !status.Ready() || len(status.Providers()) != 2 {
+		t.Errorf("expected the provider to be ready once the watches of all namespaces are, got %v", status.Providers())
+	}
+	status.Report("kubernetes-services/team-c", Failed, "forbidden")
+	status.Remove("kubernetes-services/team-c")
+	if !status.Healthy() || !status.Ready() {
+		t.Error("expected a removed watch not to be reported")
+	}
+}
+
+type failingSpec struct{}
+
+func (failingSpec) Get() ([]byte, error) {
+	return nil, errors.New("unreachable")
+}
+
+func TestCachedSpecRecordsFetchStats(t *testing.T) {
+	spec := WithLabels(Cached(failingSpec{}, 0), nil)
+	if _, ok := FetchStatsOf(spec); ok {
+		t.Error("expected no stats before the spec is fetched")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := spec.Get(); err == nil {
+			t.Error("expected fetch to fail")
+		}
+	}
+	stats, ok := FetchStatsOf(spec)
+	if !ok || stats.Last.Err == nil || stats.Last.FetchedAt.IsZero() {
+		t.Errorf("expected the failed fetch to be recorded, got %v", stats.Last)
+	}
+	if stats.Count != 2 || stats.Errors != 2 || stats.LatencyBuckets[FetchLatencyBuckets[len(FetchLatencyBuckets)-1]] != 2 {
+		t.Errorf("expected 2 failed fetches to be accumulated, got %+v", stats)
+	}
+}
+
+func TestCapabilitiesAreLookedUpAlongTheWrappedSpecs(t *testing.T) {
+	upstream := &upstreamSpec{content: curatedTestSpec}
+	cached := CachedWith(upstream, CacheOptions{Background: true})
+	spec := Curated(Transformed(WithLabels(cached, map[string]string{"app": "pets"}), ServersAtOrigin()), TransformRules{DropInternal: true})
+	doc, err := DocumentOf(spec)
+	check("document", t, err)
+	if len(doc.Operations) != 4 {
+		t.Errorf("expected the document of the outermost spec, got %v", doc.Operations)
+	}
+	if LabelsOf(spec)["app"] != "pets" || len(TransformsOf(spec)) != 1 {
+		t.Errorf("expected the labels and transforms of the wrapped specs, got %v", LabelsOf(spec))
+	}
+	if _, ok := FetchStatsOf(spec); !ok {
+		t.Error("expected the fetch stats of the cached spec")
+	}
+	if refreshed, err := RefreshOf(spec); !refreshed || err != nil {
+		t.Errorf("expected the cached spec to be refreshed, got %v %v", refreshed, err)
+	}
+}
@@ -0,0 +1,128 @@
+package openapi
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Transform decorates a spec before it is served, ie. to fix the servers it advertises
+type Transform func(meta SpecMetadata, spec Spec) Spec
+
+type transformedSpec struct {
+	delegate   Spec
+	transforms []Transform
+}
+
+// Transformed returns a spec that is served with the transforms applied in order. The transforms are
+// applied when the spec is stored in a repository, the spec is listed, searched, merged, recorded and
+// served as it is transformed
+func Transformed(delegate Spec, transforms ...Transform) Spec {
+	if len(transforms) == 0 {
+		return delegate
+	}
+	return &transformedSpec{delegate: delegate, transforms: transforms}
+}
+
+func (s *transformedSpec) Get() ([]byte, error) {
+	return s.delegate.Get()
+}
+
+func (s *transformedSpec) Unwrap() Spec {
+	return s.delegate
+}
+
+func (s *transformedSpec) Transforms() []Transform {
+	return append(TransformsOf(s.delegate), s.transforms...)
+}
+
+type transformer interface {
+	Transforms() []Transform
+}
+
+// TransformsOf returns the transforms of the spec, nil if it has none
+func TransformsOf(spec Spec) []Transform {
+	for ; spec != nil; spec = unwrap(spec) {
+		if t, ok := spec.(transformer); ok {
+			return t.Transforms()
+		}
+	}
+	return nil
+}
+
+// applyTransforms applies the transforms in order
+func applyTransforms(meta SpecMetadata, spec Spec, transforms []Transform) Spec {
+	for _, transform := range transforms {
+		spec = transform(meta, spec)
+	}
+	return spec
+}
+
+// served returns the spec as it is served with its transforms applied. The transformed spec wraps the spec,
+// its fetch statistics, refreshes, labels and origin are those of the fetched spec
+func served(meta SpecMetadata, spec Spec) Spec {
+	return applyTransforms(meta, spec, TransformsOf(spec))
+}
+
+// ServersAtOrigin moves the servers to the scheme and host the spec was discovered at, keeping their
+// base paths. Specs that were not fetched from a url are served unchanged
+func ServersAtOrigin() Transform {
+	return func(meta SpecMetadata, spec Spec) Spec {
+		origin, ok := OriginOf(spec)
+		if !ok {
+			return spec
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			return spec
+		}
+		return WithServer(spec, u.Scheme+"://"+u.Host)
+	}
+}
+
+// ServersAt moves the servers to the url pattern, see WithServer. The pattern may reference the {key},
+// {name} and {source} of the spec, ie. https://api.example.com/{name}
+func ServersAt(pattern string) Transform {
+	return func(meta SpecMetadata, spec Spec) Spec {
+		base := strings.NewReplacer("{key}", meta.Key, "{name}", meta.Name, "{source}", meta.Source).Replace(pattern)
+		return WithServer(spec, base)
+	}
+}
+
+type transformedRepository struct {
+	repo       Repository
+	transforms []Transform
+}
+
+// TransformedView returns a view of the repo that serves its specs with the given transforms applied on top
+// of their own, ie. a curated view for a wider audience. The listing and merging of the view use the
+// transformed specs, the view is neither searchable nor versioned as the index and history of the repo do
+// not contain the transforms of the view
+func TransformedView(repo Repository, transforms ...Transform) Repository {
+	return &transformedRepository{repo: repo, transforms: transforms}
+}
+
+func (r *transformedRepository) Keys() []SpecMetadata {
+	return r.repo.Keys()
+}
+
+func (r *transformedRepository) Spec(key string) (Spec, error) {
+	spec, err := r.repo.Spec(key)
+	if err != nil {
+		return nil, err
+	}
+	meta, ok := metadataOf(r.repo, key)
+	if !ok {
+		return nil, KeyNotFoundError{Repo: "transformedRepo", Key: key}
+	}
+	return applyTransforms(meta, spec, r.transforms), nil
+}
+
+// Subscribe to the changes of the repo
+func (r *transformedRepository) Subscribe() (<-chan Event, func()) {
+	if watchable, ok := r.repo.(Watchable); ok {
+		return watchable.Subscribe()
+	}
+	events := make(chan Event)
+	close(events)
+	return events, func() {}
+}
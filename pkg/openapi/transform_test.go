@@ -0,0 +1,97 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRebase(t *testing.T) {
+	cases := []struct {
+		server, base, expected string
+	}{
+		{server: "http://localhost:8080/v1", base: "http://payments:8080", expected: "http://payments:8080/v1"},
+		{server: "/v1", base: "https://api.example.com", expected: "https://api.example.com/v1"},
+		{server: "http://localhost:8080/v1", base: "https://api.example.com/payments/", expected: "https://api.example.com/payments"},
+		{server: "https://api.example.com/wrong", base: "/payments", expected: "https://api.example.com/payments"},
+		{server: "", base: "https://api.example.com", expected: "https://api.example.com"},
+		{server: "{scheme}://{host}/v1", base: "https://api.example.com", expected: "https://api.example.com"},
+	}
+	for _, c := range cases {
+		if actual := rebase(c.server, c.base); actual != c.expected {
+			t.Errorf("expected %s rebased on %s to be %s, got %s", c.server, c.base, c.expected, actual)
+		}
+	}
+}
+
+func TestTransformsAreAppliedToServedSpecs(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, _ = rw.Write([]byte(`{"openapi": "3.0.3", "servers": [{"url": "http://localhost:8080/v1"}]}`))
+	}))
+	defer upstream.Close()
+	r := NewCachedRepository()
+	check("put", t, r.Put("s1", "origin", Transformed(NewRemoteSpec(upstream.URL+"/openapi.json"), ServersAtOrigin())))
+	check("put", t, r.Put("s1", "Pattern", WithLabels(Transformed(testSpec(`{"swagger": "2.0", "host": "localhost", "basePath": "/"}`),
+		ServersAtOrigin(), ServersAt("https://api.example.com/{name}")), map[string]string{"app": "pattern"})))
+	router := mux.NewRouter()
+	path, handler := docsHandler(nil)(r)
+	router.Handle("/docs"+path, handler)
+	served := func(key string) map[string]interface{} {
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/docs/"+key, nil))
+		var raw map[string]interface{}
+		check("decode spec", t, json.NewDecoder(rw.Body).Decode(&raw))
+		return raw
+	}
+	servers, _ := json.Marshal(served("origin")["servers"])
+	if expected := `[{"url":"` + upstream.URL + `/v1"}]`; string(servers) != expected {
+		t.Errorf("expected the servers to be moved to the origin %s, got %s", expected, servers)
+	}
+	if raw := served("pattern"); raw["host"] != "api.example.com" || raw["basePath"] != "/Pattern" {
+		t.Errorf("expected the server to be moved to the pattern, got %v", raw)
+	}
+	spec, err := r.Spec("origin")
+	check("get spec", t, err)
+	if doc, err := DocumentOf(spec); err != nil || doc.Servers[0] != upstream.URL+"/v1" {
+		t.Errorf("expected the stored spec to be transformed, got %v", doc)
+	}
+}
+
+func TestTransformsApplyWhereverSpecsLeaveTheServer(t *testing.T) {
+	history := NewMemoryHistory(5)
+	r := NewCachedRepository(WithHistory(history))
+	check("put", t, r.Put("s1", "pets", Transformed(Cached(testSpec(curatedTestSpec), time.Minute), TransformRules{DropInternal: true}.Transform())))
+	fetchAll(t, r)
+	if hits := r.(Searchable).Search("debug", 0); len(hits) != 0 {
+		t.Errorf("expected the dropped operation not to be indexed, got %v", hits)
+	}
+	if len(r.(Searchable).Search("listPets", 0)) == 0 {
+		t.Errorf("expected the kept operation to be indexed")
+	}
+	merged := Merge(context.Background(), r, MetadataFilter{}, MergeOptions{})
+	paths := objectAt(merged.Document, "paths")
+	if _, ok := paths["/pets/debug"]; ok {
+		t.Errorf("expected the dropped path not to be merged, got %v", paths)
+	}
+	if _, ok := paths["/pets/pets"]; !ok {
+		t.Errorf("expected the kept path to be merged, got %v", paths)
+	}
+	versions, err := history.Versions("pets")
+	check("versions", t, err)
+	content, err := history.Content("pets", versions[0].ID)
+	check("content", t, err)
+	if strings.Contains(string(content), "debug") {
+		t.Errorf("expected the recorded version to be transformed, got %s", content)
+	}
+	spec, err := r.Spec("pets")
+	check("spec", t, err)
+	if doc, ok := CachedDocumentOf(spec); !ok || len(doc.Operations) != 4 {
+		t.Errorf("expected the listing to use the transformed document, got %v", doc)
+	}
+}
@@ -0,0 +1,190 @@
+package openapi
+
+import (
+	"sync"
+
+	"github.com/SimonSchneider/docs-prox/pkg/authn"
+)
+
+// VisibilityRule makes the specs selected by the filter visible to the groups
+type VisibilityRule struct {
+	MetadataFilter
+	Groups []string `json:"groups"`
+}
+
+// Visibility decides which specs a principal may see. A spec selected by rules is visible to the groups
+// of those rules, a spec not selected by any rule is visible to everyone unless DenyByDefault
+type Visibility struct {
+	Rules         []VisibilityRule
+	DenyByDefault bool
+}
+
+// Visible is true if the principal may see the spec, principal is nil for anonymous callers
+func (v Visibility) Visible(principal *authn.Principal, meta SpecMetadata) bool {
+	selected := false
+	for _, rule := range v.Rules {
+		if !rule.Matches(meta) {
+			continue
+		}
+		if principal.InAnyGroup(rule.Groups) {
+			return true
+		}
+		selected = true
+	}
+	return !selected && !v.DenyByDefault
+}
+
+// restricted is true if some specs may be hidden from some of the callers
+func (v Visibility) restricted() bool {
+	return len(v.Rules) > 0 || v.DenyByDefault
+}
+
+// For returns the visibility of the specs to the principal
+func (v Visibility) For(principal *authn.Principal) func(SpecMetadata) bool {
+	return func(meta SpecMetadata) bool {
+		return v.Visible(principal, meta)
+	}
+}
+
+type visibleRepository struct {
+	repo    Repository
+	visible func(SpecMetadata) bool
+}
+
+// VisibleTo returns a view of the repo that only contains the visible specs
+func VisibleTo(repo Repository, visible func(SpecMetadata) bool) Repository {
+	return &visibleRepository{repo: repo, visible: visible}
+}
+
+type metadataRepository interface {
+	metadata(key string) (SpecMetadata, bool)
+}
+
+// metadataOf the key in the repo, false if there is no such key
+func metadataOf(repo Repository, key string) (SpecMetadata, bool) {
+	if m, ok := repo.(metadataRepository); ok {
+		return m.metadata(key)
+	}
+	for _, meta := range repo.Keys() {
+		if meta.Key == key {
+			return meta, true
+		}
+	}
+	return SpecMetadata{}, false
+}
+
+func (r *visibleRepository) Keys() []SpecMetadata {
+	all := r.repo.Keys()
+	keys := make([]SpecMetadata, 0, len(all))
+	for _, meta := range all {
+		if r.visible(meta) {
+			keys = append(keys, meta)
+		}
+	}
+	return keys
+}
+
+func (r *visibleRepository) Spec(key string) (Spec, error) {
+	if meta, ok := metadataOf(r.repo, key); !ok || !r.visible(meta) {
+		return nil, KeyNotFoundError{Repo: "visibleRepo", Key: key}
+	}
+	return r.repo.Spec(key)
+}
+
+// Search returns the hits of the visible specs
+func (r *visibleRepository) Search(query string, limit int) []SearchHit {
+	return r.searchMatching(query, limit, nil)
+}
+
+// searchMatching passes the visibility on to the index of the repo so that the limit is filled with
+// visible hits, the hits of a repo without one are filtered from its best hits
+func (r *visibleRepository) searchMatching(query string, limit int, matches func(SpecMetadata) bool) []SearchHit {
+	visible := r.visible
+	if matches != nil {
+		visible = func(meta SpecMetadata) bool {
+			return r.visible(meta) && matches(meta)
+		}
+	}
+	if filtered, ok := r.repo.(filteredSearchable); ok {
+		return filtered.searchMatching(query, limit, visible)
+	}
+	searchable, ok := r.repo.(Searchable)
+	if !ok {
+		return nil
+	}
+	hits := make([]SearchHit, 0, limit)
+	for _, hit := range searchable.Search(query, maxSearchLimit) {
+		if meta, ok := metadataOf(r.repo, hit.Key); ok && visible(meta) {
+			hits = append(hits, hit)
+			if len(hits) == limit {
+				break
+			}
+		}
+	}
+	return hits
+}
+
+// History of the repo, the handlers check the visibility of a key before serving its history
+func (r *visibleRepository) History() HistoryStore {
+	if history, ok := historyOf(r.repo); ok {
+		return history
+	}
+	return nil
+}
+
+// Subscribe to the changes of the visible specs. A spec that is no longer visible after being replaced
+// is announced as removed
+func (r *visibleRepository) Subscribe() (<-chan Event, func()) {
+	watchable, ok := r.repo.(Watchable)
+	if !ok {
+		events := make(chan Event)
+		close(events)
+		return events, func() {}
+	}
+	source, unsubscribe := watchable.Subscribe()
+	visible := make(map[string]bool)
+	for _, meta := range r.Keys() {
+		visible[meta.Key] = true
+	}
+	events := make(chan Event)
+	done := make(chan struct{})
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(done)
+			unsubscribe()
+		})
+	}
+	forward := func(event Event) bool {
+		select {
+		case events <- event:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	go func() {
+		defer close(events)
+		for event := range source {
+			forwarded := true
+			if event.Type == Resync {
+				forwarded = forward(event)
+			} else if event.Type == Removed {
+				if visible[event.Key] {
+					delete(visible, event.Key)
+					forwarded = forward(event)
+				}
+			} else if meta, ok := metadataOf(r.repo, event.Key); ok && r.visible(meta) {
+				visible[event.Key] = true
+				forwarded = forward(event)
+			} else if visible[event.Key] {
+				delete(visible, event.Key)
+				forwarded = forward(Event{Type: Removed, Key: event.Key, Name: event.Name, Source: event.Source})
+			}
+			if !forwarded {
+				return
+			}
+		}
+	}()
+	return events, stop
+}
@@ -0,0 +1,104 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SimonSchneider/docs-prox/pkg/authn"
+	"github.com/gorilla/mux"
+)
+
+var testVisibility = Visibility{Rules: []VisibilityRule{
+	{MetadataFilter: MetadataFilter{Keys: []string{"payments-*"}}, Groups: []string{"payments"}},
+	{MetadataFilter: MetadataFilter{Labels: map[string]string{"internal": "true"}}, Groups: []string{"platform"}},
+	{MetadataFilter: MetadataFilter{Sources: []string{"env"}}, Groups: []string{"*"}},
+}}
+
+func TestVisibilityRules(t *testing.T) {
+	payments := &authn.Principal{Subject: "jane", Groups: []string{"payments"}}
+	cases := []struct {
+		principal *authn.Principal
+		meta      SpecMetadata
+		visible   bool
+	}{
+		{principal: payments, meta: SpecMetadata{Key: "payments-api"}, visible: true},
+		{principal: nil, meta: SpecMetadata{Key: "payments-api"}, visible: false},
+		{principal: payments, meta: SpecMetadata{Key: "orders", Labels: map[string]string{"internal": "true"}}, visible: false},
+		{principal: payments, meta: SpecMetadata{Key: "orders", Source: "env"}, visible: true},
+		{principal: nil, meta: SpecMetadata{Key: "orders", Source: "env"}, visible: false},
+		{principal: nil, meta: SpecMetadata{Key: "public"}, visible: true},
+	}
+	for _, c := range cases {
+		if actual := testVisibility.Visible(c.principal, c.meta); actual != c.visible {
+			t.Errorf("expected visibility of %v to %v to be %v", c.meta, c.principal, c.visible)
+		}
+	}
+	if (Visibility{DenyByDefault: true}).Visible(payments, SpecMetadata{Key: "public"}) {
+		t.Error("expected specs not selected by any rule to be hidden when denying by default")
+	}
+}
+
+func TestVisibleRepositoryOnlyServesVisibleSpecs(t *testing.T) {
+	r := NewCachedRepository()
+	check("put", t, r.Put("s1", "payments-api", testSpec("{}")))
+	check("put", t, r.Put("s1", "orders", WithLabels(testSpec("{}"), map[string]string{"internal": "true"})))
+	check("put", t, r.Put("s1", "public", testSpec("{}")))
+	handle := func(fun repoHandlerFunc, principal *authn.Principal, target string) *httptest.ResponseRecorder {
+		router := mux.NewRouter()
+		path, _ := fun(r)
+		router.Handle("/docs"+path, visibleHandler(fun, r, testVisibility))
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		router.ServeHTTP(rw, req.WithContext(authn.NewContext(req.Context(), principal)))
+		return rw
+	}
+	var keys []KeyUrls
+	rw := handle(keyHandler(nil), &authn.Principal{Groups: []string{"payments"}}, "/docs/")
+	check("decode keys", t, json.NewDecoder(rw.Body).Decode(&keys))
+	if len(keys) != 2 || keys[0].Key != "payments-api" || keys[1].Key != "public" {
+		t.Errorf("expected the payments and public specs to be listed, got %v", keys)
+	}
+	if rw := handle(docsHandler(nil), nil, "/docs/orders"); rw.Code != http.StatusNotFound {
+		t.Errorf("expected a hidden spec not to be found, got %d", rw.Code)
+	}
+	if rw := handle(docsHandler(nil), &authn.Principal{Groups: []string{"platform"}}, "/docs/orders"); rw.Code != http.StatusOK {
+		t.Errorf("expected a visible spec to be served, got %d", rw.Code)
+	}
+
+	events, unsubscribe := VisibleTo(r, testVisibility.For(nil)).(Watchable).Subscribe()
+	defer unsubscribe()
+	check("put", t, r.Put("s1", "payments-web", testSpec("{}")))
+	check("put", t, r.Put("s1", "docs", testSpec("{}")))
+	select {
+	case e := <-events:
+		if e.Key != "docs" {
+			t.Errorf("expected only the visible spec to be announced, got %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("timed out waiting for the visible spec to be announced")
+	}
+}
+
+func TestVisibleSearchIsNotCrowdedOutByHiddenHits(t *testing.T) {
+	r := NewCachedRepository()
+	hidden := testSpec(`{"openapi": "3.0.0", "paths": {"/invoices": {"get": {"operationId": "listInvoices", "summary": "invoices"}}}}`)
+	for i := 0; i < maxSearchLimit+100; i++ {
+		check("put", t, r.Put("s1", fmt.Sprintf("payments-%03d", i), hidden))
+	}
+	check("put", t, r.Put("s1", "public", testSpec(`{"openapi": "3.0.0", "paths": {"/orders": {"get": {"description": "links the invoices"}}}}`)))
+	fetchAll(t, r)
+	hits := VisibleTo(r, testVisibility.For(nil)).(Searchable).Search("invoices", 10)
+	if len(hits) != 1 || hits[0].Key != "public" {
+		t.Errorf("expected the lower ranked visible hit to be found, got %v", hits)
+	}
+	stacked := VisibleTo(VisibleTo(r, testVisibility.For(&authn.Principal{Groups: []string{"payments"}})), func(meta SpecMetadata) bool {
+		return meta.Key != "payments-000"
+	})
+	if hits := stacked.(Searchable).Search("invoices", 0); len(hits) != maxSearchLimit+100 {
+		t.Errorf("expected the hits visible to both views, got %d", len(hits))
+	}
+}
@@ -0,0 +1,136 @@
+package openapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+)
+
+// warmWorkers bound the concurrent fetches of the warm-up
+const warmWorkers = 4
+
+// WarmInBackground fetches the specs of the repo, and every spec that is added or replaced later, with a
+// bounded pool of workers until the context is done. The repo observes the fetched content so that the
+// specs are searchable, listed with their info and their changes are published without waiting for a
+// caller to open them. If the poll interval is positive every spec is fetched again every interval, so
+// that new content of an upstream is observed even if its provider did not replace it, ie. a service that
+// is redeployed with a new spec
+func WarmInBackground(ctx context.Context, repo Repository, poll time.Duration, logger logging.Logger) {
+	keys := newKeyQueue()
+	for i := 0; i < warmWorkers; i++ {
+		go warmAll(ctx, repo, keys, logger)
+	}
+	var events <-chan Event
+	unsubscribe := func() {}
+	subscribe := func() {
+		if watchable, ok := repo.(Watchable); ok {
+			unsubscribe()
+			events, unsubscribe = watchable.Subscribe()
+		}
+	}
+	subscribe()
+	defer func() { unsubscribe() }()
+	var ticks <-chan time.Time
+	if poll > 0 {
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	pushAll := func() {
+		for _, meta := range repo.Keys() {
+			keys.push(meta.Key)
+		}
+	}
+	// the specs stored before subscribing are only warmed once
+	pushAll()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+			pushAll()
+		case event, ok := <-events:
+			switch {
+			case !ok:
+				events = nil
+			case event.Type == Resync:
+				// the warm-up fell behind the changes, the missed specs are warmed again
+				subscribe()
+				pushAll()
+			case event.Type == Added || event.Type == Replaced:
+				keys.push(event.Key)
+			}
+		}
+	}
+}
+
+func warmAll(ctx context.Context, repo Repository, keys *keyQueue, logger logging.Logger) {
+	for {
+		key, ok := keys.pop(ctx)
+		if !ok {
+			return
+		}
+		spec, err := repo.Spec(key)
+		if err != nil {
+			continue
+		}
+		if _, err := spec.Get(); err != nil {
+			logger.Warn("unable to warm spec", "key", key, "err", err)
+		}
+	}
+}
+
+// keyQueue is an unbounded FIFO queue of keys, a key is only queued once until it is popped
+type keyQueue struct {
+	mu     sync.Mutex
+	keys   []string
+	queued map[string]bool
+	wake   chan struct{}
+}
+
+func newKeyQueue() *keyQueue {
+	return &keyQueue{queued: make(map[string]bool), wake: make(chan struct{}, 1)}
+}
+
+func (q *keyQueue) push(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.queued[key] {
+		return
+	}
+	q.queued[key] = true
+	q.keys = append(q.keys, key)
+	q.signal()
+}
+
+// pop blocks until a key is queued, false if the context is done first
+func (q *keyQueue) pop(ctx context.Context) (string, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.keys) > 0 {
+			key := q.keys[0]
+			q.keys = q.keys[1:]
+			delete(q.queued, key)
+			if len(q.keys) > 0 {
+				q.signal()
+			}
+			q.mu.Unlock()
+			return key, true
+		}
+		q.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return "", false
+		case <-q.wake:
+		}
+	}
+}
+
+func (q *keyQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,98 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+)
+
+type concurrentSpec struct {
+	content     string
+	active, max *int32
+}
+
+func (c concurrentSpec) Get() ([]byte, error) {
+	active := atomic.AddInt32(c.active, 1)
+	defer atomic.AddInt32(c.active, -1)
+	for {
+		max := atomic.LoadInt32(c.max)
+		if active <= max || atomic.CompareAndSwapInt32(c.max, max, active) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return []byte(c.content), nil
+}
+
+func awaitHits(t *testing.T, r Repository, query string) []SearchHit {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if hits := r.(Searchable).Search(query, 0); len(hits) > 0 {
+			return hits
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for hits of %s", query)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWarmInBackgroundIndexesUnopenedSpecs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewCachedRepository()
+	check("put", t, r.Put("s1", "invoices", Cached(testSpec(oas3Spec), time.Minute)))
+	go WarmInBackground(ctx, r, 0, logging.Nop())
+	if hits := awaitHits(t, r, "invoice"); hits[0].Key != "invoices" {
+		t.Errorf("expected the spec stored before the warm-up to be found, got %v", hits)
+	}
+	check("put", t, r.Put("s1", "pets", Cached(testSpec(swagger2Spec), time.Minute)))
+	if hits := awaitHits(t, r, "pet"); hits[0].Key != "pets" {
+		t.Errorf("expected the added spec to be found, got %v", hits)
+	}
+}
+
+func TestWarmInBackgroundListsTheInfoOfUnopenedSpecs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewCachedRepository()
+	go WarmInBackground(ctx, r, 0, logging.Nop())
+	check("put", t, r.Put("s1", "invoices", Cached(testSpec(oas3Spec), time.Minute)))
+	awaitHits(t, r, "invoice")
+	_, handler := keyHandler(nil)(r)
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+	var keys []KeyUrls
+	check("decode keys", t, json.NewDecoder(rw.Body).Decode(&keys))
+	if len(keys) != 1 || keys[0].Title != "Invoices" || keys[0].Version != "1.2.0" || len(keys[0].Operations) != 3 {
+		t.Errorf("expected the listing to contain the info and operations of the warmed spec, got %+v", keys)
+	}
+}
+
+func TestWarmInBackgroundBoundsTheConcurrentFetches(t *testing.T) {
+	const keys = 100
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewCachedRepository()
+	go WarmInBackground(ctx, r, 0, logging.Nop())
+	var active, max int32
+	specs := make(map[string]Spec, keys)
+	for i := 0; i < keys; i++ {
+		specs[fmt.Sprintf("key-%03d", i)] = concurrentSpec{content: fmt.Sprintf(`{"swagger": "2.0", "paths": {"/key-%03d": {"get": {}}}}`, i), active: &active, max: &max}
+	}
+	r.ReplaceAllOf("s1", specs)
+	for i := 0; i < keys; i++ {
+		awaitHits(t, r, fmt.Sprintf("key-%03d", i))
+	}
+	if m := atomic.LoadInt32(&max); m > warmWorkers {
+		t.Errorf("expected at most %d concurrent fetches, got %d", warmWorkers, m)
+	}
+}
@@ -3,19 +3,32 @@ package environment
 import (
 	"os"
 	"strings"
-	"time"
 
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
 	"github.com/SimonSchneider/docs-prox/pkg/openapi"
 )
 
-// Configure the repository from the configuration
-func Configure(store openapi.SpecStore, prefix string) {
+// authSuffix of the variables naming the auth profile of the spec url in the variable without the suffix
+const authSuffix = "_AUTH"
+
+// Configure the repository from the configuration, the remote specs are fetched with the fetcher,
+// cached with the cache options and served with the transforms
+func Configure(store openapi.SpecStore, status openapi.StatusReporter, logger logging.Logger, fetcher *openapi.Fetcher, cache openapi.CacheOptions, transforms []openapi.Transform, prefix string) {
+	loaded := 0
 	for _, e := range os.Environ() {
 		pair := strings.SplitN(e, "=", 2)
-		if strings.HasPrefix(pair[0], prefix) {
+		if strings.HasPrefix(pair[0], prefix) && !strings.HasSuffix(pair[0], authSuffix) {
 			key := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(pair[0], prefix), "_", "-"))
-			spec := openapi.NewCachedRemoteSpec(pair[1], 20*time.Second)
-			store.Put("env", key, spec)
+			logger.Debug("found spec url in environment", "provider", "environment", "key", key, "url", pair[1])
+			remote, err := fetcher.SpecWithAuth(pair[1], os.Getenv(pair[0]+authSuffix))
+			if err != nil {
+				logger.Warn("ignoring spec url in environment", "provider", "environment", "key", key, "err", err)
+				continue
+			}
+			if err := store.Put("env", key, openapi.Transformed(openapi.CachedWith(remote, cache), transforms...)); err == nil {
+				loaded++
+			}
 		}
 	}
+	status.Report("environment", openapi.Running, "loaded %d specs with prefix %s", loaded, prefix)
 }
@@ -5,12 +5,12 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+	"github.com/SimonSchneider/docs-prox/pkg/metrics"
 	"github.com/SimonSchneider/docs-prox/pkg/openapi"
 	"github.com/fsnotify/fsnotify"
 )
@@ -28,43 +28,63 @@ func (s *fileSpec) Get() ([]byte, error) {
 	return ioutil.ReadAll(file)
 }
 
-func newCachedFileSpec(path string) openapi.Spec {
-	return openapi.Cached(&fileSpec{path: path}, 20*time.Second)
+func newCachedFileSpec(path string, cache openapi.CacheOptions) openapi.Spec {
+	return openapi.CachedWith(&fileSpec{path: path}, cache)
 }
 
-// Configure the store to add the path for json files with prefix
-func Configure(ctx context.Context, store openapi.SpecStore, path, prefix, jsonExt, urlExt string) error {
+// Configure the store to add the path for json, yaml and url files with prefix, the specs of url files are
+// fetched with the fetcher and all specs are cached with the cache options and served with the transforms
+func Configure(ctx context.Context, store openapi.SpecStore, status openapi.StatusReporter, logger logging.Logger, fetcher *openapi.Fetcher, cache openapi.CacheOptions, transforms []openapi.Transform, path, prefix, jsonExt, yamlExt, urlExt string) error {
+	provider := fmt.Sprintf("file-%s", path)
+	logger = logger.With("provider", provider)
+	status.Report(provider, openapi.Starting, "starting directory watcher")
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
+		status.Report(provider, openapi.Failed, "unable to start filewatcher: %v", err)
 		return fmt.Errorf("fileRepository: unable to start filewatcher: %w", err)
 	}
 	dirWatcher := &dirWatcher{
-		source:  fmt.Sprintf("dirWatcher-%s", path),
-		prefix:  prefix,
-		jsonExt: jsonExt,
-		urlExt:  urlExt,
-		watcher: watcher,
-		store:   store,
+		source:     fmt.Sprintf("dirWatcher-%s", path),
+		prefix:     prefix,
+		jsonExt:    jsonExt,
+		yamlExt:    yamlExt,
+		urlExt:     urlExt,
+		watcher:    watcher,
+		store:      store,
+		status:     status,
+		provider:   provider,
+		logger:     logger,
+		fetcher:    fetcher,
+		cache:      cache,
+		transforms: transforms,
 	}
 	go dirWatcher.start(ctx)
 	err = dirWatcher.add(path)
 	if err != nil {
+		status.Report(provider, openapi.Failed, "unable to watch %s: %v", path, err)
 		return fmt.Errorf("fileRepository: unable to add path %s to directory Watcher: %w", path, err)
 	}
+	status.Report(provider, openapi.Running, "watching %s", path)
 	go func() {
 		<-ctx.Done()
-		fmt.Printf("fileRepository: stopping directory watcher\n")
+		logger.Info("stopping directory watcher")
 		watcher.Close()
 	}()
 	return nil
 }
 
 type dirWatcher struct {
-	source          string
-	prefix          string
-	jsonExt, urlExt string
-	watcher         *fsnotify.Watcher
-	store           openapi.SpecStore
+	source                   string
+	prefix                   string
+	jsonExt, yamlExt, urlExt string
+	watcher                  *fsnotify.Watcher
+	store                    openapi.SpecStore
+	status                   openapi.StatusReporter
+	provider                 string
+	logger                   logging.Logger
+	fetcher                  *openapi.Fetcher
+	cache                    openapi.CacheOptions
+	transforms               []openapi.Transform
 }
 
 type changeType int32
@@ -93,12 +113,14 @@ func (d *dirWatcher) start(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			fmt.Printf("stopping directory processor\n")
+			d.logger.Debug("stopping directory processor")
 			return
 		case event, ok := <-d.watcher.Events:
 			if !ok {
+				d.stopped(ctx)
 				return
 			}
+			metrics.WatcherEvents.WithLabelValues("file", strings.ToLower(event.Op.String())).Inc()
 			if event.Op&fsnotify.Remove == fsnotify.Remove || event.Op&fsnotify.Rename == fsnotify.Rename {
 				d.change(event.Name, remove)
 			} else if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
@@ -106,28 +128,36 @@ func (d *dirWatcher) start(ctx context.Context) {
 			}
 		case err, ok := <-d.watcher.Errors:
 			if !ok {
+				d.stopped(ctx)
 				return
 			}
-			fmt.Printf("error: %s\n", err)
+			d.logger.Error("directory watcher error", "err", err)
 		}
 	}
 }
 
+// stopped reports the watcher as failed unless it was stopped by the context
+func (d *dirWatcher) stopped(ctx context.Context) {
+	if ctx.Err() == nil {
+		d.status.Report(d.provider, openapi.Failed, "directory watcher stopped")
+	}
+}
+
 func (d *dirWatcher) change(path string, cType changeType) {
 	if keyType, key, ok := d.getKey(path); ok {
 		switch keyType {
-		case jsonKey:
-			d.changeJSONFile(key, path, cType)
+		case specKey:
+			d.changeSpecFile(key, path, cType)
 		case urlKey:
 			d.changeURLFile(key, path, cType)
 		}
 	}
 }
 
-func (d *dirWatcher) changeJSONFile(key, path string, cType changeType) {
+func (d *dirWatcher) changeSpecFile(key, path string, cType changeType) {
 	switch cType {
 	case add:
-		d.store.Put(d.source, key, newCachedFileSpec(path))
+		d.store.Put(d.source, key, openapi.Transformed(newCachedFileSpec(path, d.cache), d.transforms...))
 	case remove:
 		d.store.Remove(d.source, key)
 	}
@@ -139,7 +169,8 @@ func (d *dirWatcher) changeURLFile(key, path string, cType changeType) {
 	case add:
 		file, err := os.Open(path)
 		if err != nil {
-			log.Printf("unable to parse url file %s: %v\n", path, err)
+			d.logger.Error("unable to open url file", "path", path, "err", err)
+			return
 		}
 		defer file.Close()
 		scanner := bufio.NewScanner(file)
@@ -147,13 +178,18 @@ func (d *dirWatcher) changeURLFile(key, path string, cType changeType) {
 		for scanner.Scan() {
 			row := scanner.Text()
 			if split := strings.SplitN(row, ": ", 2); len(split) == 2 {
-				specs[strings.Trim(split[0], " ")] = openapi.NewCachedRemoteSpec(strings.Trim(split[1], " "), 20*time.Second)
+				remote, err := d.remoteSpec(split[1])
+				if err != nil {
+					d.logger.Warn("ignoring url file row", "path", path, "row", row, "err", err)
+					continue
+				}
+				specs[strings.Trim(split[0], " ")] = openapi.Transformed(openapi.CachedWith(remote, d.cache), d.transforms...)
 			} else {
-				log.Printf("unexpected file formatting in file %s row '%s'\n", path, row)
+				d.logger.Warn("unexpected formatting of url file row", "path", path, "row", row)
 			}
 		}
 		if err := scanner.Err(); err != nil {
-			log.Printf("error when scanning file %s: %v\n", path, err)
+			d.logger.Error("unable to scan url file", "path", path, "err", err)
 			return
 		}
 		d.store.ReplaceAllOf(source, specs)
@@ -162,23 +198,39 @@ func (d *dirWatcher) changeURLFile(key, path string, cType changeType) {
 	}
 }
 
+// remoteSpec of a url file row value, the url optionally followed by auth=profile
+func (d *dirWatcher) remoteSpec(value string) (openapi.Spec, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("fileRepository: missing url")
+	}
+	profile := ""
+	for _, option := range fields[1:] {
+		if !strings.HasPrefix(option, "auth=") {
+			return nil, fmt.Errorf("fileRepository: unknown url option %s", option)
+		}
+		profile = strings.TrimPrefix(option, "auth=")
+	}
+	return d.fetcher.SpecWithAuth(fields[0], profile)
+}
+
 type keyType int32
 
 const (
-	jsonKey keyType = iota
+	specKey keyType = iota
 	urlKey
 )
 
 func (d *dirWatcher) getKey(path string) (keyType, string, bool) {
 	fileName := filepath.Base(path)
-	if strings.HasPrefix(fileName, d.prefix) {
+	if ext := filepath.Ext(fileName); ext != "" && strings.HasPrefix(fileName, d.prefix) {
 		withoutPrefix := strings.TrimPrefix(fileName, d.prefix)
-		switch filepath.Ext(fileName) {
-		case d.jsonExt:
-			return jsonKey, strings.TrimSuffix(withoutPrefix, d.jsonExt), true
+		switch ext {
+		case d.jsonExt, d.yamlExt:
+			return specKey, strings.TrimSuffix(withoutPrefix, ext), true
 		case d.urlExt:
-			return urlKey, strings.TrimSuffix(withoutPrefix, d.urlExt), true
+			return urlKey, strings.TrimSuffix(withoutPrefix, ext), true
 		}
 	}
-	return jsonKey, "", false
+	return specKey, "", false
 }
@@ -2,16 +2,16 @@ package kube
 
 import (
 	"context"
-	"os"
-	"path/filepath"
+	"errors"
+	"fmt"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"k8s.io/apimachinery/pkg/runtime"
 
-	"k8s.io/apimachinery/pkg/watch"
-
 	v1 "k8s.io/api/core/v1"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -32,8 +32,23 @@ const (
 	Deleted
 	Bookmark
 	Error
+	// Resync re-delivers an unchanged object periodically
+	Resync
 )
 
+var eventTypeNames = map[EventType]string{
+	Added:    "added",
+	Modified: "modified",
+	Deleted:  "deleted",
+	Bookmark: "bookmark",
+	Error:    "error",
+	Resync:   "resync",
+}
+
+func (e EventType) String() string {
+	return eventTypeNames[e]
+}
+
 // ListOptions filters watchers
 type ListOptions struct {
 	Namespace     string
@@ -42,29 +57,117 @@ type ListOptions struct {
 
 // Client is a wrapper of the kubernetes API
 type Client struct {
-	api v12.CoreV1Interface
+	api     v12.CoreV1Interface
+	dynamic dynamic.Interface
+	watch   WatchOptions
+}
+
+// InClusterMode decides whether the service account of the pod is used to connect to the cluster
+type InClusterMode string
+
+// InClusterModes of the client
+const (
+	// InClusterAuto uses the service account when running in a pod unless a kubeconfig or context
+	// is configured, and the kubeconfig otherwise
+	InClusterAuto InClusterMode = "auto"
+	// InClusterAlways only uses the service account
+	InClusterAlways InClusterMode = "always"
+	// InClusterNever only uses the kubeconfig
+	InClusterNever InClusterMode = "never"
+)
+
+// ParseInClusterMode parses the name of the mode, auto if empty
+func ParseInClusterMode(name string) (InClusterMode, error) {
+	switch mode := InClusterMode(name); mode {
+	case "":
+		return InClusterAuto, nil
+	case InClusterAuto, InClusterAlways, InClusterNever:
+		return mode, nil
+	}
+	return "", fmt.Errorf("kube: unknown in-cluster mode %s", name)
+}
+
+// ClientOptions select the cluster and the credentials of the client
+type ClientOptions struct {
+	InCluster InClusterMode
+	// Kubeconfig is the path of the kubeconfig, $KUBECONFIG or $HOME/.kube/config if empty
+	Kubeconfig string
+	// Context of the kubeconfig, its current context if empty
+	Context string
+	Watch   WatchOptions
 }
 
 // NewKubeClient creates a new Client and tries to authenticate with kubernetes
-func NewKubeClient() (*Client, error) {
-	kubeConfig := filepath.Join(
-		os.Getenv("HOME"), ".kube", "config",
-	)
-	config, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
-	clientSet, err := kubernetes.NewForConfig(config)
+func NewKubeClient(opts ClientOptions) (*Client, error) {
+	config, err := restConfig(opts)
 	if err != nil {
 		return nil, err
 	}
-	api := clientSet.CoreV1()
-	return &Client{api: api}, nil
+	clientSet, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("kube: unable to create client: %w", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("kube: unable to create dynamic client: %w", err)
+	}
+	return NewClientFor(clientSet, dynamicClient, opts.Watch), nil
+}
+
+// NewClientFor wraps the clientSet and the dynamic client used for the routes, ie. fake clients in tests
+func NewClientFor(clientSet kubernetes.Interface, dynamicClient dynamic.Interface, watch WatchOptions) *Client {
+	return &Client{api: clientSet.CoreV1(), dynamic: dynamicClient, watch: watch.withDefaults()}
+}
+
+// restConfig of the service account if running in a cluster, falling back to the kubeconfig
+func restConfig(opts ClientOptions) (*rest.Config, error) {
+	mode := opts.InCluster
+	if mode == "" {
+		mode = InClusterAuto
+	}
+	if mode == InClusterAuto && opts.Kubeconfig == "" && opts.Context == "" || mode == InClusterAlways {
+		config, err := rest.InClusterConfig()
+		if err == nil {
+			return config, nil
+		}
+		if mode == InClusterAlways || !errors.Is(err, rest.ErrNotInCluster) {
+			return nil, fmt.Errorf("kube: unable to load in-cluster config: %w", err)
+		}
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.Context}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		if mode == InClusterAuto {
+			return nil, fmt.Errorf("kube: not running in a cluster and unable to load kubeconfig: %w", err)
+		}
+		return nil, fmt.Errorf("kube: unable to load kubeconfig: %w", err)
+	}
+	return config, nil
 }
 
 // Service represents a kubernetes service
 type Service struct {
-	Name   string
-	Labels map[string]string
-	Host   string
-	Ports  map[string]int32
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+	Ports       map[string]int32
+}
+
+// Host is the DNS name of the service in the cluster with the domain, ie. orders.team-a.svc.cluster.local
+func (s *Service) Host(clusterDomain string) string {
+	return s.Name + "." + s.Namespace + ".svc." + clusterDomain
+}
+
+// Lookup finds the value of key in the annotations or, if not annotated, the labels of the service
+func (s *Service) Lookup(key string) (string, bool) {
+	if v, ok := s.Annotations[key]; ok {
+		return v, true
+	}
+	v, ok := s.Labels[key]
+	return v, ok
 }
 
 func toService(svc *v1.Service) *Service {
@@ -72,56 +175,78 @@ func toService(svc *v1.Service) *Service {
 	for _, port := range svc.Spec.Ports {
 		ports[port.Name] = port.Port
 	}
-	host := svc.Name
-	return &Service{Name: svc.Name, Labels: merge(svc.Labels, svc.Annotations), Ports: ports, Host: host}
+	return &Service{Name: svc.Name, Namespace: svc.Namespace, Labels: merge(svc.Labels), Annotations: merge(svc.Annotations), Ports: ports}
 }
 
-// WatchService watch changes of services
-func (k *Client) WatchService(ctx context.Context, opts ListOptions, watcherFunc func(*Service, EventType)) error {
-	return watchAny(ctx, k.api.Services(opts.Namespace), opts, func(object runtime.Object, eventType EventType) {
+// WatchService lists and watches services until the context is done, see watchAny
+func (k *Client) WatchService(ctx context.Context, opts ListOptions, watcherFunc func(*Service, EventType), connection func(err error)) error {
+	services := k.api.Services(opts.Namespace)
+	lw := listWatch{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return services.List(ctx, opts)
+		},
+		watch: services.Watch,
+	}
+	return k.watchAny(ctx, lw, opts, func(object runtime.Object, eventType EventType) {
 		if svc, ok := object.(*v1.Service); ok {
 			watcherFunc(toService(svc), eventType)
 		}
-	})
+	}, connection)
 }
 
 // ConfigMap represents a kubernetes configMap
 type ConfigMap struct {
-	Name string
-	Data map[string]string
+	Name        string
+	Namespace   string
+	Annotations map[string]string
+	Data        map[string]string
 }
 
 func toConfigMap(cm *v1.ConfigMap) *ConfigMap {
 	return &ConfigMap{
-		Name: cm.Name,
-		Data: merge(cm.Data),
+		Name:        cm.Name,
+		Namespace:   cm.Namespace,
+		Annotations: merge(cm.Annotations),
+		Data:        merge(cm.Data),
 	}
 }
 
-// WatchConfigMap watch changes of ConfigMaps
-func (k *Client) WatchConfigMap(ctx context.Context, opts ListOptions, watcherFunc func(*ConfigMap, EventType)) error {
-	return watchAny(ctx, k.api.ConfigMaps(opts.Namespace), opts, func(object runtime.Object, eventType EventType) {
+// WatchConfigMap lists and watches ConfigMaps until the context is done, see watchAny
+func (k *Client) WatchConfigMap(ctx context.Context, opts ListOptions, watcherFunc func(*ConfigMap, EventType), connection func(err error)) error {
+	configMaps := k.api.ConfigMaps(opts.Namespace)
+	lw := listWatch{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return configMaps.List(ctx, opts)
+		},
+		watch: configMaps.Watch,
+	}
+	return k.watchAny(ctx, lw, opts, func(object runtime.Object, eventType EventType) {
 		if cm, ok := object.(*v1.ConfigMap); ok {
 			watcherFunc(toConfigMap(cm), eventType)
 		}
-	})
+	}, connection)
 }
 
-type watchable interface {
-	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+// Namespace represents a kubernetes namespace
+type Namespace struct {
+	Name   string
+	Labels map[string]string
 }
 
-func watchAny(ctx context.Context, watchable watchable, opts ListOptions, watcherFunc func(object runtime.Object, eventType EventType)) error {
-	watcher, err := watchable.Watch(ctx, toListOpts(opts))
-	if err != nil {
-		return err
+// WatchNamespace lists and watches namespaces until the context is done, see watchAny
+func (k *Client) WatchNamespace(ctx context.Context, opts ListOptions, watcherFunc func(*Namespace, EventType), connection func(err error)) error {
+	namespaces := k.api.Namespaces()
+	lw := listWatch{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return namespaces.List(ctx, opts)
+		},
+		watch: namespaces.Watch,
 	}
-	go func() {
-		for event := range watcher.ResultChan() {
-			watcherFunc(event.Object, toEventType(event.Type))
+	return k.watchAny(ctx, lw, opts, func(object runtime.Object, eventType EventType) {
+		if ns, ok := object.(*v1.Namespace); ok {
+			watcherFunc(&Namespace{Name: ns.Name, Labels: merge(ns.Labels)}, eventType)
 		}
-	}()
-	return nil
+	}, connection)
 }
 
 func merge(others ...map[string]string) map[string]string {
@@ -137,25 +262,3 @@ func merge(others ...map[string]string) map[string]string {
 	}
 	return labels
 }
-
-func toListOpts(opts ListOptions) metav1.ListOptions {
-	return metav1.ListOptions{
-		LabelSelector: opts.LabelSelector,
-	}
-}
-
-func toEventType(eventType watch.EventType) EventType {
-	switch eventType {
-	case watch.Added:
-		return Added
-	case watch.Modified:
-		return Modified
-	case watch.Deleted:
-		return Deleted
-	case watch.Bookmark:
-		return Bookmark
-	case watch.Error:
-		return Error
-	}
-	return Error
-}
@@ -0,0 +1,99 @@
+package kube
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster: {server: "https://dev.example.com"}
+- name: staging
+  cluster: {server: "https://staging.example.com"}
+users:
+- name: user
+  user: {token: secret}
+contexts:
+- name: dev
+  context: {cluster: dev, user: user}
+- name: staging
+  context: {cluster: staging, user: user}
+`
+
+func writeKubeconfig(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "kube")
+	if err != nil {
+		t.Fatalf("unable to create dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(path, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatalf("unable to write kubeconfig: %v", err)
+	}
+	return path
+}
+
+func TestRestConfigSelectsKubeconfigAndContext(t *testing.T) {
+	path := writeKubeconfig(t)
+	tests := []struct {
+		name   string
+		opts   ClientOptions
+		server string
+	}{
+		{name: "current context", opts: ClientOptions{Kubeconfig: path}, server: "https://dev.example.com"},
+		{name: "selected context", opts: ClientOptions{Kubeconfig: path, Context: "staging"}, server: "https://staging.example.com"},
+		{name: "never in cluster", opts: ClientOptions{InCluster: InClusterNever, Kubeconfig: path}, server: "https://dev.example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := restConfig(test.opts)
+			if err != nil {
+				t.Fatalf("unable to load config: %v", err)
+			}
+			if config.Host != test.server {
+				t.Errorf("expected server %s, got %s", test.server, config.Host)
+			}
+		})
+	}
+}
+
+func TestRestConfigFallsBackToKubeconfigEnv(t *testing.T) {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		t.Skip("running in a cluster")
+	}
+	path := writeKubeconfig(t)
+	defer os.Setenv("KUBECONFIG", os.Getenv("KUBECONFIG"))
+	os.Setenv("KUBECONFIG", path)
+	config, err := restConfig(ClientOptions{})
+	if err != nil {
+		t.Fatalf("unable to load config: %v", err)
+	}
+	if config.Host != "https://dev.example.com" {
+		t.Errorf("expected the kubeconfig of KUBECONFIG to be used, got %s", config.Host)
+	}
+}
+
+func TestRestConfigReportsWhyNoConfigWasLoaded(t *testing.T) {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		t.Skip("running in a cluster")
+	}
+	path := writeKubeconfig(t)
+	if _, err := restConfig(ClientOptions{Kubeconfig: path, Context: "prod"}); err == nil || !strings.Contains(err.Error(), "prod") {
+		t.Errorf("expected the unknown context to be reported, got %v", err)
+	}
+	if _, err := restConfig(ClientOptions{InCluster: InClusterAlways}); err == nil || !strings.Contains(err.Error(), "in-cluster") {
+		t.Errorf("expected the missing service account to be reported, got %v", err)
+	}
+	if _, err := NewKubeClient(ClientOptions{Kubeconfig: filepath.Join(filepath.Dir(path), "missing")}); err == nil {
+		t.Error("expected a missing kubeconfig to be reported")
+	}
+	if _, err := ParseInClusterMode("sometimes"); err == nil {
+		t.Error("expected an unknown in-cluster mode to be rejected")
+	}
+}
@@ -0,0 +1,121 @@
+package kube
+
+import (
+	"context"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The route resources are watched with the dynamic client as the typed clients don't know them
+var (
+	IngressResource   = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+	HTTPRouteResource = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+)
+
+// Route represents an ingress or a Gateway API HTTPRoute exposing an API publicly
+type Route struct {
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+	// URL is the public base url of the first rule of the route with a host, ie. https://api.example.com/orders.
+	// Empty if no rule has a host
+	URL string
+}
+
+// WatchIngress lists and watches networking.k8s.io/v1 ingresses until the context is done, see watchAny
+func (k *Client) WatchIngress(ctx context.Context, opts ListOptions, watcherFunc func(*Route, EventType), connection func(err error)) error {
+	return k.watchRoutes(ctx, IngressResource, opts, toIngressRoute, watcherFunc, connection)
+}
+
+// WatchHTTPRoute lists and watches gateway.networking.k8s.io/v1 HTTPRoutes until the context is done, see watchAny
+func (k *Client) WatchHTTPRoute(ctx context.Context, opts ListOptions, watcherFunc func(*Route, EventType), connection func(err error)) error {
+	return k.watchRoutes(ctx, HTTPRouteResource, opts, toHTTPRoute, watcherFunc, connection)
+}
+
+func (k *Client) watchRoutes(ctx context.Context, resource schema.GroupVersionResource, opts ListOptions, toRoute func(*unstructured.Unstructured) *Route, watcherFunc func(*Route, EventType), connection func(err error)) error {
+	routes := k.dynamic.Resource(resource).Namespace(opts.Namespace)
+	lw := listWatch{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return routes.List(ctx, opts)
+		},
+		watch: routes.Watch,
+	}
+	return k.watchAny(ctx, lw, opts, func(object runtime.Object, eventType EventType) {
+		if obj, ok := object.(*unstructured.Unstructured); ok {
+			watcherFunc(toRoute(obj), eventType)
+		}
+	}, connection)
+}
+
+func routeOf(obj *unstructured.Unstructured) *Route {
+	return &Route{Name: obj.GetName(), Namespace: obj.GetNamespace(), Labels: merge(obj.GetLabels()), Annotations: merge(obj.GetAnnotations())}
+}
+
+// toIngressRoute uses the first path of the first rule with a host, served over https if the host is in the tls
+// section of the ingress
+func toIngressRoute(obj *unstructured.Unstructured) *Route {
+	route := routeOf(obj)
+	tls := make(map[string]bool)
+	for _, t := range nestedMaps(obj.Object, "spec", "tls") {
+		hosts, _, _ := unstructured.NestedStringSlice(t, "hosts")
+		for _, host := range hosts {
+			tls[host] = true
+		}
+	}
+	for _, rule := range nestedMaps(obj.Object, "spec", "rules") {
+		host, _, _ := unstructured.NestedString(rule, "host")
+		if host == "" || strings.Contains(host, "*") {
+			continue
+		}
+		path := ""
+		if paths := nestedMaps(rule, "http", "paths"); len(paths) > 0 {
+			path, _, _ = unstructured.NestedString(paths[0], "path")
+		}
+		scheme := "http"
+		if tls[host] {
+			scheme = "https"
+		}
+		route.URL = scheme + "://" + host + strings.TrimSuffix(path, "/")
+		break
+	}
+	return route
+}
+
+// toHTTPRoute uses the first hostname and the path of the first match, served over https as the listeners of
+// the gateway are unknown
+func toHTTPRoute(obj *unstructured.Unstructured) *Route {
+	route := routeOf(obj)
+	hostnames, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "hostnames")
+	for _, host := range hostnames {
+		if strings.Contains(host, "*") {
+			continue
+		}
+		path := ""
+		for _, rule := range nestedMaps(obj.Object, "spec", "rules") {
+			if matches := nestedMaps(rule, "matches"); len(matches) > 0 {
+				path, _, _ = unstructured.NestedString(matches[0], "path", "value")
+				break
+			}
+		}
+		route.URL = "https://" + host + strings.TrimSuffix(path, "/")
+		break
+	}
+	return route
+}
+
+// nestedMaps returns the objects of the slice at the fields, skipping any other values
+func nestedMaps(obj map[string]interface{}, fields ...string) []map[string]interface{} {
+	values, _, _ := unstructured.NestedSlice(obj, fields...)
+	maps := make([]map[string]interface{}, 0, len(values))
+	for _, v := range values {
+		if m, ok := v.(map[string]interface{}); ok {
+			maps = append(maps, m)
+		}
+	}
+	return maps
+}
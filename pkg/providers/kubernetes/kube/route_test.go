@@ -0,0 +1,95 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func unstructuredOf(apiVersion, kind, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name": name, "namespace": "team-a",
+			"annotations": map[string]interface{}{"swagger-path": "/openapi.json"},
+		},
+		"spec": spec,
+	}}
+}
+
+func TestRoutesAreBuiltFromTheirPublicHostAndPath(t *testing.T) {
+	tests := []struct {
+		name  string
+		route *Route
+		url   string
+	}{
+		{name: "ingress with tls", url: "https://api.example.com/orders", route: toIngressRoute(unstructuredOf("networking.k8s.io/v1", "Ingress", "orders", map[string]interface{}{
+			"tls": []interface{}{map[string]interface{}{"hosts": []interface{}{"api.example.com"}}},
+			"rules": []interface{}{
+				map[string]interface{}{"host": "*.example.com"},
+				map[string]interface{}{"host": "api.example.com", "http": map[string]interface{}{"paths": []interface{}{
+					map[string]interface{}{"path": "/orders/", "pathType": "Prefix"},
+					map[string]interface{}{"path": "/payments", "pathType": "Prefix"},
+				}}},
+			},
+		}))},
+		{name: "ingress without tls and path", url: "http://orders.example.com", route: toIngressRoute(unstructuredOf("networking.k8s.io/v1", "Ingress", "orders", map[string]interface{}{
+			"rules": []interface{}{map[string]interface{}{"host": "orders.example.com"}},
+		}))},
+		{name: "ingress without host", url: "", route: toIngressRoute(unstructuredOf("networking.k8s.io/v1", "Ingress", "orders", map[string]interface{}{
+			"defaultBackend": map[string]interface{}{"service": map[string]interface{}{"name": "orders"}},
+		}))},
+		{name: "HTTPRoute", url: "https://api.example.com/pets", route: toHTTPRoute(unstructuredOf("gateway.networking.k8s.io/v1", "HTTPRoute", "pets", map[string]interface{}{
+			"hostnames": []interface{}{"*.example.com", "api.example.com"},
+			"rules": []interface{}{
+				map[string]interface{}{"backendRefs": []interface{}{}},
+				map[string]interface{}{"matches": []interface{}{map[string]interface{}{"path": map[string]interface{}{"type": "PathPrefix", "value": "/pets"}}}},
+			},
+		}))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.route.URL != test.url || test.route.Namespace != "team-a" || test.route.Annotations["swagger-path"] != "/openapi.json" {
+				t.Errorf("expected a route at %s, got %+v", test.url, test.route)
+			}
+		})
+	}
+}
+
+func TestWatchIngressListsAndWatchesIngresses(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rule := map[string]interface{}{"rules": []interface{}{map[string]interface{}{"host": "api.example.com"}}}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), unstructuredOf("networking.k8s.io/v1", "Ingress", "orders", rule))
+	client := NewClientFor(fake.NewSimpleClientset(), dynamicClient, WatchOptions{})
+	events := make(chan string, 10)
+	check(t, client.WatchIngress(ctx, ListOptions{Namespace: "team-a"}, func(route *Route, eventType EventType) {
+		events <- eventType.String() + " " + route.Name + " " + route.URL
+	}, func(error) {}))
+	receive(t, events, "added orders http://api.example.com")
+	// the fake client ignores resourceVersions, the watch has to be started before the ingress is created
+	for deadline := time.Now().Add(2 * time.Second); !watching(dynamicClient); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the ingress watch")
+		}
+	}
+	_, err := dynamicClient.Resource(IngressResource).Namespace("team-a").Create(ctx, unstructuredOf("networking.k8s.io/v1", "Ingress", "pets", rule), metav1.CreateOptions{})
+	check(t, err)
+	receive(t, events, "added pets http://api.example.com")
+}
+
+func watching(client *dynamicfake.FakeDynamicClient) bool {
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "watch" && action.GetResource() == IngressResource {
+			return true
+		}
+	}
+	return false
+}
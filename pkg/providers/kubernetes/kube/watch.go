@@ -0,0 +1,238 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// WatchOptions configure how the watches recover, unset options fall back to the defaults
+type WatchOptions struct {
+	// Resync re-delivers the known objects as Resync events, 5 minutes by default, negative to disable
+	Resync time.Duration
+	// Backoff is the initial delay before reconnecting, doubled up to MaxBackoff while reconnecting fails.
+	// 1 second by default
+	Backoff time.Duration
+	// MaxBackoff is 30 seconds by default
+	MaxBackoff time.Duration
+}
+
+func (o WatchOptions) withDefaults() WatchOptions {
+	if o.Resync == 0 {
+		o.Resync = 5 * time.Minute
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 30 * time.Second
+	}
+	if o.MaxBackoff < o.Backoff {
+		o.MaxBackoff = o.Backoff
+	}
+	return o
+}
+
+// listWatch lists and watches a kind of objects
+type listWatch struct {
+	list  func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error)
+	watch func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+}
+
+// reflector keeps the known objects of a list and watch in sync and delivers their changes to the handler,
+// it is only used by the goroutine of the watch
+type reflector struct {
+	lw         listWatch
+	opts       ListOptions
+	watch      WatchOptions
+	handler    func(object runtime.Object, eventType EventType)
+	connection func(err error)
+	known      map[string]runtime.Object
+	// resourceVersion the watch is resumed from, the objects are listed again if it is empty
+	resourceVersion string
+}
+
+// watchAny lists the objects, delivering them as Added events, and watches their changes until the context
+// is done. Closed watches are resumed from the last seen resourceVersion. If it expired the objects are listed
+// again and the objects that vanished meanwhile are delivered as Deleted events. connection is called with the
+// error while reconnecting and with nil once the watch is connected again. Only the first list fails watchAny,
+// the handler is never called concurrently
+func (k *Client) watchAny(ctx context.Context, lw listWatch, opts ListOptions, handler func(object runtime.Object, eventType EventType), connection func(err error)) error {
+	r := &reflector{lw: lw, opts: opts, watch: k.watch, handler: handler, connection: connection, known: make(map[string]runtime.Object)}
+	if err := r.list(ctx); err != nil {
+		return err
+	}
+	go r.run(ctx)
+	return nil
+}
+
+func (r *reflector) run(ctx context.Context) {
+	var resync <-chan time.Time
+	if r.watch.Resync > 0 {
+		ticker := time.NewTicker(r.watch.Resync)
+		defer ticker.Stop()
+		resync = ticker.C
+	}
+	backoff := r.watch.Backoff
+	reconnecting := false
+	for {
+		err := r.resume(ctx, resync, func() {
+			backoff = r.watch.Backoff
+			if reconnecting {
+				reconnecting = false
+				r.connection(nil)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			// the api server closes watches routinely, they are resumed right away
+			continue
+		}
+		reconnecting = true
+		r.connection(err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > r.watch.MaxBackoff {
+			backoff = r.watch.MaxBackoff
+		}
+	}
+}
+
+// resume the watch from the last seen resourceVersion, listing the objects first if it is unknown. connected
+// is called once the watch is established, nil is returned if the watch was closed by the api server
+func (r *reflector) resume(ctx context.Context, resync <-chan time.Time, connected func()) error {
+	if r.resourceVersion == "" {
+		if err := r.list(ctx); err != nil {
+			return err
+		}
+	}
+	w, err := r.lw.watch(ctx, metav1.ListOptions{
+		LabelSelector:       r.opts.LabelSelector,
+		ResourceVersion:     r.resourceVersion,
+		AllowWatchBookmarks: true,
+	})
+	if err != nil {
+		if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+			r.resourceVersion = ""
+		}
+		return fmt.Errorf("kube: unable to watch: %w", err)
+	}
+	defer w.Stop()
+	connected()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-resync:
+			for _, object := range r.known {
+				r.handler(object, Resync)
+			}
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return nil
+			}
+			if err := r.handle(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (r *reflector) handle(event watch.Event) error {
+	eventType := toEventType(event.Type)
+	if eventType == Error {
+		err := apierrors.FromObject(event.Object)
+		if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+			r.resourceVersion = ""
+		}
+		return fmt.Errorf("kube: watch failed: %w", err)
+	}
+	accessor, err := meta.Accessor(event.Object)
+	if err != nil {
+		return fmt.Errorf("kube: unexpected object in watch: %w", err)
+	}
+	r.resourceVersion = accessor.GetResourceVersion()
+	if eventType == Bookmark {
+		return nil
+	}
+	key := keyOf(accessor)
+	if eventType == Deleted {
+		delete(r.known, key)
+	} else {
+		r.known[key] = event.Object
+	}
+	r.handler(event.Object, eventType)
+	return nil
+}
+
+// list the objects and reconcile them with the known objects, the objects that vanished are deleted
+func (r *reflector) list(ctx context.Context) error {
+	list, err := r.lw.list(ctx, metav1.ListOptions{LabelSelector: r.opts.LabelSelector})
+	if err != nil {
+		return fmt.Errorf("kube: unable to list: %w", err)
+	}
+	listMeta, err := meta.ListAccessor(list)
+	if err != nil {
+		return fmt.Errorf("kube: unexpected list: %w", err)
+	}
+	objects, err := meta.ExtractList(list)
+	if err != nil {
+		return fmt.Errorf("kube: unexpected list: %w", err)
+	}
+	listed := make(map[string]runtime.Object, len(objects))
+	for _, object := range objects {
+		accessor, err := meta.Accessor(object)
+		if err != nil {
+			return fmt.Errorf("kube: unexpected object in list: %w", err)
+		}
+		listed[keyOf(accessor)] = object
+	}
+	for key, object := range r.known {
+		if _, ok := listed[key]; !ok {
+			r.handler(object, Deleted)
+		}
+	}
+	for _, object := range objects {
+		accessor, _ := meta.Accessor(object)
+		known, ok := r.known[keyOf(accessor)]
+		if !ok {
+			r.handler(object, Added)
+		} else if knownAccessor, _ := meta.Accessor(known); knownAccessor.GetResourceVersion() != accessor.GetResourceVersion() {
+			r.handler(object, Modified)
+		}
+	}
+	r.known = listed
+	r.resourceVersion = listMeta.GetResourceVersion()
+	return nil
+}
+
+func keyOf(object metav1.Object) string {
+	return object.GetNamespace() + "/" + object.GetName()
+}
+
+func toEventType(eventType watch.EventType) EventType {
+	switch eventType {
+	case watch.Added:
+		return Added
+	case watch.Modified:
+		return Modified
+	case watch.Deleted:
+		return Deleted
+	case watch.Bookmark:
+		return Bookmark
+	case watch.Error:
+		return Error
+	}
+	return Error
+}
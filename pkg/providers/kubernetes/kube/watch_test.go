@@ -0,0 +1,130 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testService(name, resourceVersion string) *v1.Service {
+	return &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", ResourceVersion: resourceVersion}}
+}
+
+// fakeWatches lists the services of the tracker at resourceVersion 1 and hands out the watches to the test
+func fakeWatches(t *testing.T, objects ...runtime.Object) (*fake.Clientset, chan *watch.FakeWatcher, chan string) {
+	clientSet := fake.NewSimpleClientset(objects...)
+	clientSet.PrependReactor("list", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		list, err := clientSet.Tracker().List(v1.SchemeGroupVersion.WithResource("services"), v1.SchemeGroupVersion.WithKind("Service"), "")
+		if err != nil {
+			return true, nil, err
+		}
+		list.(*v1.ServiceList).ResourceVersion = "1"
+		return true, list, nil
+	})
+	watches := make(chan *watch.FakeWatcher, 10)
+	versions := make(chan string, 10)
+	clientSet.PrependWatchReactor("services", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewFake()
+		versions <- action.(k8stesting.WatchActionImpl).GetWatchRestrictions().ResourceVersion
+		watches <- w
+		return true, w, nil
+	})
+	return clientSet, watches, versions
+}
+
+func receive(t *testing.T, c chan string, expected string) {
+	t.Helper()
+	select {
+	case actual := <-c:
+		if actual != expected {
+			t.Fatalf("expected %s, got %s", expected, actual)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for %s", expected)
+	}
+}
+
+func TestWatchResumesAndReconcilesAfterExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clientSet, watches, versions := fakeWatches(t, testService("a", "1"), testService("b", "1"))
+	client := NewClientFor(clientSet, nil, WatchOptions{Resync: -1, Backoff: time.Millisecond})
+	events := make(chan string, 10)
+	connections := make(chan string, 10)
+	err := client.WatchService(ctx, ListOptions{}, func(svc *Service, eventType EventType) {
+		events <- eventType.String() + " " + svc.Name
+	}, func(err error) {
+		if err != nil {
+			connections <- "reconnecting"
+		} else {
+			connections <- "connected"
+		}
+	})
+	if err != nil {
+		t.Fatalf("unable to watch: %v", err)
+	}
+	receive(t, events, "added a")
+	receive(t, events, "added b")
+
+	receive(t, versions, "1")
+	w := <-watches
+	check(t, clientSet.Tracker().Update(v1.SchemeGroupVersion.WithResource("services"), testService("b", "5"), "default"))
+	w.Modify(testService("b", "5"))
+	receive(t, events, "modified b")
+	w.Action(watch.Bookmark, testService("", "7"))
+	w.Stop()
+	receive(t, versions, "7")
+	w = <-watches
+
+	check(t, clientSet.Tracker().Delete(v1.SchemeGroupVersion.WithResource("services"), "default", "a"))
+	w.Error(&metav1.Status{Status: metav1.StatusFailure, Code: 410, Reason: metav1.StatusReasonExpired})
+	receive(t, connections, "reconnecting")
+	receive(t, events, "deleted a")
+	receive(t, versions, "1")
+	<-watches
+	receive(t, connections, "connected")
+	select {
+	case event := <-events:
+		t.Errorf("expected the unchanged service not to be delivered again, got %s", event)
+	default:
+	}
+}
+
+func TestWatchResyncsKnownObjects(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clientSet, _, _ := fakeWatches(t, testService("a", "1"))
+	client := NewClientFor(clientSet, nil, WatchOptions{Resync: 10 * time.Millisecond})
+	events := make(chan string, 100)
+	check(t, client.WatchService(ctx, ListOptions{}, func(svc *Service, eventType EventType) {
+		events <- eventType.String() + " " + svc.Name
+	}, func(err error) {}))
+	receive(t, events, "added a")
+	receive(t, events, "resync a")
+}
+
+func TestWatchFailsIfTheObjectsCannotBeListed(t *testing.T) {
+	clientSet := fake.NewSimpleClientset()
+	clientSet.PrependReactor("list", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+	err := NewClientFor(clientSet, nil, WatchOptions{}).WatchService(context.Background(), ListOptions{}, func(*Service, EventType) {}, func(error) {})
+	if err == nil {
+		t.Error("expected the failed list to be reported")
+	}
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -4,38 +4,168 @@ import (
 	"context"
 	"fmt"
 	"strconv"
-	"time"
+	"strings"
+	"sync"
 
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+	"github.com/SimonSchneider/docs-prox/pkg/metrics"
 	"github.com/SimonSchneider/docs-prox/pkg/providers/kubernetes/kube"
 
 	"github.com/SimonSchneider/docs-prox/pkg/openapi"
 )
 
 const (
-	serviceSource = "kubeService"
+	serviceSource   = "kubeService"
+	ingressSource   = "kubeIngress"
+	httpRouteSource = "kubeHTTPRoute"
 )
 
-// Configure the SpecStore
-func Configure(ctx context.Context, store openapi.SpecStore) error {
-	api, err := kube.NewKubeClient()
+const (
+	serviceProvider   = "kubernetes-services"
+	configMapProvider = "kubernetes-configmaps"
+	namespaceProvider = "kubernetes-namespaces"
+	ingressProvider   = "kubernetes-ingresses"
+	httpRouteProvider = "kubernetes-httproutes"
+)
+
+// Options of the kubernetes provider, unset options fall back to the defaults
+type Options struct {
+	// Client selects the cluster the services and configMaps are watched in
+	Client kube.ClientOptions
+	// Namespaces the services and configMaps are watched in, every namespace if empty
+	Namespaces []string
+	// NamespaceSelector selects the watched namespaces by label instead, the services and configMaps
+	// of a namespace are watched while it matches
+	NamespaceSelector string
+	// ServiceSelector selects the watched services, swagger by default
+	ServiceSelector string
+	// ConfigMapSelector selects the watched configMaps, remote-swagger by default
+	ConfigMapSelector string
+	Annotations       Annotations
+	// KeyTemplate is the name the specs are listed with, {name}.{namespace} by default. {name} is the name
+	// of the service or the key in the configMap and {namespace} its namespace
+	KeyTemplate string
+	// RouteKeyTemplate is the name the specs of ingresses and HTTPRoutes are listed with, {name}.{namespace}.{kind}
+	// by default so that they don't conflict with the service of the same name. {kind} is ingress or httproute
+	RouteKeyTemplate string
+	// ClusterDomain of the DNS names the services are fetched from, cluster.local by default
+	ClusterDomain string
+	// Ingresses watches the ingresses with the path annotation, their specs are fetched from their public url
+	Ingresses bool
+	// HTTPRoutes watches the Gateway API HTTPRoutes with the path annotation like the ingresses
+	HTTPRoutes bool
+}
+
+// Annotations are the keys of the annotations configuring the specs of the services and configMaps
+type Annotations struct {
+	// Path of the spec on the service, swagger-path by default
+	Path string `json:"path"`
+	// Port of the service the spec is served on by name or number, swagger-port by default
+	Port string `json:"port"`
+	// Auth names the auth profile the specs are fetched with, swagger-auth by default
+	Auth string `json:"auth"`
+	// Server is the base url the specs are served with, swagger-server by default, see openapi.WithServer
+	Server string `json:"server"`
+}
+
+func (o Options) withDefaults() (Options, error) {
+	if len(o.Namespaces) > 0 && o.NamespaceSelector != "" {
+		return o, fmt.Errorf("kubernetes: namespaces and a namespace selector are mutually exclusive")
+	}
+	defaults := map[*string]string{
+		&o.ServiceSelector:    "swagger",
+		&o.ConfigMapSelector:  "remote-swagger",
+		&o.KeyTemplate:        "{name}.{namespace}",
+		&o.RouteKeyTemplate:   "{name}.{namespace}.{kind}",
+		&o.ClusterDomain:      "cluster.local",
+		&o.Annotations.Path:   "swagger-path",
+		&o.Annotations.Port:   "swagger-port",
+		&o.Annotations.Auth:   "swagger-auth",
+		&o.Annotations.Server: "swagger-server",
+	}
+	for option, fallback := range defaults {
+		if *option == "" {
+			*option = fallback
+		}
+	}
+	return o, nil
+}
+
+// Configure the SpecStore, the remote specs are fetched with the fetcher, cached with the cache options and
+// served with the transforms
+func Configure(ctx context.Context, store openapi.SpecStore, status openapi.StatusReporter, logger logging.Logger, fetcher *openapi.Fetcher, cache openapi.CacheOptions, transforms []openapi.Transform, opts Options) error {
+	opts, err := opts.withDefaults()
 	if err != nil {
 		return err
 	}
-	repo := &kubeWatcher{client: api, store: store}
+	api, err := kube.NewKubeClient(opts.Client)
+	if err != nil {
+		status.Report(serviceProvider, openapi.Failed, "unable to connect to the cluster: %v", err)
+		status.Report(configMapProvider, openapi.Failed, "unable to connect to the cluster: %v", err)
+		return err
+	}
+	repo := &kubeWatcher{client: api, store: store, status: status, logger: logger.With("provider", "kubernetes"), fetcher: fetcher, cache: cache, transforms: transforms, opts: opts,
+		watched: make(map[string]*namespaceSpecs)}
 	return repo.start(ctx)
 }
 
 type kubeWatcher struct {
-	client *kube.Client
-	store  openapi.SpecStore
+	client     *kube.Client
+	store      openapi.SpecStore
+	status     openapi.StatusReporter
+	logger     logging.Logger
+	fetcher    *openapi.Fetcher
+	cache      openapi.CacheOptions
+	transforms []openapi.Transform
+	opts       Options
+	mu         sync.Mutex
+	// watched are the stored specs by watched namespace, they are removed when it stops matching
+	watched map[string]*namespaceSpecs
+}
+
+type namespaceSpecs struct {
+	services   map[string]bool
+	configMaps map[string]bool
+	routes     map[routeKey]bool
+}
+
+type routeKey struct {
+	source, key string
 }
 
 func (r *kubeWatcher) start(ctx context.Context) error {
-	builders := []func(context.Context) error{
+	if r.opts.NamespaceSelector != "" {
+		return r.startNamespaceWatcher(ctx)
+	}
+	namespaces := r.opts.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	for _, namespace := range namespaces {
+		if err := r.watchNamespace(ctx, namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchNamespace watches the services and configMaps of the namespace until the context is done,
+// every namespace if empty
+func (r *kubeWatcher) watchNamespace(ctx context.Context, namespace string) error {
+	r.mu.Lock()
+	r.watched[namespace] = &namespaceSpecs{services: make(map[string]bool), configMaps: make(map[string]bool), routes: make(map[routeKey]bool)}
+	r.mu.Unlock()
+	builders := []func(context.Context, string) error{
 		r.startSvcWatcher, r.startRemoteCMWatcher,
 	}
+	if r.opts.Ingresses {
+		builders = append(builders, r.startIngressWatcher)
+	}
+	if r.opts.HTTPRoutes {
+		builders = append(builders, r.startHTTPRouteWatcher)
+	}
 	for _, builder := range builders {
-		err := builder(ctx)
+		err := builder(ctx, namespace)
 		if err != nil {
 			return err
 		}
@@ -43,35 +173,149 @@ func (r *kubeWatcher) start(ctx context.Context) error {
 	return nil
 }
 
-func (r *kubeWatcher) startSvcWatcher(ctx context.Context) error {
+// unwatchNamespace removes the specs of the namespace, its watchers have to be stopped first
+func (r *kubeWatcher) unwatchNamespace(namespace string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	specs, ok := r.watched[namespace]
+	if !ok {
+		return
+	}
+	delete(r.watched, namespace)
+	for name := range specs.services {
+		r.store.Remove(serviceSource, name)
+	}
+	for source := range specs.configMaps {
+		r.store.RemoveAllOf(source)
+	}
+	for route := range specs.routes {
+		r.store.Remove(route.source, route.key)
+	}
+	r.logger.Debug("namespace no longer watched", "namespace", namespace)
+}
+
+func (r *kubeWatcher) startNamespaceWatcher(ctx context.Context) error {
+	opts := kube.ListOptions{
+		LabelSelector: r.opts.NamespaceSelector,
+	}
+	// stops are only accessed by the watch callback which is never called concurrently
+	stops := make(map[string]context.CancelFunc)
+	r.status.Report(namespaceProvider, openapi.Starting, "connecting namespace watch")
+	err := r.client.WatchNamespace(ctx, opts, func(ns *kube.Namespace, eventType kube.EventType) {
+		metrics.WatcherEvents.WithLabelValues(namespaceProvider, eventType.String()).Inc()
+		switch eventType {
+		case kube.Added, kube.Modified, kube.Resync:
+			if _, ok := stops[ns.Name]; ok {
+				return
+			}
+			nsCtx, stop := context.WithCancel(ctx)
+			if err := r.watchNamespace(nsCtx, ns.Name); err != nil {
+				stop()
+				r.unwatchNamespace(ns.Name)
+				r.logger.Warn("unable to watch namespace", "namespace", ns.Name, "err", err)
+				return
+			}
+			stops[ns.Name] = stop
+			r.logger.Debug("watching namespace", "namespace", ns.Name)
+		case kube.Deleted:
+			if stop, ok := stops[ns.Name]; ok {
+				stop()
+				delete(stops, ns.Name)
+				r.unwatchNamespace(ns.Name)
+				for _, provider := range []string{serviceProvider, configMapProvider, ingressProvider, httpRouteProvider} {
+					r.status.Remove(providerIn(provider, ns.Name))
+				}
+			}
+		}
+	}, r.reportConnection(namespaceProvider, "namespace watch"))
+	if err != nil {
+		r.status.Report(namespaceProvider, openapi.Failed, "unable to watch namespaces: %v", err)
+		return err
+	}
+	r.status.Report(namespaceProvider, openapi.Running, "namespace watch connected")
+	return nil
+}
+
+func (r *kubeWatcher) startSvcWatcher(ctx context.Context, namespace string) error {
 	opts := kube.ListOptions{
-		Namespace:     "",
-		LabelSelector: "swagger",
+		Namespace:     namespace,
+		LabelSelector: r.opts.ServiceSelector,
 	}
-	return r.client.WatchService(ctx, opts, func(svc *kube.Service, eventType kube.EventType) {
+	watches := providerIn(serviceProvider, namespace)
+	r.status.Report(watches, openapi.Starting, "connecting service watch%s", in(namespace))
+	err := r.client.WatchService(ctx, opts, func(svc *kube.Service, eventType kube.EventType) {
+		metrics.WatcherEvents.WithLabelValues(serviceProvider, eventType.String()).Inc()
 		switch eventType {
 		case kube.Added, kube.Modified:
-			r.addSvc(svc)
+			r.addSvc(namespace, svc)
+		case kube.Resync:
+			if !r.stored(namespace, func(specs *namespaceSpecs) bool { return specs.services[r.keyOf(svc.Name, svc.Namespace)] }) {
+				r.addSvc(namespace, svc)
+			}
 		case kube.Deleted:
-			r.deleteSvc(svc)
+			r.deleteSvc(namespace, svc)
+		}
+	}, r.reportConnection(watches, "service watch"+in(namespace)))
+	if err != nil {
+		r.status.Report(watches, openapi.Failed, "unable to watch services%s: %v", in(namespace), err)
+		return err
+	}
+	r.status.Report(watches, openapi.Running, "service watch%s connected", in(namespace))
+	return nil
+}
+
+// reportConnection reports the provider as reconnecting while the watch is reconnecting
+func (r *kubeWatcher) reportConnection(provider, watch string) func(err error) {
+	return func(err error) {
+		if err != nil {
+			r.status.Report(provider, openapi.Reconnecting, "%s reconnecting: %v", watch, err)
+			return
 		}
-	})
+		r.status.Report(provider, openapi.Running, "%s reconnected", watch)
+	}
+}
+
+// stored is true if the spec selected from the stored specs of the namespace is stored. Resyncs only store
+// the specs that are not stored, ie. as their key was taken by another source, to keep their caches
+func (r *kubeWatcher) stored(namespace string, selected func(specs *namespaceSpecs) bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	specs, ok := r.watched[namespace]
+	return ok && selected(specs)
 }
 
-func (r *kubeWatcher) addSvc(svc *kube.Service) {
+// providerIn names the status of the watches of the provider in the namespace, every namespace reports the
+// state of its watches separately
+func providerIn(provider, namespace string) string {
+	if namespace == "" {
+		return provider
+	}
+	return provider + "/" + namespace
+}
+
+// in describes the watched namespace in status messages
+func in(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return " in namespace " + namespace
+}
+
+func (r *kubeWatcher) addSvc(namespace string, svc *kube.Service) {
+	annotations := r.opts.Annotations
 	var ok bool
 	var path string
 	var port int32
-	if path, ok = svc.Labels["swagger-path"]; !ok {
-		fmt.Println("path cant be empty")
-		r.deleteSvc(svc)
+	if path, ok = svc.Lookup(annotations.Path); !ok {
+		r.logger.Warn("service has no "+annotations.Path+", ignoring it", "service", svc.Name)
+		r.deleteSvc(namespace, svc)
 		return
 	}
 	if len(svc.Ports) == 1 {
 		for _, p := range svc.Ports {
 			port = p
 		}
-	} else if portLabel, ok := svc.Labels["swagger-port"]; ok {
+	} else if portLabel, ok := svc.Lookup(annotations.Port); ok {
 		if p, err := strconv.Atoi(portLabel); err == nil {
 			for _, portNumber := range svc.Ports {
 				if int32(p) == portNumber {
@@ -89,55 +333,229 @@ func (r *kubeWatcher) addSvc(svc *kube.Service) {
 				}
 			}
 			if !found {
-				fmt.Println("Wasn't able to find port")
-				r.deleteSvc(svc)
+				r.logger.Warn("service has no port named by "+annotations.Port+", ignoring it", "service", svc.Name, "port", portLabel)
+				r.deleteSvc(namespace, svc)
 				return
 			}
 		}
 	} else {
-		fmt.Println("Wasn't able to find port")
-		r.deleteSvc(svc)
+		r.logger.Warn("service has multiple ports but no "+annotations.Port+", ignoring it", "service", svc.Name)
+		r.deleteSvc(namespace, svc)
+		return
+	}
+	url := "http://" + svc.Host(r.opts.ClusterDomain) + ":" + fmt.Sprintf("%d", port) + path
+	profile, _ := svc.Lookup(annotations.Auth)
+	remote, err := r.fetcher.SpecWithAuth(url, profile)
+	if err != nil {
+		r.logger.Warn("service references an unknown auth profile, ignoring it", "service", svc.Name, "err", err)
+		r.deleteSvc(namespace, svc)
 		return
 	}
-	url := "http://" + svc.Host + ":" + fmt.Sprintf("%d", port) + path
-	fmt.Printf("storing %s - %s\n", svc.Name, url)
-	r.store.Put(serviceSource, svc.Name, openapi.NewCachedRemoteSpec(url, 20*time.Second))
+	key := r.keyOf(svc.Name, svc.Namespace)
+	r.logger.Debug("storing service", "service", svc.Name, "key", key, "url", url)
+	server, _ := svc.Lookup(annotations.Server)
+	spec := openapi.WithLabels(r.transformed(openapi.CachedWith(remote, r.cache), server), grouped(svc.Labels, svc.Namespace))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if specs, ok := r.watched[namespace]; ok {
+		if err := r.store.Put(serviceSource, key, spec); err != nil {
+			r.logger.Debug("service not stored, retrying on the next resync", "service", svc.Name, "key", key, "err", err)
+			delete(specs.services, key)
+			return
+		}
+		specs.services[key] = true
+	}
+}
+
+// transformed spec with the transforms of the provider, followed by moving the servers to the annotated server
+func (r *kubeWatcher) transformed(spec openapi.Spec, server string) openapi.Spec {
+	transforms := append([]openapi.Transform(nil), r.transforms...)
+	if server != "" {
+		transforms = append(transforms, openapi.ServersAt(server))
+	}
+	return openapi.Transformed(spec, transforms...)
 }
 
-func (r *kubeWatcher) deleteSvc(svc *kube.Service) {
-	r.store.Remove(serviceSource, svc.Name)
-	fmt.Printf("service deleted %s\n", svc.Name)
+func (r *kubeWatcher) deleteSvc(namespace string, svc *kube.Service) {
+	key := r.keyOf(svc.Name, svc.Namespace)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if specs, ok := r.watched[namespace]; ok && specs.services[key] {
+		delete(specs.services, key)
+		r.store.Remove(serviceSource, key)
+		r.logger.Debug("service deleted", "service", svc.Name)
+	}
 }
 
-func (r *kubeWatcher) startRemoteCMWatcher(ctx context.Context) error {
+func (r *kubeWatcher) startRemoteCMWatcher(ctx context.Context, namespace string) error {
 	opts := kube.ListOptions{
-		Namespace:     "",
-		LabelSelector: "remote-swagger",
+		Namespace:     namespace,
+		LabelSelector: r.opts.ConfigMapSelector,
 	}
-	return r.client.WatchConfigMap(ctx, opts, func(cm *kube.ConfigMap, eventType kube.EventType) {
+	watches := providerIn(configMapProvider, namespace)
+	r.status.Report(watches, openapi.Starting, "connecting configMap watch%s", in(namespace))
+	err := r.client.WatchConfigMap(ctx, opts, func(cm *kube.ConfigMap, eventType kube.EventType) {
+		metrics.WatcherEvents.WithLabelValues(configMapProvider, eventType.String()).Inc()
 		switch eventType {
+		case kube.Added, kube.Modified:
+			r.addRemoteCM(namespace, cm)
+		case kube.Resync:
+			if !r.stored(namespace, func(specs *namespaceSpecs) bool { return specs.configMaps[sourceOfCM(cm)] }) {
+				r.addRemoteCM(namespace, cm)
+			}
 		case kube.Deleted:
-			r.deleteRemoteCM(cm)
-		default:
-			r.addRemoteCM(cm)
+			r.deleteRemoteCM(namespace, cm)
 		}
-	})
+	}, r.reportConnection(watches, "configMap watch"+in(namespace)))
+	if err != nil {
+		r.status.Report(watches, openapi.Failed, "unable to watch configMaps%s: %v", in(namespace), err)
+		return err
+	}
+	r.status.Report(watches, openapi.Running, "configMap watch%s connected", in(namespace))
+	return nil
 }
 
-func (r *kubeWatcher) addRemoteCM(cm *kube.ConfigMap) {
+func (r *kubeWatcher) addRemoteCM(namespace string, cm *kube.ConfigMap) {
 	data := make(map[string]openapi.Spec)
 	source := sourceOfCM(cm)
+	profile := cm.Annotations[r.opts.Annotations.Auth]
 	for key, val := range cm.Data {
-		data[key] = openapi.NewCachedRemoteSpec(val, 20*time.Second)
+		remote, err := r.fetcher.SpecWithAuth(val, profile)
+		if err != nil {
+			r.logger.Warn("configMap references an unknown auth profile, ignoring it", "configMap", cm.Name, "err", err)
+			r.deleteRemoteCM(namespace, cm)
+			return
+		}
+		spec := r.transformed(openapi.CachedWith(remote, r.cache), cm.Annotations[r.opts.Annotations.Server])
+		data[r.keyOf(key, cm.Namespace)] = openapi.WithLabels(spec, grouped(nil, cm.Namespace))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if specs, ok := r.watched[namespace]; ok {
+		specs.configMaps[source] = true
+		r.store.ReplaceAllOf(source, data)
+	}
+}
+
+func (r *kubeWatcher) deleteRemoteCM(namespace string, cm *kube.ConfigMap) {
+	source := sourceOfCM(cm)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if specs, ok := r.watched[namespace]; ok && specs.configMaps[source] {
+		delete(specs.configMaps, source)
+		r.store.RemoveAllOf(source)
+		r.logger.Debug("remote configMap deleted", "configMap", cm.Name)
+	}
+}
+
+func (r *kubeWatcher) startIngressWatcher(ctx context.Context, namespace string) error {
+	return r.startRouteWatcher(ctx, namespace, ingressProvider, ingressSource, "ingress", r.client.WatchIngress)
+}
+
+func (r *kubeWatcher) startHTTPRouteWatcher(ctx context.Context, namespace string) error {
+	return r.startRouteWatcher(ctx, namespace, httpRouteProvider, httpRouteSource, "HTTPRoute", r.client.WatchHTTPRoute)
+}
+
+type routeWatch func(ctx context.Context, opts kube.ListOptions, watcherFunc func(*kube.Route, kube.EventType), connection func(err error)) error
+
+func (r *kubeWatcher) startRouteWatcher(ctx context.Context, namespace, provider, source, kind string, watch routeWatch) error {
+	opts := kube.ListOptions{
+		Namespace: namespace,
 	}
-	r.store.ReplaceAllOf(source, data)
+	watches := providerIn(provider, namespace)
+	r.status.Report(watches, openapi.Starting, "connecting %s watch%s", kind, in(namespace))
+	err := watch(ctx, opts, func(route *kube.Route, eventType kube.EventType) {
+		metrics.WatcherEvents.WithLabelValues(provider, eventType.String()).Inc()
+		key := routeKey{source: source, key: r.routeKeyOf(route.Name, route.Namespace, kind)}
+		switch eventType {
+		case kube.Added, kube.Modified:
+			r.addRoute(namespace, key, kind, route)
+		case kube.Resync:
+			if !r.stored(namespace, func(specs *namespaceSpecs) bool { return specs.routes[key] }) {
+				r.addRoute(namespace, key, kind, route)
+			}
+		case kube.Deleted:
+			r.deleteRoute(namespace, key)
+		}
+	}, r.reportConnection(watches, kind+" watch"+in(namespace)))
+	if err != nil {
+		r.status.Report(watches, openapi.Failed, "unable to watch %ss%s: %v", kind, in(namespace), err)
+		return err
+	}
+	r.status.Report(watches, openapi.Running, "%s watch%s connected", kind, in(namespace))
+	return nil
 }
 
-func (r *kubeWatcher) deleteRemoteCM(cm *kube.ConfigMap) {
-	r.store.RemoveAllOf(sourceOfCM(cm))
-	fmt.Printf("remoteConfigMap deleted %s\n", cm.Name)
+// addRoute stores the spec at the path annotation below the public url of the route, the spec is served with
+// the public url as its server unless the route is annotated with another server
+func (r *kubeWatcher) addRoute(namespace string, key routeKey, kind string, route *kube.Route) {
+	annotations := r.opts.Annotations
+	path, ok := route.Annotations[annotations.Path]
+	if !ok {
+		r.deleteRoute(namespace, key)
+		return
+	}
+	if route.URL == "" {
+		r.logger.Warn("route has no host, ignoring it", "resource", kind+"/"+route.Name, "key", key.key)
+		r.deleteRoute(namespace, key)
+		return
+	}
+	url := route.URL + path
+	remote, err := r.fetcher.SpecWithAuth(url, route.Annotations[annotations.Auth])
+	if err != nil {
+		r.logger.Warn("route references an unknown auth profile, ignoring it", "resource", kind+"/"+route.Name, "key", key.key, "err", err)
+		r.deleteRoute(namespace, key)
+		return
+	}
+	server := route.Annotations[annotations.Server]
+	if server == "" {
+		server = route.URL
+	}
+	r.logger.Debug("storing route", "resource", kind+"/"+route.Name, "key", key.key, "url", url)
+	spec := openapi.WithLabels(r.transformed(openapi.CachedWith(remote, r.cache), server), grouped(route.Labels, route.Namespace))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if specs, ok := r.watched[namespace]; ok {
+		if err := r.store.Put(key.source, key.key, spec); err != nil {
+			r.logger.Warn("route not stored, retrying on the next resync", "resource", kind+"/"+route.Name, "key", key.key, "err", err)
+			delete(specs.routes, key)
+			return
+		}
+		specs.routes[key] = true
+	}
+}
+
+// deleteRoute removes the spec of the route if it was stored, most routes don't expose docs
+func (r *kubeWatcher) deleteRoute(namespace string, key routeKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if specs, ok := r.watched[namespace]; ok && specs.routes[key] {
+		delete(specs.routes, key)
+		r.store.Remove(key.source, key.key)
+		r.logger.Debug("route deleted", "key", key.key)
+	}
 }
 
 func sourceOfCM(c *kube.ConfigMap) string {
-	return fmt.Sprintf("kubec:cm:%s", c.Name)
+	return fmt.Sprintf("kubec:cm:%s/%s", c.Namespace, c.Name)
+}
+
+// keyOf the spec named name in the namespace
+func (r *kubeWatcher) keyOf(name, namespace string) string {
+	return strings.NewReplacer("{name}", name, "{namespace}", namespace).Replace(r.opts.KeyTemplate)
+}
+
+// routeKeyOf the spec of the route of the kind named name in the namespace
+func (r *kubeWatcher) routeKeyOf(name, namespace, kind string) string {
+	return strings.NewReplacer("{name}", name, "{namespace}", namespace, "{kind}", strings.ToLower(kind)).Replace(r.opts.RouteKeyTemplate)
+}
+
+// grouped copies the labels with the namespace as the group of the listing
+func grouped(labels map[string]string, namespace string) map[string]string {
+	g := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		g[k] = v
+	}
+	g[openapi.GroupLabel] = namespace
+	return g
 }
@@ -0,0 +1,243 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
+	"github.com/SimonSchneider/docs-prox/pkg/openapi"
+	"github.com/SimonSchneider/docs-prox/pkg/providers/kubernetes/kube"
+	"github.com/SimonSchneider/docs-prox/pkg/test/await"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func startFakeWatcher(t *testing.T, ctx context.Context, opts Options, routes ...runtime.Object) (*fake.Clientset, openapi.SpecRepoStore) {
+	return startFakeWatcherWith(t, ctx, openapi.NewCachedRepository(), openapi.NewStatusRegistry(), opts, routes...)
+}
+
+func startFakeWatcherWith(t *testing.T, ctx context.Context, repo openapi.SpecRepoStore, status openapi.StatusReporter, opts Options, routes ...runtime.Object) (*fake.Clientset, openapi.SpecRepoStore) {
+	opts, err := opts.withDefaults()
+	check(t, err)
+	fetcher, err := openapi.NewFetcher(openapi.DefaultFetcherOptions)
+	check(t, err)
+	clientSet := fake.NewSimpleClientset()
+	watcher := &kubeWatcher{client: kube.NewClientFor(clientSet, dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), routes...), kube.WatchOptions{}), store: repo, status: status,
+		logger: logging.New(ioutil.Discard, logging.Logfmt, logging.DebugLevel), fetcher: fetcher, opts: opts,
+		watched: make(map[string]*namespaceSpecs)}
+	check(t, watcher.start(ctx))
+	return clientSet, repo
+}
+
+func createService(t *testing.T, clientSet *fake.Clientset, namespace, name string, labels, annotations map[string]string) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels, Annotations: annotations},
+		Spec:       v1.ServiceSpec{Ports: []v1.ServicePort{{Name: "http", Port: 8080}}},
+	}
+	_, err := clientSet.CoreV1().Services(namespace).Create(context.Background(), svc, metav1.CreateOptions{})
+	check(t, err)
+}
+
+func awaitKeys(t *testing.T, repo openapi.Repository, expected ...string) {
+	check(t, await.AtMost(2*time.Second).Every(10*time.Millisecond).That(func() error {
+		var names []string
+		for _, meta := range repo.Keys() {
+			names = append(names, meta.Name)
+		}
+		sort.Strings(names)
+		if strings.Join(names, ",") != strings.Join(expected, ",") {
+			return fmt.Errorf("expected keys %v, got %v", expected, names)
+		}
+		return nil
+	}))
+}
+
+func TestWatchesOnlyTheConfiguredNamespaces(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := Options{Namespaces: []string{"team-a"}, ServiceSelector: "docs", Annotations: Annotations{Path: "docs/path"}}
+	clientSet, repo := startFakeWatcher(t, ctx, opts)
+	createService(t, clientSet, "team-b", "other", map[string]string{"docs": ""}, map[string]string{"docs/path": "/openapi"})
+	createService(t, clientSet, "team-a", "unannotated", map[string]string{"docs": ""}, map[string]string{"swagger-path": "/openapi"})
+	createService(t, clientSet, "team-a", "pets", map[string]string{"docs": ""}, map[string]string{"docs/path": "/openapi"})
+	awaitKeys(t, repo, "pets.team-a")
+}
+
+func TestWatchesTheNamespacesWhileTheyMatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clientSet, repo := startFakeWatcher(t, ctx, Options{NamespaceSelector: "docs=enabled"})
+	ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"docs": "enabled"}}}
+	_, err := clientSet.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	check(t, err)
+	// the fake clientSet ignores resourceVersions, the service watch of the namespace has to be started first
+	check(t, await.AtMost(2*time.Second).Every(10*time.Millisecond).That(func() error {
+		for _, action := range clientSet.Actions() {
+			if action.GetVerb() == "watch" && action.GetResource().Resource == "services" && action.GetNamespace() == "team-a" {
+				return nil
+			}
+		}
+		return fmt.Errorf("service watch of team-a not started")
+	}))
+	createService(t, clientSet, "team-a", "pets", map[string]string{"swagger": ""}, map[string]string{"swagger-path": "/openapi"})
+	awaitKeys(t, repo, "pets.team-a")
+	check(t, clientSet.CoreV1().Namespaces().Delete(ctx, "team-a", metav1.DeleteOptions{}))
+	awaitKeys(t, repo)
+}
+
+func providerNames(status *openapi.StatusRegistry) string {
+	var names []string
+	for _, p := range status.Providers() {
+		names = append(names, p.Name+"="+string(p.State))
+	}
+	return strings.Join(names, ",")
+}
+
+func TestReportsTheWatchesOfEveryNamespace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	status := openapi.NewStatusRegistry()
+	startFakeWatcherWith(t, ctx, openapi.NewCachedRepository(), status, Options{Namespaces: []string{"team-a", "team-b"}})
+	expected := "kubernetes-configmaps/team-a=running,kubernetes-configmaps/team-b=running,kubernetes-services/team-a=running,kubernetes-services/team-b=running"
+	if names := providerNames(status); names != expected {
+		t.Errorf("expected the watches of both namespaces to be reported, got %s", names)
+	}
+
+	status = openapi.NewStatusRegistry()
+	clientSet, _ := startFakeWatcherWith(t, ctx, openapi.NewCachedRepository(), status, Options{NamespaceSelector: "docs=enabled"})
+	ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"docs": "enabled"}}}
+	_, err := clientSet.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	check(t, err)
+	check(t, await.AtMost(2*time.Second).Every(10*time.Millisecond).That(func() error {
+		if names := providerNames(status); names != "kubernetes-configmaps/team-a=running,kubernetes-namespaces=running,kubernetes-services/team-a=running" {
+			return fmt.Errorf("expected the watches of the selected namespace to be reported, got %s", names)
+		}
+		return nil
+	}))
+	check(t, clientSet.CoreV1().Namespaces().Delete(ctx, "team-a", metav1.DeleteOptions{}))
+	check(t, await.AtMost(2*time.Second).Every(10*time.Millisecond).That(func() error {
+		if names := providerNames(status); names != "kubernetes-namespaces=running" {
+			return fmt.Errorf("expected the watches of the deleted namespace to be removed, got %s", names)
+		}
+		return nil
+	}))
+}
+
+// removalStore records the removals of the specs
+type removalStore struct {
+	openapi.SpecRepoStore
+	mu      sync.Mutex
+	removed []string
+}
+
+func (s *removalStore) Remove(source, key string) error {
+	s.mu.Lock()
+	s.removed = append(s.removed, source+"/"+key)
+	s.mu.Unlock()
+	return s.SpecRepoStore.Remove(source, key)
+}
+
+func (s *removalStore) RemoveAllOf(source string) {
+	s.mu.Lock()
+	s.removed = append(s.removed, source)
+	s.mu.Unlock()
+	s.SpecRepoStore.RemoveAllOf(source)
+}
+
+func TestOnlyRemovesTheStoredSpecs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := &removalStore{SpecRepoStore: openapi.NewCachedRepository()}
+	clientSet, repo := startFakeWatcherWith(t, ctx, store, openapi.NewStatusRegistry(), Options{Namespaces: []string{"team-a"}})
+	createService(t, clientSet, "team-a", "unannotated", map[string]string{"swagger": ""}, nil)
+	createService(t, clientSet, "team-a", "pets", map[string]string{"swagger": ""}, map[string]string{"swagger-path": "/openapi"})
+	awaitKeys(t, repo, "pets.team-a")
+	for _, name := range []string{"unannotated", "pets"} {
+		check(t, clientSet.CoreV1().Services("team-a").Delete(ctx, name, metav1.DeleteOptions{}))
+	}
+	awaitKeys(t, repo)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if strings.Join(store.removed, ",") != "kubeService/pets.team-a" {
+		t.Errorf("expected only the stored service to be removed, got %v", store.removed)
+	}
+}
+
+func TestNamespacesTheKeysAndUrlsOfServices(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clientSet, repo := startFakeWatcher(t, ctx, Options{ClusterDomain: "example.local"})
+	for _, namespace := range []string{"team-a", "team-b"} {
+		createService(t, clientSet, namespace, "orders", map[string]string{"swagger": ""}, map[string]string{"swagger-path": "/openapi"})
+	}
+	awaitKeys(t, repo, "orders.team-a", "orders.team-b")
+	spec, err := repo.Spec("orders.team-b")
+	check(t, err)
+	if origin, _ := openapi.OriginOf(spec); origin != "http://orders.team-b.svc.example.local:8080/openapi" {
+		t.Errorf("expected the spec to be fetched from the namespaced service, got %s", origin)
+	}
+	if group := openapi.LabelsOf(spec)[openapi.GroupLabel]; group != "team-b" {
+		t.Errorf("expected the spec to be grouped by its namespace, got %s", group)
+	}
+
+	clientSet, repo = startFakeWatcher(t, ctx, Options{KeyTemplate: "{namespace} {name}"})
+	createService(t, clientSet, "team-a", "orders", map[string]string{"swagger": ""}, map[string]string{"swagger-path": "/openapi"})
+	awaitKeys(t, repo, "team-a orders")
+}
+
+func testIngress(name string, annotations map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "Ingress",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "team-a", "annotations": annotations},
+		"spec": map[string]interface{}{
+			"tls":   []interface{}{map[string]interface{}{"hosts": []interface{}{"api.example.com"}}},
+			"rules": []interface{}{map[string]interface{}{"host": "api.example.com", "http": map[string]interface{}{"paths": []interface{}{map[string]interface{}{"path": "/" + name}}}}},
+		},
+	}}
+}
+
+func TestStoresTheSpecsOfAnnotatedIngresses(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clientSet, repo := startFakeWatcher(t, ctx, Options{Ingresses: true},
+		testIngress("orders", map[string]interface{}{"swagger-path": "/openapi.json"}),
+		testIngress("website", map[string]interface{}{}))
+	createService(t, clientSet, "team-a", "orders", map[string]string{"swagger": ""}, map[string]string{"swagger-path": "/openapi"})
+	awaitKeys(t, repo, "orders.team-a", "orders.team-a.ingress")
+	spec, err := repo.Spec("orders.team-a.ingress")
+	check(t, err)
+	if origin, _ := openapi.OriginOf(spec); origin != "https://api.example.com/orders/openapi.json" {
+		t.Errorf("expected the spec to be fetched from the public url, got %s", origin)
+	}
+	if len(openapi.TransformsOf(spec)) != 1 {
+		t.Error("expected the spec to be served with the public url as its server")
+	}
+
+	_, repo = startFakeWatcher(t, ctx, Options{Ingresses: true, RouteKeyTemplate: "{namespace} {name} {kind}"},
+		testIngress("orders", map[string]interface{}{"swagger-path": "/openapi.json"}))
+	awaitKeys(t, repo, "team-a orders ingress")
+}
+
+func TestRejectsNamespacesAndNamespaceSelector(t *testing.T) {
+	if _, err := (Options{Namespaces: []string{"team-a"}, NamespaceSelector: "docs"}).withDefaults(); err == nil {
+		t.Error("expected namespaces and a namespace selector to be rejected")
+	}
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
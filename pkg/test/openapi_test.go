@@ -25,6 +25,7 @@ import (
 	"github.com/SimonSchneider/docs-prox/pkg/test/await"
 
 	"github.com/SimonSchneider/docs-prox/pkg/config"
+	"github.com/SimonSchneider/docs-prox/pkg/logging"
 	"github.com/SimonSchneider/docs-prox/pkg/openapi"
 )
 
@@ -165,6 +166,146 @@ func TestFileServerMutateUrlDuringRun(t *testing.T) {
 	nCheck("after appending good", t, await.That(func() error { return verifyKeys(key1, key2) }))
 }
 
+func TestYamlFileServedInRequestedFormat(t *testing.T) {
+	fileSpecServer, err := newFileSpecServer("swagger-", ".yaml")
+	check(t, err)
+	defer fileSpecServer.Close()
+	check(t, fileSpecServer.CreateAndWriteToFile("swagger-yaml-file.yaml", func(w io.Writer) error {
+		_, err := io.WriteString(w, "ID: yaml-id\n")
+		return err
+	}))
+	client, err := runOpenAPIServer(TmplConfig{FilePath: fileSpecServer.dir, FilePrefix: fileSpecServer.prefix})
+	check(t, err)
+	tests := []struct {
+		path, accept, contentType string
+	}{
+		{"/docs/yaml-file", "", "application/yaml"},
+		{"/docs/yaml-file", "application/json", "application/json"},
+		{"/docs/yaml-file?format=json", "application/yaml", "application/json"},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodGet, client.addr+test.path, nil)
+		check(t, err)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		res, err := client.client.Do(req)
+		check(t, err)
+		if ct := res.Header.Get("Content-Type"); res.StatusCode != http.StatusOK || ct != test.contentType {
+			t.Errorf("%s with accept '%s': expected 200 %s, got %d %s", test.path, test.accept, test.contentType, res.StatusCode, ct)
+		}
+		res.Body.Close()
+	}
+	spec, err := client.getSpec("/docs/yaml-file?format=json")
+	check(t, err)
+	if spec.ID != "yaml-id" {
+		t.Errorf("unexpected spec converted from yaml %v", spec)
+	}
+}
+
+func TestEventsStreamFileChanges(t *testing.T) {
+	fileSpecServer, err := newFileSpecServer("swagger-", ".json")
+	check(t, err)
+	defer fileSpecServer.Close()
+	client, err := runOpenAPIServer(TmplConfig{FilePath: fileSpecServer.dir, FilePrefix: fileSpecServer.prefix})
+	check(t, err)
+	res, err := client.get("/docs/_events")
+	check(t, err)
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+	events := make(chan openapi.Event)
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+				var event openapi.Event
+				if json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event) == nil {
+					events <- event
+				}
+			}
+		}
+	}()
+	awaitEvent := func(eventType openapi.EventType, key string) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case e := <-events:
+				if e.Type == openapi.Replaced {
+					continue
+				}
+				if e.Type != eventType || e.Key != key {
+					t.Errorf("unexpected event %v, expected %s %s", e, eventType, key)
+				}
+				return
+			case <-timeout:
+				t.Errorf("timed out waiting for %s %s", eventType, key)
+				return
+			}
+		}
+	}
+	check(t, fileSpecServer.AddJSONFile("swagger-event-file.json"))
+	awaitEvent(openapi.Added, "event-file")
+	check(t, fileSpecServer.Delete("swagger-event-file.json"))
+	awaitEvent(openapi.Removed, "event-file")
+}
+
+func TestHealthAndStatusOfFileProvider(t *testing.T) {
+	fileSpecServer, err := newFileSpecServer("swagger-", ".json")
+	check(t, err)
+	defer fileSpecServer.Close()
+	check(t, fileSpecServer.AddJSONFile("swagger-status-file.json"))
+	client, err := runOpenAPIServer(TmplConfig{FilePath: fileSpecServer.dir, FilePrefix: fileSpecServer.prefix})
+	check(t, err)
+	for _, path := range []string{"/healthz", "/readyz"} {
+		var health openapi.HealthStatus
+		res, err := client.get(path)
+		check(t, err)
+		check(t, json.NewDecoder(res.Body).Decode(&health))
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || len(health.Providers) != 1 || health.Providers[0].State != openapi.Running {
+			t.Errorf("%s: expected 200 with a running file provider, got %d %v", path, res.StatusCode, health)
+		}
+	}
+	_, err = client.getSpec("/docs/status-file")
+	check(t, err)
+	var status openapi.Status
+	res, err := client.get("/docs/_status")
+	check(t, err)
+	defer res.Body.Close()
+	check(t, json.NewDecoder(res.Body).Decode(&status))
+	if len(status.Specs) != 1 || status.Specs[0].State != "ok" || status.Specs[0].FetchedAt == nil {
+		t.Errorf("expected the fetched spec to be ok, got %v", status.Specs)
+	}
+}
+
+func TestMetricsOfFileProvider(t *testing.T) {
+	fileSpecServer, err := newFileSpecServer("swagger-", ".json")
+	check(t, err)
+	defer fileSpecServer.Close()
+	check(t, fileSpecServer.AddJSONFile("swagger-metrics-file.json"))
+	client, err := runOpenAPIServer(TmplConfig{FilePath: fileSpecServer.dir, FilePrefix: fileSpecServer.prefix})
+	check(t, err)
+	_, err = client.getSpec("/docs/metrics-file")
+	check(t, err)
+	res, err := client.get("/metrics")
+	check(t, err)
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	check(t, err)
+	for _, metric := range []string{
+		`docsprox_upstream_fetch_duration_seconds_count{key="metrics-file"`,
+		`docsprox_spec_cache_requests_total{result="miss"}`,
+		`docsprox_store_operations_total{operation="put"`,
+		`docsprox_http_request_duration_seconds_count{code="200",handler="/docs/{key}",method="get"}`,
+	} {
+		if !strings.Contains(string(body), metric) {
+			t.Errorf("expected metric %s in %s", metric, body)
+		}
+	}
+}
+
 func Test404OnMissingKey(t *testing.T) {
 	c, err := runOpenAPIServer(TmplConfig{})
 	check(t, err)
@@ -206,11 +347,12 @@ func runOpenAPIServer(tmplConfig TmplConfig) (*testClient, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to read and parse config: %w", err)
 	}
-	repo, _, err := conf.BuildRepo(ctx)
+	status := openapi.NewStatusRegistry()
+	repo, _, err := conf.BuildRepo(ctx, status, logging.Nop())
 	if err != nil {
 		return nil, fmt.Errorf("unable to build repositories: %w", err)
 	}
-	listener, _ := openapi.Serve(ctx, repo, conf.Host, conf.Port)
+	listener, _ := openapi.Serve(ctx, repo, conf.Host, conf.Port, openapi.WithStatus(status), openapi.WithServerLogger(logging.Nop()))
 	return newTestClient(listener.Addr()), nil
 }
 
@@ -601,12 +743,14 @@ func newTestConfig() (*testConfig, error) {
 			"path": "{{ .FilePath }}",
 			"prefix": "{{ .FilePrefix }}",
 			"json-ext": ".json",
+			"yaml-ext": ".yaml",
 			"url-ext": ".url"
         },
 		{{- end}}
 		{{- if .KubeEnabled }}
 		"kubernetes": {
-			"enabled": true
+			"enabled": true,
+			"key-template": "{name}"
 		},
 		{{- end }}
 		"thisisignored": 2